@@ -0,0 +1,363 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chaincode/dt4hCC/model"
+)
+
+// ============================================================================
+// PrivacyBudgetContract – budget lifecycle
+// ============================================================================
+
+// InitializeBudget creates a budget of totalEpsilon for a user on a dataset
+// under a data use agreement.
+func (c *Client) InitializeBudget(ctx context.Context, userID, datasetID string, totalEpsilon float64, agreementID string) (*model.PrivacyBudget, error) {
+	var budget *model.PrivacyBudget
+	err := c.submit(ctx, c.Budget, "InitializeBudget", &budget,
+		userID, datasetID, formatFloat(totalEpsilon), agreementID)
+	return budget, err
+}
+
+// ConsumeBudget charges epsilonUsed to a user's budget for a query serving
+// purpose.
+func (c *Client) ConsumeBudget(ctx context.Context, userID, datasetID string, epsilonUsed float64, queryBody, purpose string) (*model.PrivacyBudget, error) {
+	var budget *model.PrivacyBudget
+	err := c.submit(ctx, c.Budget, "ConsumeBudget", &budget,
+		userID, datasetID, formatFloat(epsilonUsed), queryBody, purpose)
+	return budget, err
+}
+
+// UpdateBudget sets a new total ε; it may not drop below the consumed ε.
+func (c *Client) UpdateBudget(ctx context.Context, userID, datasetID string, newTotalEpsilon float64) (*model.PrivacyBudget, error) {
+	var budget *model.PrivacyBudget
+	err := c.submit(ctx, c.Budget, "UpdateBudget", &budget, userID, datasetID, formatFloat(newTotalEpsilon))
+	return budget, err
+}
+
+// RevokeBudget revokes a budget permanently.
+func (c *Client) RevokeBudget(ctx context.Context, userID, datasetID string) error {
+	return c.submit(ctx, c.Budget, "RevokeBudget", nil, userID, datasetID)
+}
+
+// SuspendBudget stops consumption on a budget until ResumeBudget; reasonCode
+// is one of model.SUSPEND_REASON_CODES.
+func (c *Client) SuspendBudget(ctx context.Context, userID, datasetID, reasonCode, note string) (*model.PrivacyBudget, error) {
+	var budget *model.PrivacyBudget
+	err := c.submit(ctx, c.Budget, "SuspendBudget", &budget, userID, datasetID, reasonCode, note)
+	return budget, err
+}
+
+// ResumeBudget resumes a Suspended budget.
+func (c *Client) ResumeBudget(ctx context.Context, userID, datasetID, reasonCode, note string) (*model.PrivacyBudget, error) {
+	var budget *model.PrivacyBudget
+	err := c.submit(ctx, c.Budget, "ResumeBudget", &budget, userID, datasetID, reasonCode, note)
+	return budget, err
+}
+
+// AssignBudgetAgreement places a budget created before data use agreements
+// under agreementID. Such budgets cannot be consumed until then.
+func (c *Client) AssignBudgetAgreement(ctx context.Context, userID, datasetID, agreementID string) (*model.PrivacyBudget, error) {
+	var budget *model.PrivacyBudget
+	err := c.submit(ctx, c.Budget, "AssignBudgetAgreement", &budget, userID, datasetID, agreementID)
+	return budget, err
+}
+
+// SetBudgetPurposes restricts a budget to purposes; no purposes lifts the
+// restriction.
+func (c *Client) SetBudgetPurposes(ctx context.Context, userID, datasetID string, purposes []string) (*model.PrivacyBudget, error) {
+	if purposes == nil {
+		purposes = []string{}
+	}
+	purposesJSON, err := formatJSON(purposes)
+	if err != nil {
+		return nil, fmt.Errorf("SetBudgetPurposes: %v", err)
+	}
+	var budget *model.PrivacyBudget
+	err = c.submit(ctx, c.Budget, "SetBudgetPurposes", &budget, userID, datasetID, purposesJSON)
+	return budget, err
+}
+
+// SetBudgetWarningThresholds sets the warning thresholds of a budget, as
+// ascending percentages; no thresholds reverts to the dataset's.
+func (c *Client) SetBudgetWarningThresholds(ctx context.Context, userID, datasetID string, thresholds []float64) (*model.PrivacyBudget, error) {
+	if thresholds == nil {
+		thresholds = []float64{}
+	}
+	thresholdsJSON, err := formatJSON(thresholds)
+	if err != nil {
+		return nil, fmt.Errorf("SetBudgetWarningThresholds: %v", err)
+	}
+	var budget *model.PrivacyBudget
+	err = c.submit(ctx, c.Budget, "SetBudgetWarningThresholds", &budget, userID, datasetID, thresholdsJSON)
+	return budget, err
+}
+
+// ---------------------------------------------------------------------------
+// Batch provisioning
+// ---------------------------------------------------------------------------
+
+// InitializeBudgetsBatch creates a budget for every request in one
+// transaction; if any request is invalid, none is applied.
+func (c *Client) InitializeBudgetsBatch(ctx context.Context, requests []model.BudgetRequest) ([]*model.BudgetBatchResult, error) {
+	return c.submitBatch(ctx, "InitializeBudgetsBatch", requests)
+}
+
+// UpdateBudgetsBatch sets the total ε of every requested budget in one
+// transaction.
+func (c *Client) UpdateBudgetsBatch(ctx context.Context, requests []model.BudgetRequest) ([]*model.BudgetBatchResult, error) {
+	return c.submitBatch(ctx, "UpdateBudgetsBatch", requests)
+}
+
+// RevokeBudgetsBatch revokes every requested budget in one transaction.
+func (c *Client) RevokeBudgetsBatch(ctx context.Context, requests []model.BudgetRequest) ([]*model.BudgetBatchResult, error) {
+	return c.submitBatch(ctx, "RevokeBudgetsBatch", requests)
+}
+
+// submitBatch submits one of the *Batch functions.
+func (c *Client) submitBatch(ctx context.Context, name string, requests []model.BudgetRequest) ([]*model.BudgetBatchResult, error) {
+	if requests == nil {
+		requests = []model.BudgetRequest{}
+	}
+	requestsJSON, err := formatJSON(requests)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	var results []*model.BudgetBatchResult
+	err = c.submit(ctx, c.Budget, name, &results, requestsJSON)
+	return results, err
+}
+
+// ---------------------------------------------------------------------------
+// Budgets
+// ---------------------------------------------------------------------------
+
+// GetBudget returns the budget of a user on a dataset.
+func (c *Client) GetBudget(ctx context.Context, userID, datasetID string) (*model.PrivacyBudget, error) {
+	var budget *model.PrivacyBudget
+	err := c.evaluate(ctx, c.Budget, "GetBudget", &budget, userID, datasetID)
+	return budget, err
+}
+
+// GetRemainingBudget returns the ε left on a budget.
+func (c *Client) GetRemainingBudget(ctx context.Context, userID, datasetID string) (float64, error) {
+	var remaining float64
+	err := c.evaluate(ctx, c.Budget, "GetRemainingBudget", &remaining, userID, datasetID)
+	return remaining, err
+}
+
+// GetBudgetsByUser returns every budget of a user.
+func (c *Client) GetBudgetsByUser(ctx context.Context, userID string) ([]*model.PrivacyBudget, error) {
+	var budgets []*model.PrivacyBudget
+	err := c.evaluate(ctx, c.Budget, "GetBudgetsByUser", &budgets, userID)
+	return budgets, err
+}
+
+// GetBudgetsByDataset returns every budget on a dataset.
+func (c *Client) GetBudgetsByDataset(ctx context.Context, datasetID string) ([]*model.PrivacyBudget, error) {
+	var budgets []*model.PrivacyBudget
+	err := c.evaluate(ctx, c.Budget, "GetBudgetsByDataset", &budgets, datasetID)
+	return budgets, err
+}
+
+// GetBudgetsByStatus returns every budget with a status, e.g.
+// model.BUDGET_EXHAUSTED.
+func (c *Client) GetBudgetsByStatus(ctx context.Context, status string) ([]*model.PrivacyBudget, error) {
+	var budgets []*model.PrivacyBudget
+	err := c.evaluate(ctx, c.Budget, "GetBudgetsByStatus", &budgets, status)
+	return budgets, err
+}
+
+// GetBudgetsByUserPaginated returns one page of a user's budgets. Pass the
+// Bookmark of the previous page, or "" for the first.
+func (c *Client) GetBudgetsByUserPaginated(ctx context.Context, userID string, pageSize int32, bookmark string) (*model.BudgetPage, error) {
+	var page *model.BudgetPage
+	err := c.evaluate(ctx, c.Budget, "GetBudgetsByUserPaginated", &page, userID, formatInt32(pageSize), bookmark)
+	return page, err
+}
+
+// GetBudgetsByDatasetPaginated returns one page of the budgets on a dataset.
+func (c *Client) GetBudgetsByDatasetPaginated(ctx context.Context, datasetID string, pageSize int32, bookmark string) (*model.BudgetPage, error) {
+	var page *model.BudgetPage
+	err := c.evaluate(ctx, c.Budget, "GetBudgetsByDatasetPaginated", &page, datasetID, formatInt32(pageSize), bookmark)
+	return page, err
+}
+
+// GetBudgetHistory returns every committed version of a budget, oldest
+// first.
+func (c *Client) GetBudgetHistory(ctx context.Context, userID, datasetID string) ([]*model.BudgetHistoryEntry, error) {
+	var history []*model.BudgetHistoryEntry
+	err := c.evaluate(ctx, c.Budget, "GetBudgetHistory", &history, userID, datasetID)
+	return history, err
+}
+
+// GetBudgetAsOf returns the version of a budget in force at asOf.
+func (c *Client) GetBudgetAsOf(ctx context.Context, userID, datasetID string, asOf time.Time) (*model.BudgetHistoryEntry, error) {
+	var entry *model.BudgetHistoryEntry
+	err := c.evaluate(ctx, c.Budget, "GetBudgetAsOf", &entry, userID, datasetID, formatTime(asOf))
+	return entry, err
+}
+
+// GetBudgetSummary returns a summary of a budget with its query counters and
+// warning level.
+func (c *Client) GetBudgetSummary(ctx context.Context, userID, datasetID string) (*model.BudgetSummary, error) {
+	var summary *model.BudgetSummary
+	err := c.evaluate(ctx, c.Budget, "GetBudgetSummary", &summary, userID, datasetID)
+	return summary, err
+}
+
+// ---------------------------------------------------------------------------
+// Consumption logs
+// ---------------------------------------------------------------------------
+
+// GetConsumptionLogs returns the consumption log of a budget in sequence
+// order.
+func (c *Client) GetConsumptionLogs(ctx context.Context, userID, datasetID string) ([]*model.BudgetConsumptionLog, error) {
+	var logs []*model.BudgetConsumptionLog
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogs", &logs, userID, datasetID)
+	return logs, err
+}
+
+// GetConsumptionLogsSince returns up to limit entries of a budget's log with
+// a sequence above afterSequence; pass 0 to start from the first entry.
+func (c *Client) GetConsumptionLogsSince(ctx context.Context, userID, datasetID string, afterSequence, limit int) ([]*model.BudgetConsumptionLog, error) {
+	var logs []*model.BudgetConsumptionLog
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsSince", &logs,
+		userID, datasetID, formatInt(afterSequence), formatInt(limit))
+	return logs, err
+}
+
+// GetConsumptionLogsByUser returns every consumption entry of a user.
+func (c *Client) GetConsumptionLogsByUser(ctx context.Context, userID string) ([]*model.BudgetConsumptionLog, error) {
+	var logs []*model.BudgetConsumptionLog
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsByUser", &logs, userID)
+	return logs, err
+}
+
+// GetConsumptionLogsByDataset returns every consumption entry on a dataset.
+func (c *Client) GetConsumptionLogsByDataset(ctx context.Context, datasetID string) ([]*model.BudgetConsumptionLog, error) {
+	var logs []*model.BudgetConsumptionLog
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsByDataset", &logs, datasetID)
+	return logs, err
+}
+
+// GetConsumptionLogsByPurpose returns the consumption entries of a purpose,
+// optionally narrowed to a dataset ("" for all datasets).
+func (c *Client) GetConsumptionLogsByPurpose(ctx context.Context, purpose, datasetID string) ([]*model.BudgetConsumptionLog, error) {
+	var logs []*model.BudgetConsumptionLog
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsByPurpose", &logs, purpose, datasetID)
+	return logs, err
+}
+
+// GetConsumptionLogsPaginated returns one page of a budget's log.
+func (c *Client) GetConsumptionLogsPaginated(ctx context.Context, userID, datasetID string, pageSize int32, bookmark string) (*model.LogPage, error) {
+	var page *model.LogPage
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsPaginated", &page,
+		userID, datasetID, formatInt32(pageSize), bookmark)
+	return page, err
+}
+
+// GetConsumptionLogsByUserPaginated returns one page of a user's
+// consumption entries.
+func (c *Client) GetConsumptionLogsByUserPaginated(ctx context.Context, userID string, pageSize int32, bookmark string) (*model.LogPage, error) {
+	var page *model.LogPage
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsByUserPaginated", &page, userID, formatInt32(pageSize), bookmark)
+	return page, err
+}
+
+// GetConsumptionLogsByDatasetPaginated returns one page of the consumption
+// entries on a dataset.
+func (c *Client) GetConsumptionLogsByDatasetPaginated(ctx context.Context, datasetID string, pageSize int32, bookmark string) (*model.LogPage, error) {
+	var page *model.LogPage
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsByDatasetPaginated", &page, datasetID, formatInt32(pageSize), bookmark)
+	return page, err
+}
+
+// GetConsumptionLogsByPurposePaginated returns one page of the consumption
+// entries of a purpose, optionally narrowed to a dataset.
+func (c *Client) GetConsumptionLogsByPurposePaginated(ctx context.Context, purpose, datasetID string, pageSize int32, bookmark string) (*model.LogPage, error) {
+	var page *model.LogPage
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsByPurposePaginated", &page,
+		purpose, datasetID, formatInt32(pageSize), bookmark)
+	return page, err
+}
+
+// GetConsumptionLogsByTimeRange returns the consumption entries logged in
+// [from, to) through the day indexes, optionally narrowed to a user and a
+// dataset ("" for any).
+func (c *Client) GetConsumptionLogsByTimeRange(ctx context.Context, from, to time.Time, userID, datasetID string) ([]*model.BudgetConsumptionLog, error) {
+	var logs []*model.BudgetConsumptionLog
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsByTimeRange", &logs,
+		formatTime(from), formatTime(to), userID, datasetID)
+	return logs, err
+}
+
+// GetConsumptionLogsAboveEpsilon returns the consumption entries that spent
+// more than threshold ε, optionally narrowed to a dataset.
+func (c *Client) GetConsumptionLogsAboveEpsilon(ctx context.Context, threshold float64, datasetID string) ([]*model.BudgetConsumptionLog, error) {
+	var logs []*model.BudgetConsumptionLog
+	err := c.evaluate(ctx, c.Budget, "GetConsumptionLogsAboveEpsilon", &logs, formatFloat(threshold), datasetID)
+	return logs, err
+}
+
+// VerifyConsumptionLogs checks the hash chain of a budget's log. A broken
+// chain is reported in the result, not as an error.
+func (c *Client) VerifyConsumptionLogs(ctx context.Context, userID, datasetID string) (*model.LogChainReport, error) {
+	var report *model.LogChainReport
+	err := c.evaluate(ctx, c.Budget, "VerifyConsumptionLogs", &report, userID, datasetID)
+	return report, err
+}
+
+// ---------------------------------------------------------------------------
+// Datasets and reports
+// ---------------------------------------------------------------------------
+
+// SetDatasetBudget sets the dataset-level ε cap shared by all budgets on a
+// dataset.
+func (c *Client) SetDatasetBudget(ctx context.Context, datasetID string, totalEpsilon float64) (*model.DatasetBudget, error) {
+	var budget *model.DatasetBudget
+	err := c.submit(ctx, c.Budget, "SetDatasetBudget", &budget, datasetID, formatFloat(totalEpsilon))
+	return budget, err
+}
+
+// GetDatasetBudget returns the dataset-level budget of a dataset.
+func (c *Client) GetDatasetBudget(ctx context.Context, datasetID string) (*model.DatasetBudget, error) {
+	var budget *model.DatasetBudget
+	err := c.evaluate(ctx, c.Budget, "GetDatasetBudget", &budget, datasetID)
+	return budget, err
+}
+
+// GetDatasetStats returns the aggregates of a dataset: budget counts, ε
+// allocated and consumed, the per-MSP breakdown and the ε histogram.
+func (c *Client) GetDatasetStats(ctx context.Context, datasetID string) (*model.DatasetStats, error) {
+	var stats *model.DatasetStats
+	err := c.evaluate(ctx, c.Budget, "GetDatasetStats", &stats, datasetID)
+	return stats, err
+}
+
+// GetTopConsumers returns the n budgets that consumed the most ε on a
+// dataset, largest first.
+func (c *Client) GetTopConsumers(ctx context.Context, datasetID string, n int) ([]*model.PrivacyBudget, error) {
+	var budgets []*model.PrivacyBudget
+	err := c.evaluate(ctx, c.Budget, "GetTopConsumers", &budgets, datasetID, formatInt(n))
+	return budgets, err
+}
+
+// RebuildDatasetStats recomputes the aggregates of a dataset from its
+// budgets and consumption logs.
+func (c *Client) RebuildDatasetStats(ctx context.Context, datasetID string) (*model.DatasetStats, error) {
+	var stats *model.DatasetStats
+	err := c.submit(ctx, c.Budget, "RebuildDatasetStats", &stats, datasetID)
+	return stats, err
+}
+
+// GetAuditReport returns the audit report of a dataset or organisation for
+// [from, to). scope is model.REPORT_SCOPE_DATASET or
+// model.REPORT_SCOPE_ORGANISATION.
+func (c *Client) GetAuditReport(ctx context.Context, scope, scopeID string, from, to time.Time) (*model.AuditReport, error) {
+	var report *model.AuditReport
+	err := c.evaluate(ctx, c.Budget, "GetAuditReport", &report, scope, scopeID, formatTime(from), formatTime(to))
+	return report, err
+}
@@ -0,0 +1,172 @@
+// Package client is a typed Go client for the QueryContract and
+// PrivacyBudgetContract of the dt4hCC chaincode.
+//
+// Every contract function has a method taking Go values and returning the
+// chaincode's own model types, so callers do not build argument JSON or
+// parse results by hand:
+//
+//	gw, conn, _ := gateway.Connect(cfg)
+//	c := client.New(gw.GetNetwork(cfg.Channel), cfg.Chaincode)
+//	entry, err := c.LogQuery(ctx, "ds1", "SELECT COUNT(*) ...", 0.5, "research")
+//	if errors.Is(err, client.ErrInsufficientBudget) {
+//		...
+//	}
+//
+// Errors returned by the chaincode are *ChaincodeError values that wrap one
+// of the Err* sentinels when their kind is recognised. Submitted
+// transactions that fail to commit because of a read conflict are endorsed
+// and submitted again, up to MaxAttempts times. Transactions refused at
+// endorsement are reported to Rejected.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	fabric "github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+const (
+	QUERY_CONTRACT  = "QueryContract"
+	BUDGET_CONTRACT = "PrivacyBudgetContract"
+
+	// DEFAULT_MAX_ATTEMPTS is how often a transaction is submitted before a
+	// read conflict is returned to the caller.
+	DEFAULT_MAX_ATTEMPTS = 3
+	// DEFAULT_RETRY_BACKOFF is the wait before the first resubmission; it
+	// doubles with every further attempt.
+	DEFAULT_RETRY_BACKOFF = 200 * time.Millisecond
+)
+
+// Client calls the dt4hCC contracts of one channel through the Fabric
+// Gateway, as the identity of the gateway connection.
+type Client struct {
+	Query  *fabric.Contract
+	Budget *fabric.Contract
+
+	MaxAttempts  int
+	RetryBackoff time.Duration
+
+	// Rejected, if set, is called with every submitted transaction that the
+	// peers refused at endorsement, such as a LogQuery over budget. These
+	// never reach a block, so the listener cannot see them; see
+	// exporter.EndorsementRejections for a counter to pass here.
+	Rejected func(err *ChaincodeError)
+}
+
+// New returns a Client for the chaincode on the network with the default
+// retry policy.
+func New(network *fabric.Network, chaincode string) *Client {
+	return &Client{
+		Query:        network.GetContractWithName(chaincode, QUERY_CONTRACT),
+		Budget:       network.GetContractWithName(chaincode, BUDGET_CONTRACT),
+		MaxAttempts:  DEFAULT_MAX_ATTEMPTS,
+		RetryBackoff: DEFAULT_RETRY_BACKOFF,
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// evaluate runs a read-only transaction on one peer and decodes its result
+// into out, unless out is nil.
+func (c *Client) evaluate(ctx context.Context, contract *fabric.Contract, name string, out any, args ...string) error {
+	result, err := contract.EvaluateWithContext(ctx, name, fabric.WithArguments(args...))
+	if err != nil {
+		return chaincodeError(contract, name, err)
+	}
+	return decode(contract, name, result, out)
+}
+
+// submit endorses, orders and commits a transaction and decodes its result
+// into out, unless out is nil. A transaction invalidated by a read conflict
+// changed nothing, so it is run again with a new transaction ID after a
+// backoff, until it commits or MaxAttempts is reached.
+func (c *Client) submit(ctx context.Context, contract *fabric.Contract, name string, out any, args ...string) error {
+	attempts := max(c.MaxAttempts, 1)
+	backoff := c.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := contract.SubmitWithContext(ctx, name, fabric.WithArguments(args...))
+		if err == nil {
+			return decode(contract, name, result, out)
+		}
+		if attempt == attempts || !isReadConflict(err) {
+			e := chaincodeError(contract, name, err)
+			var endorseErr *fabric.EndorseError
+			if c.Rejected != nil && errors.As(err, &endorseErr) {
+				c.Rejected(e)
+			}
+			return e
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %v", qualifiedName(contract, name), ctx.Err())
+		}
+		backoff *= 2
+	}
+}
+
+// isReadConflict reports whether err is a commit that failed because
+// another transaction changed the keys or ranges it read.
+func isReadConflict(err error) bool {
+	var commitErr *fabric.CommitError
+	if !errors.As(err, &commitErr) {
+		return false
+	}
+	return commitErr.Code == peer.TxValidationCode_MVCC_READ_CONFLICT ||
+		commitErr.Code == peer.TxValidationCode_PHANTOM_READ_CONFLICT
+}
+
+// decode unmarshals a JSON transaction result into out. Functions that
+// return nothing, or a nil slice, produce an empty result.
+func decode(contract *fabric.Contract, name string, result []byte, out any) error {
+	if out == nil || len(result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(result, out); err != nil {
+		return fmt.Errorf("%s: unmarshal error: %v", qualifiedName(contract, name), err)
+	}
+	return nil
+}
+
+// qualifiedName returns the "Contract:Function" name of a transaction.
+func qualifiedName(contract *fabric.Contract, name string) string {
+	return contract.ContractName() + ":" + name
+}
+
+// formatFloat formats an ε or threshold argument without loss.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatInt formats a count or sequence argument.
+func formatInt(n int) string {
+	return strconv.Itoa(n)
+}
+
+// formatInt32 formats a page size argument.
+func formatInt32(n int32) string {
+	return strconv.FormatInt(int64(n), 10)
+}
+
+// formatTime formats a time argument in RFC 3339 UTC. The chaincode keeps
+// timestamps to the second, so fractions of a second are dropped.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatJSON marshals a structured argument.
+func formatJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("marshal error: %v", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/chaincode/dt4hCC/model"
+	fabric "github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/status"
+)
+
+// ============================================================================
+// Errors – chaincode failures as Go error values
+// ============================================================================
+
+// Kinds of chaincode errors. A *ChaincodeError wraps at most one of them;
+// test with errors.Is.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrInsufficientBudget = errors.New("insufficient budget")
+	ErrNotActive          = errors.New("not active")
+	ErrPurposeNotAllowed  = errors.New("purpose not allowed")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrInvalidArgument    = errors.New("invalid argument")
+	ErrReadConflict       = errors.New("read conflict")
+)
+
+// ChaincodeError is a failed transaction. Message is the error returned by
+// the chaincode, such as "LogQuery: insufficient budget for ...". When the
+// transaction failed outside the chaincode it is the gateway's error,
+// prefixed with the transaction name.
+//
+// A ChaincodeError unwraps to its Kind and to the fabric-gateway error, so
+// errors.As still finds a *fabric.EndorseError or *fabric.CommitError.
+type ChaincodeError struct {
+	Transaction string // "Contract:Function"
+	Message     string
+	Kind        error // one of the Err* values, nil if not recognised
+	Err         error
+}
+
+func (e *ChaincodeError) Error() string {
+	return e.Message
+}
+
+func (e *ChaincodeError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Code returns the chaincode error code of the error's kind, such as
+// model.ERR_INSUFFICIENT_BUDGET, or "" if the kind has none.
+func (e *ChaincodeError) Code() string {
+	for code, kind := range errorCodes {
+		if e.Kind == kind {
+			return code
+		}
+	}
+	return ""
+}
+
+// errorCodes maps the chaincode's error codes (see model.ERR_NOT_FOUND) to
+// kinds.
+var errorCodes = map[string]error{
+	model.ERR_NOT_FOUND:           ErrNotFound,
+	model.ERR_ALREADY_EXISTS:      ErrAlreadyExists,
+	model.ERR_INSUFFICIENT_BUDGET: ErrInsufficientBudget,
+	model.ERR_NOT_ACTIVE:          ErrNotActive,
+	model.ERR_PURPOSE_NOT_ALLOWED: ErrPurposeNotAllowed,
+	model.ERR_UNAUTHORIZED:        ErrUnauthorized,
+	model.ERR_INVALID_ARGUMENT:    ErrInvalidArgument,
+}
+
+// errorCode finds the first error code of a chaincode message, e.g.
+// "[NOT_FOUND]". Batch entry indexes such as "[0]" are not codes.
+var errorCode = regexp.MustCompile(`\[([A-Z][A-Z_]*)\]`)
+
+// errorKinds maps the messages of chaincode versions that predate error
+// codes to kinds. The first match wins, so the more specific patterns come
+// first.
+var errorKinds = []struct {
+	kind    error
+	pattern *regexp.Regexp
+}{
+	{ErrInsufficientBudget, regexp.MustCompile(`insufficient (dataset-level )?budget`)},
+	{ErrNotFound, regexp.MustCompile(`no budget found|no budget for|no dataset-level budget set|` +
+		`is not registered|does not exist|no account found|no consent recorded|is not in the vocabulary`)},
+	{ErrAlreadyExists, regexp.MustCompile(`already exists`)},
+	{ErrUnauthorized, regexp.MustCompile(`unauthorized|caller identity not set|is not a party to|is owned by`)},
+	{ErrPurposeNotAllowed, regexp.MustCompile(`is restricted to purposes|is not covered by`)},
+	// a budget, dataset, user, purpose or agreement whose status forbids
+	// the call, e.g. "budget is Suspended"
+	{ErrNotActive, regexp.MustCompile(`illegal status transition|` +
+		` is (Exhausted|Suspended|Revoked|Retired|Deactivated|Withdrawn|Deprecated|Proposed|Expired|Terminated)\b`)},
+	{ErrInvalidArgument, regexp.MustCompile(`must be|invalid |is required|are required|expected one of|` +
+		`at most|spans more than|unknown report scope|unknown budget status`)},
+}
+
+// chaincodeMessage extracts the chaincode's error from a gateway message of
+// the form "... chaincode response 500, <error>".
+var chaincodeMessage = regexp.MustCompile(`chaincode response \d+, (.*)$`)
+
+// chaincodeError converts an error of the gateway client into a
+// *ChaincodeError. Only messages of the chaincode are classified.
+func chaincodeError(contract *fabric.Contract, name string, err error) *ChaincodeError {
+	e := &ChaincodeError{
+		Transaction: qualifiedName(contract, name),
+		Message:     qualifiedName(contract, name) + ": " + err.Error(),
+		Err:         err,
+	}
+	if isReadConflict(err) {
+		e.Kind = ErrReadConflict
+		return e
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return e
+	}
+	messages := []string{st.Message()}
+	for _, detail := range st.Details() {
+		if d, ok := detail.(*gateway.ErrorDetail); ok {
+			messages = append(messages, d.GetMessage())
+		}
+	}
+	for _, m := range messages {
+		if match := chaincodeMessage.FindStringSubmatch(m); match != nil {
+			e.Message = match[1]
+			e.Kind = errorKind(e.Message)
+			break
+		}
+	}
+	return e
+}
+
+// errorKind classifies a chaincode error message by its first error code,
+// or by its wording if it has none.
+func errorKind(message string) error {
+	if match := errorCode.FindStringSubmatch(message); match != nil {
+		if kind, ok := errorCodes[match[1]]; ok {
+			return kind
+		}
+	}
+	for _, k := range errorKinds {
+		if k.pattern.MatchString(message) {
+			return k.kind
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package client
+
+import "testing"
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    error
+	}{
+		// Messages of the chaincode, with error codes.
+		{
+			name:    "insufficient budget",
+			message: "LogQuery: [INSUFFICIENT_BUDGET] ConsumeBudget: insufficient budget for user=eDUwOTo6Q049YWRtaW46OkNOPWFkbWlu dataset=d1: requested=5.000000 remaining=1.000000",
+			want:    ErrInsufficientBudget,
+		},
+		{
+			name:    "purpose not covered by consent",
+			message: `LogQuery: ConsumeBudget: [PURPOSE_NOT_ALLOWED] purpose "mk" is not covered by consent for dataset d1`,
+			want:    ErrPurposeNotAllowed,
+		},
+		{
+			name:    "budget not found",
+			message: "[NOT_FOUND] readBudget: no budget found for user=ghost dataset=d1",
+			want:    ErrNotFound,
+		},
+		{
+			name:    "budget already exists",
+			message: "[ALREADY_EXISTS] InitializeBudget: budget already exists for user=eDUwOTo6Q049YWRtaW46OkNOPWFkbWlu dataset=d1",
+			want:    ErrAlreadyExists,
+		},
+		{
+			name:    "unauthorized MSP",
+			message: "InitializeBudget: [UNAUTHORIZED] unauthorized MSP: ThirdMSP",
+			want:    ErrUnauthorized,
+		},
+		{
+			name:    "not an administrator",
+			message: "LinkIdentity: [UNAUTHORIZED] unauthorized: caller is not an administrator of UbMSP",
+			want:    ErrUnauthorized,
+		},
+		{
+			name:    "illegal status transition",
+			message: "SuspendBudget: [NOT_ACTIVE] illegal status transition Suspended -> Suspended",
+			want:    ErrNotActive,
+		},
+		{
+			name:    "invalid reason code",
+			message: `SuspendBudget: [INVALID_ARGUMENT] invalid reason code "BOGUS", expected one of [INVESTIGATION POLICY_VIOLATION DATA_OWNER_REQUEST ADMINISTRATIVE]`,
+			want:    ErrInvalidArgument,
+		},
+		{
+			name:    "rejected batch",
+			message: "UpdateBudgetsBatch: 1 of 1 entries rejected, nothing was applied: [0] user=x dataset=d1: [NOT_FOUND] no budget found",
+			want:    ErrNotFound,
+		},
+		{
+			name:    "code without matching wording",
+			message: "[NOT_ACTIVE] ResumeBudget: budget is Active, not Suspended",
+			want:    ErrNotActive,
+		},
+
+		// Messages of chaincode versions without error codes.
+		{
+			name:    "legacy insufficient budget",
+			message: "LogQuery: ConsumeBudget: insufficient budget for user=u1 dataset=d1: requested=5.000000 remaining=1.000000",
+			want:    ErrInsufficientBudget,
+		},
+		{
+			name:    "legacy budget not found",
+			message: "readBudget: no budget found for user=ghost dataset=d1",
+			want:    ErrNotFound,
+		},
+		{
+			name:    "legacy unauthorized MSP",
+			message: "InitializeBudget: unauthorized MSP: ThirdMSP",
+			want:    ErrUnauthorized,
+		},
+		{
+			name:    "legacy not an administrator",
+			message: "LinkIdentity: unauthorized: caller is not an administrator of UbMSP",
+			want:    ErrUnauthorized,
+		},
+		{
+			name:    "legacy illegal status transition",
+			message: "SuspendBudget: illegal status transition Suspended -> Suspended",
+			want:    ErrNotActive,
+		},
+		{
+			name:    "legacy rejected batch",
+			message: "UpdateBudgetsBatch: 1 of 1 entries rejected, nothing was applied: [0] user=x dataset=d1: no budget found",
+			want:    ErrNotFound,
+		},
+
+		// Unrecognised messages.
+		{
+			name:    "unknown code",
+			message: "LogQuery: [RATE_LIMITED] too many queries",
+			want:    nil,
+		},
+		{
+			name:    "unrelated failure",
+			message: "GetBudget: failed to read state: connection reset",
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorKind(tt.message); got != tt.want {
+				t.Fatalf("errorKind(%q) = %v, want %v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChaincodeErrorCode(t *testing.T) {
+	tests := []struct {
+		kind error
+		want string
+	}{
+		{ErrInsufficientBudget, "INSUFFICIENT_BUDGET"},
+		{ErrUnauthorized, "UNAUTHORIZED"},
+		{ErrReadConflict, ""},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		e := &ChaincodeError{Kind: tt.kind}
+		if got := e.Code(); got != tt.want {
+			t.Fatalf("Code() of kind %v = %q, want %q", tt.kind, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/chaincode/dt4hCC/model"
+)
+
+// ============================================================================
+// QueryContract – query logging and user history
+// ============================================================================
+
+// LogQuery records a query of the caller on datasetID and charges epsilonUsed
+// to the caller's budget for the declared purpose.
+func (c *Client) LogQuery(ctx context.Context, datasetID, queryBody string, epsilonUsed float64, purpose string) (*model.BudgetConsumptionLog, error) {
+	var entry *model.BudgetConsumptionLog
+	err := c.submit(ctx, c.Query, "LogQuery", &entry, datasetID, queryBody, formatFloat(epsilonUsed), purpose)
+	return entry, err
+}
+
+// GetUserHistory returns the logged queries of a user.
+func (c *Client) GetUserHistory(ctx context.Context, userID string) (*model.UserHistory, error) {
+	var history *model.UserHistory
+	err := c.evaluate(ctx, c.Query, "GetUserHistory", &history, userID)
+	return history, err
+}
+
+// GetMyHistory returns the logged queries of the caller.
+func (c *Client) GetMyHistory(ctx context.Context) (*model.UserHistory, error) {
+	var history *model.UserHistory
+	err := c.evaluate(ctx, c.Query, "GetMyHistory", &history)
+	return history, err
+}
+
+// GetUserHistoryPaginated returns one page of a user's logged queries. Pass
+// the Bookmark of the previous page, or "" for the first.
+func (c *Client) GetUserHistoryPaginated(ctx context.Context, userID string, pageSize int32, bookmark string) (*model.QueryPage, error) {
+	var page *model.QueryPage
+	err := c.evaluate(ctx, c.Query, "GetUserHistoryPaginated", &page, userID, formatInt32(pageSize), bookmark)
+	return page, err
+}
+
+// GetMyHistoryPaginated returns one page of the caller's logged queries.
+func (c *Client) GetMyHistoryPaginated(ctx context.Context, pageSize int32, bookmark string) (*model.QueryPage, error) {
+	var page *model.QueryPage
+	err := c.evaluate(ctx, c.Query, "GetMyHistoryPaginated", &page, formatInt32(pageSize), bookmark)
+	return page, err
+}
+
+// GetQueryHistoryByTimeRange returns the queries logged in [from, to),
+// optionally restricted to a user and a dataset ("" for any).
+func (c *Client) GetQueryHistoryByTimeRange(ctx context.Context, from, to time.Time, userID, datasetID string) ([]*model.UserQuery, error) {
+	var queries []*model.UserQuery
+	err := c.evaluate(ctx, c.Query, "GetQueryHistoryByTimeRange", &queries,
+		formatTime(from), formatTime(to), userID, datasetID)
+	return queries, err
+}
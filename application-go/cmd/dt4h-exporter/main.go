@@ -0,0 +1,102 @@
+// Command dt4h-exporter serves Prometheus metrics on the privacy budgets of
+// the dt4hCC chaincode, computed from the read model of dt4h-listener.
+//
+// Next to a running listener, sharing its database:
+//
+//	dt4h-exporter -db /var/lib/dt4h/readmodel.db -listen :9465
+//
+// Or following the channel itself, with the peer and identity taken from
+// the CORE_PEER_* variables as for dt4h-listener:
+//
+//	dt4h-exporter -db /var/lib/dt4h/readmodel.db -follow
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dt4h/application-go/exporter"
+	"github.com/dt4h/application-go/gateway"
+	"github.com/dt4h/application-go/listener"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func main() {
+	cfg := gateway.ConfigFromEnv()
+	flag.StringVar(&cfg.PeerEndpoint, "peer", cfg.PeerEndpoint, "peer gateway endpoint host:port (with -follow)")
+	flag.StringVar(&cfg.PeerHostname, "peer-hostname", cfg.PeerHostname, "TLS server name of the peer, if not the endpoint host (with -follow)")
+	flag.StringVar(&cfg.TLSCertPath, "tls-cert", cfg.TLSCertPath, "PEM CA certificate of the peer's TLS certificate (with -follow)")
+	flag.StringVar(&cfg.MspID, "msp-id", cfg.MspID, "MSP ID of the client identity (with -follow)")
+	flag.StringVar(&cfg.MSPPath, "msp-path", cfg.MSPPath, "MSP directory of the client identity (with -follow)")
+	flag.StringVar(&cfg.Channel, "channel", cfg.Channel, "channel name (with -follow)")
+	flag.StringVar(&cfg.Chaincode, "chaincode", cfg.Chaincode, "chaincode name")
+	dbPath := flag.String("db", "dt4h-listener.db", "SQLite read model file")
+	listen := flag.String("listen", ":9465", "address to serve /metrics on")
+	follow := flag.Bool("follow", false, "run the listener in process instead of reading a shared read model")
+	flag.Parse()
+
+	store, err := listener.OpenSQLite(*dbPath)
+	if err != nil {
+		log.Fatalf("dt4h-exporter: %v", err)
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		exporter.NewCollector(store, cfg.Chaincode),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+	server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	errs := make(chan error, 2)
+	go func() {
+		log.Printf("dt4h-exporter: serving metrics on %s/metrics", *listen)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}()
+
+	if *follow {
+		gw, conn, err := gateway.Connect(cfg)
+		if err != nil {
+			log.Fatalf("dt4h-exporter: %v", err)
+		}
+		defer conn.Close()
+		defer gw.Close()
+
+		source := listener.NewGatewaySource(gw.GetNetwork(cfg.Channel), cfg.Chaincode)
+		go func() {
+			if err := listener.New(source, store).Run(ctx, -1); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		log.Printf("dt4h-exporter: %v", err)
+		server.Close()
+		os.Exit(1)
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdown)
+}
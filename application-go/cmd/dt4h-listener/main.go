@@ -0,0 +1,82 @@
+// Command dt4h-listener follows the dt4hCC chaincode events and the blocks
+// of the channel through a peer's Fabric Gateway and keeps a SQLite read
+// model of budgets, consumption logs, queries, warnings and rejected
+// transactions up to date.
+//
+// The peer and identity default to the CORE_PEER_* variables, so after
+// sourcing util.sh for a peer:
+//
+//	dt4h-listener -db /var/lib/dt4h/readmodel.db
+//
+// Rebuild the read model from the genesis block:
+//
+//	dt4h-listener -db readmodel.db -reset -from-block 0
+//
+// Drop the rows an erasure left behind, for budgets last written before
+// chaincode schema v9:
+//
+//	dt4h-listener -db readmodel.db -erase-user 'x509::CN=alice,...'
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dt4h/application-go/gateway"
+	"github.com/dt4h/application-go/listener"
+)
+
+func main() {
+	cfg := gateway.ConfigFromEnv()
+	flag.StringVar(&cfg.PeerEndpoint, "peer", cfg.PeerEndpoint, "peer gateway endpoint host:port")
+	flag.StringVar(&cfg.PeerHostname, "peer-hostname", cfg.PeerHostname, "TLS server name of the peer, if not the endpoint host")
+	flag.StringVar(&cfg.TLSCertPath, "tls-cert", cfg.TLSCertPath, "PEM CA certificate of the peer's TLS certificate")
+	flag.StringVar(&cfg.MspID, "msp-id", cfg.MspID, "MSP ID of the client identity")
+	flag.StringVar(&cfg.MSPPath, "msp-path", cfg.MSPPath, "MSP directory of the client identity")
+	flag.StringVar(&cfg.Channel, "channel", cfg.Channel, "channel name")
+	flag.StringVar(&cfg.Chaincode, "chaincode", cfg.Chaincode, "chaincode name")
+	dbPath := flag.String("db", "dt4h-listener.db", "SQLite read model file")
+	fromBlock := flag.Int64("from-block", -1, "block to start both streams at; -1 resumes from the checkpoints")
+	reset := flag.Bool("reset", false, "empty the read model and its checkpoints before starting")
+	eraseUser := flag.String("erase-user", "", "delete the remaining rows of an erased user ID and exit")
+	flag.Parse()
+
+	store, err := listener.OpenSQLite(*dbPath)
+	if err != nil {
+		log.Fatalf("dt4h-listener: %v", err)
+	}
+	defer store.Close()
+
+	if *eraseUser != "" {
+		if err := store.EraseUser(*eraseUser); err != nil {
+			log.Fatalf("dt4h-listener: %v", err)
+		}
+		log.Printf("dt4h-listener: erased rows of %s", *eraseUser)
+		return
+	}
+	if *reset {
+		if err := store.Reset(); err != nil {
+			log.Fatalf("dt4h-listener: %v", err)
+		}
+	}
+
+	gw, conn, err := gateway.Connect(cfg)
+	if err != nil {
+		log.Fatalf("dt4h-listener: %v", err)
+	}
+	defer conn.Close()
+	defer gw.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	source := listener.NewGatewaySource(gw.GetNetwork(cfg.Channel), cfg.Chaincode)
+	if err := listener.New(source, store).Run(ctx, *fromBlock); err != nil {
+		log.Printf("dt4h-listener: %v", err)
+		os.Exit(1)
+	}
+}
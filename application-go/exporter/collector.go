@@ -0,0 +1,158 @@
+// Package exporter exposes the listener's read model as Prometheus metrics.
+//
+// The Collector queries the read model on every scrape instead of keeping
+// counters of its own, so the metrics survive restarts of the exporter and
+// always agree with the tables dashboards query directly.
+package exporter
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/chaincode/dt4hCC/model"
+	"github.com/dt4h/application-go/listener"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "dt4h"
+
+// Collector is a prometheus.Collector over a listener.Store.
+//
+// Budget gauges are labelled with the MSP that initialised the budgets,
+// query counters with the MSP that submitted the queries. Allocation
+// excludes Revoked budgets and remaining ε counts Active budgets only;
+// consumption covers every budget, as spent ε stays spent.
+type Collector struct {
+	store     *listener.Store
+	chaincode string
+
+	allocated *prometheus.Desc
+	consumed  *prometheus.Desc
+	remaining *prometheus.Desc
+	budgets   *prometheus.Desc
+	queries   *prometheus.Desc
+	epsilon   *prometheus.Desc
+	warnings  *prometheus.Desc
+	rejected  *prometheus.Desc
+	block     *prometheus.Desc
+}
+
+// NewCollector returns a Collector over store. Commit-time rejections are
+// counted for chaincode only.
+func NewCollector(store *listener.Store, chaincode string) *Collector {
+	return &Collector{
+		store:     store,
+		chaincode: chaincode,
+		allocated: prometheus.NewDesc(namespace+"_budget_epsilon_allocated",
+			"Total ε of the budgets that are not Revoked, by dataset and granting MSP.",
+			[]string{"dataset", "msp"}, nil),
+		consumed: prometheus.NewDesc(namespace+"_budget_epsilon_consumed",
+			"ε consumed from the budgets, by dataset and granting MSP.",
+			[]string{"dataset", "msp"}, nil),
+		remaining: prometheus.NewDesc(namespace+"_budget_epsilon_remaining",
+			"ε still available on Active budgets, by dataset and granting MSP.",
+			[]string{"dataset", "msp"}, nil),
+		budgets: prometheus.NewDesc(namespace+"_budgets",
+			"Number of budgets, by dataset and status.",
+			[]string{"dataset", "status"}, nil),
+		queries: prometheus.NewDesc(namespace+"_queries_total",
+			"Charges to budgets, by dataset, submitting MSP and purpose.",
+			[]string{"dataset", "msp", "purpose"}, nil),
+		epsilon: prometheus.NewDesc(namespace+"_query_epsilon_total",
+			"ε charged to budgets, by dataset and submitting MSP.",
+			[]string{"dataset", "msp"}, nil),
+		warnings: prometheus.NewDesc(namespace+"_budget_threshold_crossings_total",
+			"Warning thresholds crossed by budgets, by dataset and threshold.",
+			[]string{"dataset", "threshold"}, nil),
+		rejected: prometheus.NewDesc(namespace+"_commit_rejected_transactions_total",
+			"Transactions of the chaincode that were ordered but failed validation at commit, by validation code. Proposals refused at endorsement are not counted.",
+			[]string{"validation_code"}, nil),
+		block: prometheus.NewDesc(namespace+"_read_model_block",
+			"Last block applied to the read model, by stream.",
+			[]string{"stream"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.allocated, c.consumed, c.remaining, c.budgets, c.queries, c.epsilon, c.warnings, c.rejected, c.block,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector. A failing query is reported as
+// an invalid metric of its family; the other families are still collected.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(ch, c.allocated, prometheus.GaugeValue,
+		`SELECT dataset_id, granted_by, SUM(total_budget) FROM budgets
+		 WHERE status != ? GROUP BY dataset_id, granted_by`, model.BUDGET_REVOKED)
+	c.collect(ch, c.consumed, prometheus.GaugeValue,
+		`SELECT dataset_id, granted_by, SUM(consumed_budget) FROM budgets
+		 GROUP BY dataset_id, granted_by`)
+	c.collect(ch, c.remaining, prometheus.GaugeValue,
+		`SELECT dataset_id, granted_by, SUM(remaining_budget) FROM budgets
+		 WHERE status = ? GROUP BY dataset_id, granted_by`, model.BUDGET_ACTIVE)
+	c.collect(ch, c.budgets, prometheus.GaugeValue,
+		`SELECT dataset_id, status, COUNT(*) FROM budgets GROUP BY dataset_id, status`)
+	c.collect(ch, c.queries, prometheus.CounterValue,
+		`SELECT dataset_id, msp_id, purpose, COUNT(*) FROM consumption_logs
+		 GROUP BY dataset_id, msp_id, purpose`)
+	c.collect(ch, c.epsilon, prometheus.CounterValue,
+		`SELECT dataset_id, msp_id, SUM(epsilon_used) FROM consumption_logs
+		 GROUP BY dataset_id, msp_id`)
+	c.collect(ch, c.warnings, prometheus.CounterValue,
+		`SELECT dataset_id, threshold, COUNT(*) FROM warnings
+		 GROUP BY dataset_id, threshold`)
+	c.collect(ch, c.rejected, prometheus.CounterValue,
+		`SELECT validation_code, COUNT(*) FROM rejected_transactions
+		 WHERE chaincode_name = ? GROUP BY validation_code`, c.chaincode)
+	c.collect(ch, c.block, prometheus.GaugeValue,
+		`SELECT stream, block_number FROM checkpoints`)
+}
+
+// collect sends one metric per row of query. Every row holds the label
+// values of desc, in order, followed by the value; numeric labels are
+// formatted by database/sql, so a threshold of 50 reads "50".
+func (c *Collector) collect(ch chan<- prometheus.Metric, desc *prometheus.Desc,
+	valueType prometheus.ValueType, query string, args ...any) {
+	if err := c.queryMetrics(ch, desc, valueType, query, args...); err != nil {
+		log.Printf("Collect: %v", err)
+		ch <- prometheus.NewInvalidMetric(desc, err)
+	}
+}
+
+// queryMetrics runs query and sends its rows as metrics of desc.
+func (c *Collector) queryMetrics(ch chan<- prometheus.Metric, desc *prometheus.Desc,
+	valueType prometheus.ValueType, query string, args ...any) error {
+	rows, err := c.store.DB().Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("queryMetrics: %v", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("queryMetrics: %v", err)
+	}
+	labels := make([]string, len(cols)-1)
+	var value float64
+	dest := make([]any, len(cols))
+	for i := range labels {
+		dest[i] = &labels[i]
+	}
+	dest[len(labels)] = &value
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("queryMetrics: %v", err)
+		}
+		m, err := prometheus.NewConstMetric(desc, valueType, value, labels...)
+		if err != nil {
+			return fmt.Errorf("queryMetrics: %v", err)
+		}
+		ch <- m
+	}
+	return rows.Err()
+}
@@ -0,0 +1,163 @@
+package exporter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/chaincode/dt4hCC/model"
+	"github.com/dt4h/application-go/client"
+	"github.com/dt4h/application-go/listener"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+const (
+	testChaincode = "dt4hCC"
+	testUser      = "x509::CN=alice"
+	testDataset   = "ds1"
+)
+
+// event encodes one typed event of an envelope.
+func event(t *testing.T, eventType string, payload any) *model.ChaincodeEvent {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &model.ChaincodeEvent{Type: eventType, Version: model.EVENT_PAYLOAD_VERSION, Payload: data}
+}
+
+// apply applies a transaction of mspID emitting events to the store.
+func apply(t *testing.T, store *listener.Store, block uint64, txID, mspID string, events ...*model.ChaincodeEvent) {
+	t.Helper()
+	data, err := json.Marshal(&model.EventEnvelope{
+		SchemaVersion: model.EVENT_ENVELOPE_VERSION,
+		TxID:          txID,
+		Timestamp:     "2025-03-14T08:41:07Z",
+		MspID:         mspID,
+		Events:        events,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ApplyChaincodeEvent(&listener.ChaincodeEvent{
+		BlockNumber:   block,
+		TxID:          txID,
+		ChaincodeName: testChaincode,
+		EventName:     model.BUDGET_EVENT_NAME,
+		Payload:       data,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openStore(t *testing.T) *listener.Store {
+	t.Helper()
+	store, err := listener.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// ---------------------------------------------------------------------------
+// Tests
+// ---------------------------------------------------------------------------
+
+func TestCollector(t *testing.T) {
+	store := openStore(t)
+
+	// Org1MSP grants a budget of 10, Org2MSP submits two charges and the
+	// second crosses the 50% threshold.
+	apply(t, store, 1, "tx1", "Org1MSP", event(t, model.EVENT_BUDGET_INITIALIZED, &model.BudgetEventPayload{
+		UserID: testUser, DatasetID: testDataset, Status: model.BUDGET_ACTIVE,
+		TotalBudget: 10, RemainingBudget: 10,
+	}))
+	apply(t, store, 2, "tx2", "Org2MSP", event(t, model.EVENT_BUDGET_CONSUMED, &model.BudgetConsumedPayload{
+		UserID: testUser, DatasetID: testDataset, Purpose: "research", Sequence: 1,
+		EpsilonUsed: 2, ConsumedBudget: 2, RemainingBudget: 8,
+	}))
+	apply(t, store, 3, "tx3", "Org2MSP",
+		event(t, model.EVENT_BUDGET_CONSUMED, &model.BudgetConsumedPayload{
+			UserID: testUser, DatasetID: testDataset, Purpose: "research", Sequence: 2,
+			EpsilonUsed: 4, ConsumedBudget: 6, RemainingBudget: 4,
+		}),
+		event(t, model.EVENT_THRESHOLD_CROSSED, &model.ThresholdCrossedPayload{
+			UserID: testUser, DatasetID: testDataset, Threshold: 50, ConsumedPercent: 60,
+		}))
+
+	// Commit-time rejections are counted for the collector's chaincode only.
+	if err := store.ApplyBlock(&listener.Block{Number: 4, Transactions: []*listener.Transaction{
+		{TxID: "tx4", ValidationCode: "MVCC_READ_CONFLICT", ChaincodeName: testChaincode},
+		{TxID: "tx5", ValidationCode: "MVCC_READ_CONFLICT", ChaincodeName: "other"},
+		{TxID: "tx6", ValidationCode: listener.VALID_TX, ChaincodeName: testChaincode},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `
+# HELP dt4h_budget_epsilon_allocated Total ε of the budgets that are not Revoked, by dataset and granting MSP.
+# TYPE dt4h_budget_epsilon_allocated gauge
+dt4h_budget_epsilon_allocated{dataset="ds1",msp="Org1MSP"} 10
+# HELP dt4h_budget_epsilon_consumed ε consumed from the budgets, by dataset and granting MSP.
+# TYPE dt4h_budget_epsilon_consumed gauge
+dt4h_budget_epsilon_consumed{dataset="ds1",msp="Org1MSP"} 6
+# HELP dt4h_budget_epsilon_remaining ε still available on Active budgets, by dataset and granting MSP.
+# TYPE dt4h_budget_epsilon_remaining gauge
+dt4h_budget_epsilon_remaining{dataset="ds1",msp="Org1MSP"} 4
+# HELP dt4h_budgets Number of budgets, by dataset and status.
+# TYPE dt4h_budgets gauge
+dt4h_budgets{dataset="ds1",status="Active"} 1
+# HELP dt4h_queries_total Charges to budgets, by dataset, submitting MSP and purpose.
+# TYPE dt4h_queries_total counter
+dt4h_queries_total{dataset="ds1",msp="Org2MSP",purpose="research"} 2
+# HELP dt4h_query_epsilon_total ε charged to budgets, by dataset and submitting MSP.
+# TYPE dt4h_query_epsilon_total counter
+dt4h_query_epsilon_total{dataset="ds1",msp="Org2MSP"} 6
+# HELP dt4h_budget_threshold_crossings_total Warning thresholds crossed by budgets, by dataset and threshold.
+# TYPE dt4h_budget_threshold_crossings_total counter
+dt4h_budget_threshold_crossings_total{dataset="ds1",threshold="50"} 1
+# HELP dt4h_commit_rejected_transactions_total Transactions of the chaincode that were ordered but failed validation at commit, by validation code. Proposals refused at endorsement are not counted.
+# TYPE dt4h_commit_rejected_transactions_total counter
+dt4h_commit_rejected_transactions_total{validation_code="MVCC_READ_CONFLICT"} 1
+# HELP dt4h_read_model_block Last block applied to the read model, by stream.
+# TYPE dt4h_read_model_block gauge
+dt4h_read_model_block{stream="blocks"} 4
+dt4h_read_model_block{stream="chaincode"} 3
+`
+	if err := testutil.CollectAndCompare(NewCollector(store, testChaincode), strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorEmptyStore(t *testing.T) {
+	store := openStore(t)
+
+	if n := testutil.CollectAndCount(NewCollector(store, testChaincode)); n != 0 {
+		t.Fatalf("collected %d metrics from an empty store, want 0", n)
+	}
+}
+
+func TestEndorsementRejections(t *testing.T) {
+	rejections := NewEndorsementRejections()
+	rejections.Observe(&client.ChaincodeError{Transaction: "QueryContract:LogQuery", Kind: client.ErrInsufficientBudget})
+	rejections.Observe(&client.ChaincodeError{Transaction: "QueryContract:LogQuery", Kind: client.ErrInsufficientBudget})
+	rejections.Observe(&client.ChaincodeError{Transaction: "QueryContract:LogQuery", Kind: client.ErrPurposeNotAllowed})
+	rejections.Observe(&client.ChaincodeError{Transaction: "PrivacyBudgetContract:ConsumeBudget"})
+
+	want := `
+# HELP dt4h_endorsement_rejected_transactions_total Transactions submitted by this client that the peers refused at endorsement, by transaction and error code.
+# TYPE dt4h_endorsement_rejected_transactions_total counter
+dt4h_endorsement_rejected_transactions_total{code="INSUFFICIENT_BUDGET",transaction="QueryContract:LogQuery"} 2
+dt4h_endorsement_rejected_transactions_total{code="PURPOSE_NOT_ALLOWED",transaction="QueryContract:LogQuery"} 1
+dt4h_endorsement_rejected_transactions_total{code="UNKNOWN",transaction="PrivacyBudgetContract:ConsumeBudget"} 1
+`
+	if err := testutil.CollectAndCompare(rejections, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,54 @@
+package exporter
+
+import (
+	"github.com/dt4h/application-go/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UNKNOWN_CODE labels refusals whose message carries no recognised error
+// code, such as those of chaincode versions without codes.
+const UNKNOWN_CODE = "UNKNOWN"
+
+// EndorsementRejections counts the transactions of a client.Client that the
+// peers refused at endorsement, such as LogQuery calls over budget or for a
+// purpose the consent does not cover. Those transactions never reach a
+// block, so the Collector cannot count them; register an
+// EndorsementRejections in the process that submits them instead:
+//
+//	rejections := exporter.NewEndorsementRejections()
+//	prometheus.MustRegister(rejections)
+//	c.Rejected = rejections.Observe
+type EndorsementRejections struct {
+	counter *prometheus.CounterVec
+}
+
+// NewEndorsementRejections returns a counter with no refusals recorded.
+func NewEndorsementRejections() *EndorsementRejections {
+	return &EndorsementRejections{
+		counter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "endorsement_rejected_transactions_total",
+			Help:      "Transactions submitted by this client that the peers refused at endorsement, by transaction and error code.",
+		}, []string{"transaction", "code"}),
+	}
+}
+
+// Observe counts a refused transaction. It has the signature of
+// client.Client.Rejected.
+func (r *EndorsementRejections) Observe(err *client.ChaincodeError) {
+	code := err.Code()
+	if code == "" {
+		code = UNKNOWN_CODE
+	}
+	r.counter.WithLabelValues(err.Transaction, code).Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (r *EndorsementRejections) Describe(ch chan<- *prometheus.Desc) {
+	r.counter.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *EndorsementRejections) Collect(ch chan<- prometheus.Metric) {
+	r.counter.Collect(ch)
+}
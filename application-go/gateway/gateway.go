@@ -0,0 +1,163 @@
+// Package gateway connects client applications to the dt4h network through
+// the Fabric Gateway of one peer.
+//
+// The connection settings default to the CORE_PEER_* variables util.sh
+// exports for a peer, and to the CHANNEL_NAME and CC_NAME of configCC.sh, so
+// a shell prepared for the peer CLI can run the applications unchanged.
+package gateway
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/hash"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Defaults used when neither a flag nor the environment sets a value.
+const (
+	DEFAULT_CHANNEL   = "dt4h"
+	DEFAULT_CHAINCODE = "dt4hCC"
+)
+
+// Config describes the peer to connect to and the identity to connect as.
+type Config struct {
+	PeerEndpoint string // host:port of the peer's gateway service
+	PeerHostname string // TLS server name, when it differs from the endpoint host
+	TLSCertPath  string // PEM CA certificate of the peer's TLS certificate
+	MspID        string
+	MSPPath      string // MSP directory holding signcerts/ and keystore/
+	Channel      string
+	Chaincode    string
+}
+
+// ConfigFromEnv returns a Config filled from the environment.
+func ConfigFromEnv() *Config {
+	return &Config{
+		PeerEndpoint: os.Getenv("CORE_PEER_ADDRESS"),
+		PeerHostname: os.Getenv("CORE_PEER_TLS_SERVERHOSTOVERRIDE"),
+		TLSCertPath:  os.Getenv("CORE_PEER_TLS_ROOTCERT_FILE"),
+		MspID:        os.Getenv("CORE_PEER_LOCALMSPID"),
+		MSPPath:      os.Getenv("CORE_PEER_MSPCONFIGPATH"),
+		Channel:      envOr("CHANNEL_NAME", DEFAULT_CHANNEL),
+		Chaincode:    envOr("CC_NAME", DEFAULT_CHAINCODE),
+	}
+}
+
+// Connect opens a gRPC connection to the peer and a gateway over it. The
+// caller closes both, the gateway first.
+func Connect(cfg *Config) (*client.Gateway, *grpc.ClientConn, error) {
+	if cfg.PeerEndpoint == "" || cfg.TLSCertPath == "" || cfg.MspID == "" || cfg.MSPPath == "" {
+		return nil, nil, fmt.Errorf("Connect: peer endpoint, TLS certificate, MSP ID and MSP path are required")
+	}
+
+	conn, err := dial(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Connect: %v", err)
+	}
+	id, err := newIdentity(cfg)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("Connect: %v", err)
+	}
+	sign, err := newSign(cfg)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("Connect: %v", err)
+	}
+
+	gw, err := client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithHash(hash.SHA256),
+		client.WithClientConnection(conn),
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(1*time.Minute),
+	)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("Connect: %v", err)
+	}
+	return gw, conn, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// dial opens the TLS gRPC connection to the peer.
+func dial(cfg *Config) (*grpc.ClientConn, error) {
+	pemBytes, err := os.ReadFile(cfg.TLSCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("dial: read TLS certificate: %v", err)
+	}
+	cert, err := identity.CertificateFromPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("dial: parse TLS certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	creds := credentials.NewClientTLSFromCert(pool, cfg.PeerHostname)
+
+	conn, err := grpc.NewClient(cfg.PeerEndpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("dial: %v", err)
+	}
+	return conn, nil
+}
+
+// newIdentity loads the X.509 certificate from the MSP's signcerts.
+func newIdentity(cfg *Config) (*identity.X509Identity, error) {
+	pemBytes, err := readFirstFile(filepath.Join(cfg.MSPPath, "signcerts"))
+	if err != nil {
+		return nil, fmt.Errorf("newIdentity: %v", err)
+	}
+	cert, err := identity.CertificateFromPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("newIdentity: %v", err)
+	}
+	return identity.NewX509Identity(cfg.MspID, cert)
+}
+
+// newSign loads the private key from the MSP's keystore.
+func newSign(cfg *Config) (identity.Sign, error) {
+	pemBytes, err := readFirstFile(filepath.Join(cfg.MSPPath, "keystore"))
+	if err != nil {
+		return nil, fmt.Errorf("newSign: %v", err)
+	}
+	key, err := identity.PrivateKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("newSign: %v", err)
+	}
+	return identity.NewPrivateKeySign(key)
+}
+
+// readFirstFile reads the only (or first) file of an MSP sub-directory.
+func readFirstFile(dir string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			return os.ReadFile(filepath.Join(dir, e.Name()))
+		}
+	}
+	return nil, fmt.Errorf("no file in %s", dir)
+}
+
+// envOr returns the environment variable, or def when it is unset.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
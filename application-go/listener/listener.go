@@ -0,0 +1,125 @@
+// Package listener materialises the dt4hCC chaincode events into a SQL read
+// model that dashboards can query without touching the ledger.
+//
+// A Listener follows two streams of a Source: the chaincode events, whose
+// EventEnvelopes update budgets, consumption logs, queries and warnings, and
+// the blocks, whose validation codes reveal the transactions the peers
+// rejected. Each stream is checkpointed in the Store, so a restarted
+// listener resumes where it stopped; starting it at an earlier block
+// replays the channel from there.
+package listener
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Listener keeps a Store up to date with a Source.
+type Listener struct {
+	Source Source
+	Store  *Store
+}
+
+// New returns a Listener applying the events of source to store.
+func New(source Source, store *Store) *Listener {
+	return &Listener{Source: source, Store: store}
+}
+
+// Run follows both streams until ctx is cancelled, which returns nil, or a
+// stream fails. With fromBlock < 0 each stream resumes from its checkpoint;
+// otherwise both start at fromBlock, and transactions already applied are
+// skipped.
+func (l *Listener) Run(ctx context.Context, fromBlock int64) error {
+	method := "Run"
+
+	eventsStart, blocksStart, err := l.startBlocks(fromBlock)
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	log.Printf("%s: chaincode events from block %d, blocks from block %d", method, eventsStart, blocksStart)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	go func() { errs <- l.followChaincodeEvents(ctx, eventsStart) }()
+	go func() { errs <- l.followBlocks(ctx, blocksStart) }()
+
+	// The first stream to stop stops the other.
+	err = <-errs
+	cancel()
+	if err2 := <-errs; err == nil {
+		err = err2
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// startBlocks returns the block each stream starts at. The chaincode event
+// stream restarts at its checkpoint block, whose remaining events may not
+// have been applied yet; the block stream starts after its checkpoint.
+func (l *Listener) startBlocks(fromBlock int64) (events, blocks uint64, err error) {
+	if fromBlock >= 0 {
+		return uint64(fromBlock), uint64(fromBlock), nil
+	}
+	block, _, ok, err := l.Store.Checkpoint(STREAM_CHAINCODE_EVENTS)
+	if err != nil {
+		return 0, 0, fmt.Errorf("startBlocks: %v", err)
+	}
+	if ok {
+		events = block
+	}
+	block, _, ok, err = l.Store.Checkpoint(STREAM_BLOCKS)
+	if err != nil {
+		return 0, 0, fmt.Errorf("startBlocks: %v", err)
+	}
+	if ok {
+		blocks = block + 1
+	}
+	return events, blocks, nil
+}
+
+// followChaincodeEvents applies chaincode events until the stream ends.
+func (l *Listener) followChaincodeEvents(ctx context.Context, start uint64) error {
+	events, err := l.Source.ChaincodeEvents(ctx, start)
+	if err != nil {
+		return fmt.Errorf("followChaincodeEvents: %v", err)
+	}
+	for ev := range events {
+		applied, err := l.Store.ApplyChaincodeEvent(ev)
+		if err != nil {
+			return fmt.Errorf("followChaincodeEvents: %v", err)
+		}
+		if applied {
+			log.Printf("followChaincodeEvents: applied block=%d tx=%s", ev.BlockNumber, ev.TxID)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("followChaincodeEvents: event stream closed")
+}
+
+// followBlocks records rejected transactions until the stream ends.
+func (l *Listener) followBlocks(ctx context.Context, start uint64) error {
+	blocks, err := l.Source.Blocks(ctx, start)
+	if err != nil {
+		return fmt.Errorf("followBlocks: %v", err)
+	}
+	for b := range blocks {
+		if err := l.Store.ApplyBlock(b); err != nil {
+			return fmt.Errorf("followBlocks: %v", err)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("followBlocks: block stream closed")
+}
@@ -0,0 +1,423 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chaincode/dt4hCC/model"
+)
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+const (
+	testMSP      = "Org1MSP"
+	testUser     = "x509::CN=alice"
+	testDataset  = "ds1"
+	testSubject  = "3b02636daf91895a16b80f18ccc582ea611e85759b77df0837cd040eacfda36e"
+	testPseudo   = "erased:5438a62ba2fb3e68aae9f3a57bd4e17b"
+	testTimeout  = 5 * time.Second
+	testInterval = 5 * time.Millisecond
+)
+
+// event encodes one typed event of an envelope.
+func event(t *testing.T, eventType string, payload any) *model.ChaincodeEvent {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &model.ChaincodeEvent{Type: eventType, Version: model.EVENT_PAYLOAD_VERSION, Payload: data}
+}
+
+// tx is a valid transaction of testMSP emitting events.
+func tx(txID string, events ...*model.ChaincodeEvent) *MockTx {
+	return &MockTx{TxID: txID, Envelope: &model.EventEnvelope{
+		SchemaVersion: model.EVENT_ENVELOPE_VERSION,
+		TxID:          txID,
+		Timestamp:     "2025-03-14T08:41:07Z",
+		MspID:         testMSP,
+		Events:        events,
+	}}
+}
+
+// budgetEvent is a budget state change of testUser on testDataset.
+func budgetEvent(t *testing.T, eventType, status string, total, consumed float64) *model.ChaincodeEvent {
+	return event(t, eventType, &model.BudgetEventPayload{
+		UserID:            testUser,
+		DatasetID:         testDataset,
+		Status:            status,
+		TotalBudget:       total,
+		ConsumedBudget:    consumed,
+		RemainingBudget:   total - consumed,
+		AgreementID:       "dua-1",
+		SubjectCommitment: testSubject,
+	})
+}
+
+// consumedEvent is a charge of epsilon to testUser's budget on testDataset.
+func consumedEvent(t *testing.T, sequence int, epsilon, consumed, total float64) *model.ChaincodeEvent {
+	return event(t, model.EVENT_BUDGET_CONSUMED, &model.BudgetConsumedPayload{
+		UserID:            testUser,
+		DatasetID:         testDataset,
+		Purpose:           "research",
+		EpsilonUsed:       epsilon,
+		ConsumedBudget:    consumed,
+		RemainingBudget:   total - consumed,
+		Sequence:          sequence,
+		LogHash:           "hash",
+		SubjectCommitment: testSubject,
+	})
+}
+
+// queryEvent is a query of testUser on testDataset.
+func queryEvent(t *testing.T, sequence int, epsilon float64) *model.ChaincodeEvent {
+	return event(t, model.EVENT_QUERY_LOGGED, &model.QueryLoggedPayload{
+		UserID:      testUser,
+		DatasetID:   testDataset,
+		Purpose:     "research",
+		EpsilonUsed: epsilon,
+		QueryDigest: "digest",
+		Sequence:    sequence,
+	})
+}
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func commit(t *testing.T, src *MockSource, txs ...*MockTx) uint64 {
+	t.Helper()
+	block, err := src.Commit(txs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+// run starts a Listener at fromBlock and returns a function that stops it
+// and fails the test if Run returned an error.
+func run(t *testing.T, src *MockSource, store *Store, fromBlock int64) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(src, store).Run(ctx, fromBlock) }()
+	return func() {
+		t.Helper()
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	}
+}
+
+// waitFor waits until both streams have checkpointed block.
+func waitFor(t *testing.T, store *Store, block uint64) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		events, _, eventsOK, err := store.Checkpoint(STREAM_CHAINCODE_EVENTS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks, _, blocksOK, err := store.Checkpoint(STREAM_BLOCKS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if eventsOK && blocksOK && events >= block && blocks >= block {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("checkpoints did not reach block %d: chaincode=%d blocks=%d", block, events, blocks)
+		}
+		time.Sleep(testInterval)
+	}
+}
+
+// budget returns a budget row, failing the test if there is none.
+func budget(t *testing.T, store *Store, userID string) *BudgetRow {
+	t.Helper()
+	row, err := store.Budget(userID, testDataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row == nil {
+		t.Fatalf("no budget row for user=%s dataset=%s", userID, testDataset)
+	}
+	return row
+}
+
+// count returns the number of rows of a table matching where.
+func count(t *testing.T, store *Store, table, where string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := store.DB().QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE `+where, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// lifecycle commits a budget's initialisation, two charges, the second of
+// which exhausts it, and its revocation, in four blocks.
+func lifecycle(t *testing.T, src *MockSource) uint64 {
+	t.Helper()
+	commit(t, src, tx("tx-init", budgetEvent(t, model.EVENT_BUDGET_INITIALIZED, model.BUDGET_ACTIVE, 2, 0)))
+	commit(t, src, tx("tx-q1", consumedEvent(t, 1, 0.5, 0.5, 2), queryEvent(t, 1, 0.5)))
+	commit(t, src, tx("tx-q2",
+		consumedEvent(t, 2, 1.5, 2, 2),
+		budgetEvent(t, model.EVENT_BUDGET_EXHAUSTED, model.BUDGET_EXHAUSTED, 2, 2),
+		queryEvent(t, 2, 1.5)))
+	return commit(t, src, tx("tx-revoke", budgetEvent(t, model.EVENT_BUDGET_REVOKED, model.BUDGET_REVOKED, 2, 2)))
+}
+
+// ---------------------------------------------------------------------------
+// Tests
+// ---------------------------------------------------------------------------
+
+func TestBudgetLifecycle(t *testing.T) {
+	src, store := NewMockSource("dt4hCC"), openStore(t)
+	stop := run(t, src, store, -1)
+	defer stop()
+
+	commit(t, src, tx("tx-init", budgetEvent(t, model.EVENT_BUDGET_INITIALIZED, model.BUDGET_ACTIVE, 2, 0)))
+	commit(t, src, tx("tx-q1", consumedEvent(t, 1, 0.5, 0.5, 2), queryEvent(t, 1, 0.5)))
+	waitFor(t, store, 2)
+	row := budget(t, store, testUser)
+	if row.Status != model.BUDGET_ACTIVE || row.ConsumedBudget != 0.5 || row.RemainingBudget != 1.5 || row.QueryCount != 1 {
+		t.Fatalf("after one charge: %+v", row)
+	}
+	if row.GrantedBy != testMSP || row.SubjectCommitment != testSubject {
+		t.Fatalf("granted_by=%q subject_commitment=%q", row.GrantedBy, row.SubjectCommitment)
+	}
+
+	commit(t, src, tx("tx-q2",
+		consumedEvent(t, 2, 1.5, 2, 2),
+		budgetEvent(t, model.EVENT_BUDGET_EXHAUSTED, model.BUDGET_EXHAUSTED, 2, 2),
+		queryEvent(t, 2, 1.5)))
+	waitFor(t, store, 3)
+	row = budget(t, store, testUser)
+	if row.Status != model.BUDGET_EXHAUSTED || row.RemainingBudget != 0 || row.QueryCount != 2 {
+		t.Fatalf("after exhaustion: %+v", row)
+	}
+
+	commit(t, src, tx("tx-revoke", budgetEvent(t, model.EVENT_BUDGET_REVOKED, model.BUDGET_REVOKED, 2, 2)))
+	waitFor(t, store, 4)
+	row = budget(t, store, testUser)
+	if row.Status != model.BUDGET_REVOKED || row.TxID != "tx-revoke" || row.BlockNumber != 4 || row.GrantedBy != testMSP {
+		t.Fatalf("after revocation: %+v", row)
+	}
+	if n := count(t, store, "consumption_logs", "user_id = ?", testUser); n != 2 {
+		t.Fatalf("consumption_logs = %d, want 2", n)
+	}
+	if n := count(t, store, "queries", "user_id = ?", testUser); n != 2 {
+		t.Fatalf("queries = %d, want 2", n)
+	}
+	if n := count(t, store, "events", "1 = 1"); n != 7 {
+		t.Fatalf("events = %d, want 7", n)
+	}
+}
+
+func TestRedeliveredTransactionIsAppliedOnce(t *testing.T) {
+	store := openStore(t)
+	envelope := tx("tx-q1", consumedEvent(t, 1, 0.5, 0.5, 2)).Envelope
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := &ChaincodeEvent{BlockNumber: 1, TxID: "tx-q1", ChaincodeName: "dt4hCC", EventName: model.BUDGET_EVENT_NAME, Payload: payload}
+
+	for i, want := range []bool{true, false} {
+		applied, err := store.ApplyChaincodeEvent(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied != want {
+			t.Fatalf("delivery %d: applied = %v, want %v", i+1, applied, want)
+		}
+	}
+	if row := budget(t, store, testUser); row.QueryCount != 1 || row.ConsumedBudget != 0.5 {
+		t.Fatalf("after re-delivery: %+v", row)
+	}
+	if n := count(t, store, "consumption_logs", "1 = 1"); n != 1 {
+		t.Fatalf("consumption_logs = %d, want 1", n)
+	}
+}
+
+func TestResumeFromCheckpoint(t *testing.T) {
+	src, store := NewMockSource("dt4hCC"), openStore(t)
+	stop := run(t, src, store, -1)
+	commit(t, src, tx("tx-init", budgetEvent(t, model.EVENT_BUDGET_INITIALIZED, model.BUDGET_ACTIVE, 2, 0)))
+	last := commit(t, src, tx("tx-q1", consumedEvent(t, 1, 0.5, 0.5, 2)))
+	waitFor(t, store, last)
+	stop()
+
+	// The chaincode event stream restarts at its checkpoint block, whose
+	// transactions were applied already; the block stream after it.
+	events, blocks, err := New(src, store).startBlocks(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events != last || blocks != last+1 {
+		t.Fatalf("startBlocks = %d, %d, want %d, %d", events, blocks, last, last+1)
+	}
+
+	last = commit(t, src, tx("tx-q2", consumedEvent(t, 2, 0.5, 1, 2)))
+	stop = run(t, src, store, -1)
+	defer stop()
+	waitFor(t, store, last)
+	if row := budget(t, store, testUser); row.QueryCount != 2 || row.ConsumedBudget != 1 || row.TxID != "tx-q2" {
+		t.Fatalf("after resuming: %+v", row)
+	}
+}
+
+func TestReplayAfterReset(t *testing.T) {
+	src, store := NewMockSource("dt4hCC"), openStore(t)
+	stop := run(t, src, store, -1)
+	last := lifecycle(t, src)
+	waitFor(t, store, last)
+	stop()
+	before := budget(t, store, testUser)
+
+	// Replaying over the existing model applies nothing twice.
+	stop = run(t, src, store, 0)
+	waitFor(t, store, last)
+	stop()
+	if row := budget(t, store, testUser); *row != *before {
+		t.Fatalf("after replay:\n got %+v\nwant %+v", row, before)
+	}
+
+	if err := store.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if row, err := store.Budget(testUser, testDataset); err != nil || row != nil {
+		t.Fatalf("after Reset: %+v, %v", row, err)
+	}
+	stop = run(t, src, store, 0)
+	defer stop()
+	waitFor(t, store, last)
+	if row := budget(t, store, testUser); *row != *before {
+		t.Fatalf("after rebuild:\n got %+v\nwant %+v", row, before)
+	}
+	if n := count(t, store, "consumption_logs", "1 = 1"); n != 2 {
+		t.Fatalf("consumption_logs = %d, want 2", n)
+	}
+}
+
+func TestRejectedTransactions(t *testing.T) {
+	src, store := NewMockSource("dt4hCC"), openStore(t)
+	stop := run(t, src, store, -1)
+	defer stop()
+
+	commit(t, src, tx("tx-init", budgetEvent(t, model.EVENT_BUDGET_INITIALIZED, model.BUDGET_ACTIVE, 2, 0)))
+	rejected := tx("tx-conflict", consumedEvent(t, 1, 0.5, 0.5, 2))
+	rejected.ValidationCode = "MVCC_READ_CONFLICT"
+	block := commit(t, src, rejected, &MockTx{TxID: "tx-silent", ValidationCode: "ENDORSEMENT_POLICY_FAILURE"})
+	// A block without valid transactions delivers no chaincode event, so its
+	// checkpoint moves with the next one.
+	last := commit(t, src, tx("tx-q1", consumedEvent(t, 1, 0.5, 0.5, 2)))
+	waitFor(t, store, last)
+
+	var code, chaincode, eventName string
+	var rejectedIn uint64
+	err := store.DB().QueryRow(`SELECT block_number, validation_code, chaincode_name, event_name
+		FROM rejected_transactions WHERE tx_id = ?`, "tx-conflict").Scan(&rejectedIn, &code, &chaincode, &eventName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejectedIn != block || code != "MVCC_READ_CONFLICT" || chaincode != "dt4hCC" || eventName != model.BUDGET_EVENT_NAME {
+		t.Fatalf("rejected tx: block=%d code=%s chaincode=%s event=%s", rejectedIn, code, chaincode, eventName)
+	}
+	if n := count(t, store, "rejected_transactions", "tx_id = ? AND event_name = ''", "tx-silent"); n != 1 {
+		t.Fatalf("transaction without event not recorded")
+	}
+	// Only the valid charge was applied.
+	if row := budget(t, store, testUser); row.QueryCount != 1 || row.ConsumedBudget != 0.5 {
+		t.Fatalf("rejected charge applied: %+v", row)
+	}
+	if n := count(t, store, "events", "tx_id = ?", "tx-conflict"); n != 0 {
+		t.Fatalf("events of the rejected transaction = %d, want 0", n)
+	}
+}
+
+func TestBudgetErased(t *testing.T) {
+	src, store := NewMockSource("dt4hCC"), openStore(t)
+	stop := run(t, src, store, -1)
+	defer stop()
+
+	lifecycle(t, src)
+	revoked := budgetEvent(t, model.EVENT_BUDGET_REVOKED, model.BUDGET_REVOKED, 2, 2)
+	var p model.BudgetEventPayload
+	if err := json.Unmarshal(revoked.Payload, &p); err != nil {
+		t.Fatal(err)
+	}
+	p.UserID, p.StatusReason = testPseudo, "ERASURE"
+	last := commit(t, src, tx("tx-erase",
+		event(t, model.EVENT_BUDGET_ERASED, &model.BudgetErasedPayload{
+			DatasetID:         testDataset,
+			SubjectCommitment: testSubject,
+			Pseudonym:         testPseudo,
+		}),
+		event(t, model.EVENT_BUDGET_REVOKED, &p)))
+	waitFor(t, store, last)
+
+	if row, err := store.Budget(testUser, testDataset); err != nil || row != nil {
+		t.Fatalf("erased user's budget still present: %+v, %v", row, err)
+	}
+	row := budget(t, store, testPseudo)
+	if row.GrantedBy != testMSP || row.QueryCount != 2 || row.StatusReason != "ERASURE" || row.SubjectCommitment != testSubject {
+		t.Fatalf("pseudonymised budget: %+v", row)
+	}
+	for _, table := range []string{"budgets", "consumption_logs", "queries", "warnings"} {
+		if n := count(t, store, table, "user_id = ?", testUser); n != 0 {
+			t.Fatalf("%s still has %d rows of the erased user", table, n)
+		}
+	}
+	if n := count(t, store, "consumption_logs", "user_id = ?", testPseudo); n != 2 {
+		t.Fatalf("consumption_logs of the pseudonym = %d, want 2", n)
+	}
+	if n := count(t, store, "events", "payload LIKE ?", "%"+testUser+"%"); n != 0 {
+		t.Fatalf("%d event payloads still name the erased user", n)
+	}
+}
+
+func TestBudgetErasedWithoutCommitment(t *testing.T) {
+	src, store := NewMockSource("dt4hCC"), openStore(t)
+	stop := run(t, src, store, -1)
+	defer stop()
+
+	// A budget last written before it had a commitment.
+	legacy := budgetEvent(t, model.EVENT_BUDGET_INITIALIZED, model.BUDGET_ACTIVE, 2, 0)
+	var p model.BudgetEventPayload
+	if err := json.Unmarshal(legacy.Payload, &p); err != nil {
+		t.Fatal(err)
+	}
+	p.SubjectCommitment = ""
+	commit(t, src, tx("tx-init", event(t, model.EVENT_BUDGET_INITIALIZED, &p)))
+	last := commit(t, src, tx("tx-erase", event(t, model.EVENT_BUDGET_ERASED, &model.BudgetErasedPayload{
+		DatasetID: testDataset,
+		Pseudonym: testPseudo,
+	})))
+	waitFor(t, store, last)
+	budget(t, store, testUser)
+
+	if err := store.EraseUser(testUser); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"budgets", "consumption_logs", "queries", "warnings"} {
+		if n := count(t, store, table, "user_id = ?", testUser); n != 0 {
+			t.Fatalf("%s still has %d rows of the erased user", table, n)
+		}
+	}
+	if n := count(t, store, "events", "json_extract(payload, '$.userId') = ?", testUser); n != 0 {
+		t.Fatalf("%d event payloads still name the erased user", n)
+	}
+}
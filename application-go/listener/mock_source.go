@@ -0,0 +1,146 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/chaincode/dt4hCC/model"
+)
+
+// ---------------------------------------------------------------------------
+// Mock source
+// ---------------------------------------------------------------------------
+
+// MockTx is a transaction committed to a MockSource. A nil Envelope means
+// the transaction emitted no event; an empty ValidationCode means VALID.
+type MockTx struct {
+	TxID           string
+	ValidationCode string
+	Envelope       *model.EventEnvelope
+}
+
+// MockSource is an in-memory channel for running the listener without a
+// network. Commit appends a block; subscribers receive every block from
+// their start block on, including those committed after they subscribed.
+// Like a peer, it delivers chaincode events of valid transactions only.
+type MockSource struct {
+	Chaincode string
+
+	mu      sync.Mutex
+	blocks  []*Block
+	events  [][]*ChaincodeEvent // per block
+	updated chan struct{}       // closed and replaced on every commit
+}
+
+// NewMockSource returns an empty channel whose genesis block is block 0, so
+// the first Commit produces block 1.
+func NewMockSource(chaincode string) *MockSource {
+	return &MockSource{
+		Chaincode: chaincode,
+		blocks:    []*Block{{Number: 0}},
+		events:    [][]*ChaincodeEvent{nil},
+		updated:   make(chan struct{}),
+	}
+}
+
+// Commit appends a block holding txs and returns its number.
+func (m *MockSource) Commit(txs ...*MockTx) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	block := &Block{Number: uint64(len(m.blocks))}
+	var events []*ChaincodeEvent
+	for _, mtx := range txs {
+		tx := &Transaction{TxID: mtx.TxID, ValidationCode: mtx.ValidationCode}
+		if tx.ValidationCode == "" {
+			tx.ValidationCode = VALID_TX
+		}
+		if mtx.Envelope != nil {
+			tx.ChaincodeName = m.Chaincode
+			tx.EventName = model.BUDGET_EVENT_NAME
+			if tx.ValidationCode == VALID_TX {
+				payload, err := json.Marshal(mtx.Envelope)
+				if err != nil {
+					return 0, fmt.Errorf("Commit: marshal error: %v", err)
+				}
+				events = append(events, &ChaincodeEvent{
+					BlockNumber:   block.Number,
+					TxID:          mtx.TxID,
+					ChaincodeName: m.Chaincode,
+					EventName:     model.BUDGET_EVENT_NAME,
+					Payload:       payload,
+				})
+			}
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+
+	m.blocks = append(m.blocks, block)
+	m.events = append(m.events, events)
+	close(m.updated)
+	m.updated = make(chan struct{})
+	return block.Number, nil
+}
+
+// Height returns the number of blocks, the genesis block included.
+func (m *MockSource) Height() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return uint64(len(m.blocks))
+}
+
+// ChaincodeEvents implements Source.
+func (m *MockSource) ChaincodeEvents(ctx context.Context, startBlock uint64) (<-chan *ChaincodeEvent, error) {
+	out := make(chan *ChaincodeEvent)
+	go m.follow(ctx, startBlock, func(_ *Block, events []*ChaincodeEvent) bool {
+		for _, e := range events {
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}, func() { close(out) })
+	return out, nil
+}
+
+// Blocks implements Source.
+func (m *MockSource) Blocks(ctx context.Context, startBlock uint64) (<-chan *Block, error) {
+	out := make(chan *Block)
+	go m.follow(ctx, startBlock, func(b *Block, _ []*ChaincodeEvent) bool {
+		select {
+		case out <- b:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}, func() { close(out) })
+	return out, nil
+}
+
+// follow calls deliver for every block from next on, waiting for new
+// commits, until ctx is cancelled or deliver returns false. Committed blocks
+// are never modified, so they are delivered outside the lock.
+func (m *MockSource) follow(ctx context.Context, next uint64, deliver func(*Block, []*ChaincodeEvent) bool, done func()) {
+	defer done()
+	for {
+		m.mu.Lock()
+		blocks, events := m.blocks, m.events
+		updated := m.updated
+		m.mu.Unlock()
+
+		for ; next < uint64(len(blocks)); next++ {
+			if !deliver(blocks[next], events[next]) {
+				return
+			}
+		}
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+// ============================================================================
+// Event sources – where the listener reads the channel from
+// ============================================================================
+
+// ChaincodeEvent is a chaincode event of a committed, valid transaction.
+type ChaincodeEvent struct {
+	BlockNumber   uint64
+	TxID          string
+	ChaincodeName string
+	EventName     string
+	Payload       []byte
+}
+
+// Block lists the transactions of a committed block with their validation
+// result.
+type Block struct {
+	Number       uint64
+	Transactions []*Transaction
+}
+
+// Transaction is one transaction of a Block. ChaincodeName and EventName are
+// set when the transaction emitted a chaincode event.
+type Transaction struct {
+	TxID           string
+	ValidationCode string // peer.TxValidationCode name, VALID when committed
+	ChaincodeName  string
+	EventName      string
+}
+
+// VALID_TX is the validation code of a transaction that was committed.
+const VALID_TX = "VALID"
+
+// Source delivers the events of one channel, starting at a block. Both
+// channels are closed when ctx is cancelled or the source fails.
+type Source interface {
+	ChaincodeEvents(ctx context.Context, startBlock uint64) (<-chan *ChaincodeEvent, error)
+	Blocks(ctx context.Context, startBlock uint64) (<-chan *Block, error)
+}
+
+// ---------------------------------------------------------------------------
+// Gateway source
+// ---------------------------------------------------------------------------
+
+// GatewaySource reads events from a peer through the Fabric Gateway.
+// Chaincode events are those of one chaincode; blocks are filtered blocks,
+// which carry validation codes but no payloads.
+type GatewaySource struct {
+	Network   *client.Network
+	Chaincode string
+}
+
+// NewGatewaySource returns a source for the chaincode on the network.
+func NewGatewaySource(network *client.Network, chaincode string) *GatewaySource {
+	return &GatewaySource{Network: network, Chaincode: chaincode}
+}
+
+// ChaincodeEvents implements Source.
+func (s *GatewaySource) ChaincodeEvents(ctx context.Context, startBlock uint64) (<-chan *ChaincodeEvent, error) {
+	events, err := s.Network.ChaincodeEvents(ctx, s.Chaincode, client.WithStartBlock(startBlock))
+	if err != nil {
+		return nil, fmt.Errorf("ChaincodeEvents: %v", err)
+	}
+	out := make(chan *ChaincodeEvent)
+	go func() {
+		defer close(out)
+		for e := range events {
+			ev := &ChaincodeEvent{
+				BlockNumber:   e.BlockNumber,
+				TxID:          e.TransactionID,
+				ChaincodeName: e.ChaincodeName,
+				EventName:     e.EventName,
+				Payload:       e.Payload,
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Blocks implements Source.
+func (s *GatewaySource) Blocks(ctx context.Context, startBlock uint64) (<-chan *Block, error) {
+	blocks, err := s.Network.FilteredBlockEvents(ctx, client.WithStartBlock(startBlock))
+	if err != nil {
+		return nil, fmt.Errorf("Blocks: %v", err)
+	}
+	out := make(chan *Block)
+	go func() {
+		defer close(out)
+		for b := range blocks {
+			select {
+			case out <- filteredBlock(b):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// filteredBlock converts a filtered block delivered by the peer.
+func filteredBlock(b *peer.FilteredBlock) *Block {
+	block := &Block{Number: b.GetNumber()}
+	for _, ftx := range b.GetFilteredTransactions() {
+		tx := &Transaction{
+			TxID:           ftx.GetTxid(),
+			ValidationCode: ftx.GetTxValidationCode().String(),
+		}
+		for _, action := range ftx.GetTransactionActions().GetChaincodeActions() {
+			if e := action.GetChaincodeEvent(); e != nil {
+				tx.ChaincodeName = e.GetChaincodeId()
+				tx.EventName = e.GetEventName()
+			}
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+	return block
+}
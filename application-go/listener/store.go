@@ -0,0 +1,551 @@
+package listener
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/chaincode/dt4hCC/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ============================================================================
+// Read model – SQL tables materialised from the event stream
+// ============================================================================
+//
+// Every chaincode event is applied in one SQL transaction together with the
+// checkpoint of its stream, so the read model and the checkpoint never
+// disagree. The events table remembers the transactions already applied,
+// which makes replaying a range of blocks harmless.
+
+// Checkpoint streams.
+const (
+	STREAM_CHAINCODE_EVENTS = "chaincode"
+	STREAM_BLOCKS           = "blocks"
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS checkpoints (
+		stream       TEXT PRIMARY KEY,
+		block_number INTEGER NOT NULL,
+		tx_id        TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS events (
+		tx_id        TEXT NOT NULL,
+		idx          INTEGER NOT NULL,
+		block_number INTEGER NOT NULL,
+		type         TEXT NOT NULL,
+		version      INTEGER NOT NULL,
+		msp_id       TEXT NOT NULL,
+		timestamp    TEXT NOT NULL,
+		payload      TEXT NOT NULL,
+		PRIMARY KEY (tx_id, idx)
+	)`,
+	`CREATE TABLE IF NOT EXISTS budgets (
+		user_id          TEXT NOT NULL,
+		dataset_id       TEXT NOT NULL,
+		status           TEXT NOT NULL,
+		status_reason    TEXT NOT NULL DEFAULT '',
+		total_budget     REAL NOT NULL,
+		consumed_budget  REAL NOT NULL,
+		remaining_budget REAL NOT NULL,
+		agreement_id     TEXT NOT NULL DEFAULT '',
+		warning_level    REAL NOT NULL DEFAULT 0,
+		query_count      INTEGER NOT NULL DEFAULT 0,
+		granted_by       TEXT NOT NULL DEFAULT '',
+		subject_commitment TEXT NOT NULL DEFAULT '',
+		updated_by       TEXT NOT NULL,
+		updated_at       TEXT NOT NULL,
+		block_number     INTEGER NOT NULL,
+		tx_id            TEXT NOT NULL,
+		PRIMARY KEY (user_id, dataset_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS consumption_logs (
+		user_id          TEXT NOT NULL,
+		dataset_id       TEXT NOT NULL,
+		sequence         INTEGER NOT NULL,
+		purpose          TEXT NOT NULL,
+		epsilon_used     REAL NOT NULL,
+		consumed_budget  REAL NOT NULL,
+		remaining_budget REAL NOT NULL,
+		log_hash         TEXT NOT NULL,
+		msp_id           TEXT NOT NULL,
+		timestamp        TEXT NOT NULL,
+		block_number     INTEGER NOT NULL,
+		tx_id            TEXT NOT NULL,
+		PRIMARY KEY (user_id, dataset_id, sequence)
+	)`,
+	`CREATE TABLE IF NOT EXISTS queries (
+		tx_id        TEXT PRIMARY KEY,
+		user_id      TEXT NOT NULL,
+		dataset_id   TEXT NOT NULL,
+		purpose      TEXT NOT NULL,
+		epsilon_used REAL NOT NULL,
+		query_digest TEXT NOT NULL,
+		sequence     INTEGER NOT NULL,
+		msp_id       TEXT NOT NULL,
+		timestamp    TEXT NOT NULL,
+		block_number INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS warnings (
+		user_id          TEXT NOT NULL,
+		dataset_id       TEXT NOT NULL,
+		threshold        REAL NOT NULL,
+		consumed_percent REAL NOT NULL,
+		timestamp        TEXT NOT NULL,
+		tx_id            TEXT NOT NULL,
+		PRIMARY KEY (user_id, dataset_id, threshold, tx_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS rejected_transactions (
+		tx_id           TEXT PRIMARY KEY,
+		block_number    INTEGER NOT NULL,
+		validation_code TEXT NOT NULL,
+		chaincode_name  TEXT NOT NULL,
+		event_name      TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS budgets_by_dataset ON budgets (dataset_id)`,
+	`CREATE INDEX IF NOT EXISTS queries_by_dataset ON queries (dataset_id, timestamp)`,
+}
+
+// addedColumns are columns added to tables after their creation, added to
+// read models created before them. Their rows get the column default until
+// the read model is rebuilt.
+var addedColumns = []struct{ table, column, definition string }{
+	{"budgets", "granted_by", `TEXT NOT NULL DEFAULT ''`},
+	{"budgets", "subject_commitment", `TEXT NOT NULL DEFAULT ''`},
+}
+
+// readModelTables are the tables Reset empties, checkpoints included.
+var readModelTables = []string{
+	"checkpoints", "events", "budgets", "consumption_logs", "queries", "warnings", "rejected_transactions",
+}
+
+// BudgetRow is a budget as materialised in the read model.
+type BudgetRow struct {
+	UserID          string
+	DatasetID       string
+	Status          string
+	StatusReason    string
+	TotalBudget     float64
+	ConsumedBudget  float64
+	RemainingBudget float64
+	AgreementID     string
+	WarningLevel    float64
+	QueryCount      int    // charges applied by the listener
+	GrantedBy       string // MSP that initialised the budget
+	// SubjectCommitment identifies the budget in BudgetErased events; empty
+	// until an event of the budget carried it.
+	SubjectCommitment string
+	UpdatedBy         string // MSP of the latest change
+	UpdatedAt         string
+	BlockNumber       uint64
+	TxID              string
+}
+
+// Store is the SQL read model.
+type Store struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens (creating if needed) a SQLite read model; ":memory:"
+// gives a private in-memory database. The write-ahead log lets other
+// processes, such as the exporter, read while the listener writes.
+func OpenSQLite(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("OpenSQLite: %v", err)
+	}
+	// One connection: an in-memory database exists per connection, and the
+	// listener is the only writer.
+	db.SetMaxOpenConns(1)
+	store, err := NewStore(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("OpenSQLite: %v", err)
+	}
+	return store, nil
+}
+
+// NewStore creates the read model tables in db if they do not exist, and
+// adds the columns missing from older ones.
+func NewStore(db *sql.DB) (*Store, error) {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("NewStore: schema error: %v", err)
+		}
+	}
+	for _, c := range addedColumns {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&n); err != nil {
+			return nil, fmt.Errorf("NewStore: schema error: %v", err)
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE ` + c.table + ` ADD COLUMN ` + c.column + ` ` + c.definition); err != nil {
+			return nil, fmt.Errorf("NewStore: schema error: %v", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// DB returns the underlying database for read-only queries.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Checkpoint returns the position of a stream: the block and transaction
+// last applied. ok is false when nothing has been applied yet.
+func (s *Store) Checkpoint(stream string) (block uint64, txID string, ok bool, err error) {
+	err = s.db.QueryRow(`SELECT block_number, tx_id FROM checkpoints WHERE stream = ?`, stream).Scan(&block, &txID)
+	if err == sql.ErrNoRows {
+		return 0, "", false, nil
+	}
+	if err != nil {
+		return 0, "", false, fmt.Errorf("Checkpoint: %v", err)
+	}
+	return block, txID, true, nil
+}
+
+// ApplyChaincodeEvent applies the EventEnvelope carried by a chaincode
+// event and advances the chaincode event checkpoint. Events of other names
+// only advance the checkpoint. applied is false when the transaction had
+// already been applied.
+func (s *Store) ApplyChaincodeEvent(ev *ChaincodeEvent) (applied bool, err error) {
+	method := "ApplyChaincodeEvent"
+
+	var envelope model.EventEnvelope
+	if ev.EventName == model.BUDGET_EVENT_NAME {
+		if err := json.Unmarshal(ev.Payload, &envelope); err != nil {
+			return false, fmt.Errorf("%s: tx %s: unmarshal error: %v", method, ev.TxID, err)
+		}
+		if envelope.SchemaVersion > model.EVENT_ENVELOPE_VERSION {
+			return false, fmt.Errorf("%s: tx %s: envelope version %d is newer than %d",
+				method, ev.TxID, envelope.SchemaVersion, model.EVENT_ENVELOPE_VERSION)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", method, err)
+	}
+	defer tx.Rollback()
+
+	if len(envelope.Events) > 0 {
+		var seen int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM events WHERE tx_id = ?`, ev.TxID).Scan(&seen); err != nil {
+			return false, fmt.Errorf("%s: %v", method, err)
+		}
+		if seen == 0 {
+			for i, e := range envelope.Events {
+				if err := applyEvent(tx, ev, &envelope, i, e); err != nil {
+					return false, fmt.Errorf("%s: tx %s: %v", method, ev.TxID, err)
+				}
+			}
+			applied = true
+		}
+	}
+	if err := putCheckpoint(tx, STREAM_CHAINCODE_EVENTS, ev.BlockNumber, ev.TxID); err != nil {
+		return false, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("%s: %v", method, err)
+	}
+	return applied, nil
+}
+
+// ApplyBlock records the transactions of a block that failed validation,
+// such as MVCC read conflicts, and advances the block checkpoint.
+func (s *Store) ApplyBlock(b *Block) error {
+	method := "ApplyBlock"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	defer tx.Rollback()
+
+	for _, t := range b.Transactions {
+		if t.ValidationCode == VALID_TX {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO rejected_transactions
+			(tx_id, block_number, validation_code, chaincode_name, event_name) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (tx_id) DO NOTHING`,
+			t.TxID, b.Number, t.ValidationCode, t.ChaincodeName, t.EventName); err != nil {
+			return fmt.Errorf("%s: %v", method, err)
+		}
+	}
+	if err := putCheckpoint(tx, STREAM_BLOCKS, b.Number, ""); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	return nil
+}
+
+// Reset empties the read model and its checkpoints, so the next run
+// rebuilds it from the block it is started at.
+func (s *Store) Reset() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Reset: %v", err)
+	}
+	defer tx.Rollback()
+	for _, table := range readModelTables {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return fmt.Errorf("Reset: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// EraseUser deletes the rows of a user. The BudgetErased events of
+// EraseUserRecords move a budget's rows to its pseudonym by the budget's
+// subject commitment, which budgets last written before chaincode schema v9
+// do not have. The operator calls this with the ID of the erasure request
+// for those. Replaying blocks from before the erasure brings their rows
+// back.
+func (s *Store) EraseUser(userID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("EraseUser: %v", err)
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"budgets", "consumption_logs", "queries", "warnings"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("EraseUser: %v", err)
+		}
+	}
+	// Event payloads carry the user ID too.
+	if _, err := tx.Exec(`DELETE FROM events WHERE json_extract(payload, '$.userId') = ?`, userID); err != nil {
+		return fmt.Errorf("EraseUser: %v", err)
+	}
+	return tx.Commit()
+}
+
+// Budget returns a budget, or nil if the read model has none.
+func (s *Store) Budget(userID, datasetID string) (*BudgetRow, error) {
+	rows, err := s.queryBudgets(`WHERE user_id = ? AND dataset_id = ?`, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("Budget: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows[0], nil
+}
+
+// Budgets returns the budgets of a dataset, or of every dataset when
+// datasetID is empty, ordered by dataset and user.
+func (s *Store) Budgets(datasetID string) ([]*BudgetRow, error) {
+	var rows []*BudgetRow
+	var err error
+	if datasetID == "" {
+		rows, err = s.queryBudgets(``)
+	} else {
+		rows, err = s.queryBudgets(`WHERE dataset_id = ?`, datasetID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Budgets: %v", err)
+	}
+	return rows, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// queryBudgets selects budgets with the given WHERE clause.
+func (s *Store) queryBudgets(where string, args ...any) ([]*BudgetRow, error) {
+	rows, err := s.db.Query(`SELECT user_id, dataset_id, status, status_reason, total_budget,
+		consumed_budget, remaining_budget, agreement_id, warning_level, query_count,
+		granted_by, subject_commitment, updated_by, updated_at, block_number, tx_id
+		FROM budgets `+where+` ORDER BY dataset_id, user_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*BudgetRow{}
+	for rows.Next() {
+		b := &BudgetRow{}
+		if err := rows.Scan(&b.UserID, &b.DatasetID, &b.Status, &b.StatusReason, &b.TotalBudget,
+			&b.ConsumedBudget, &b.RemainingBudget, &b.AgreementID, &b.WarningLevel, &b.QueryCount,
+			&b.GrantedBy, &b.SubjectCommitment, &b.UpdatedBy, &b.UpdatedAt, &b.BlockNumber, &b.TxID); err != nil {
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	return result, rows.Err()
+}
+
+// putCheckpoint records the position of a stream.
+func putCheckpoint(tx *sql.Tx, stream string, block uint64, txID string) error {
+	_, err := tx.Exec(`INSERT INTO checkpoints (stream, block_number, tx_id) VALUES (?, ?, ?)
+		ON CONFLICT (stream) DO UPDATE SET block_number = excluded.block_number, tx_id = excluded.tx_id`,
+		stream, block, txID)
+	return err
+}
+
+// applyEvent stores one event of an envelope and updates the tables it
+// affects. Unknown event types are stored but otherwise ignored, so an
+// older listener keeps up with a newer chaincode.
+func applyEvent(tx *sql.Tx, ev *ChaincodeEvent, envelope *model.EventEnvelope, idx int, e *model.ChaincodeEvent) error {
+	if _, err := tx.Exec(`INSERT INTO events
+		(tx_id, idx, block_number, type, version, msp_id, timestamp, payload) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		ev.TxID, idx, ev.BlockNumber, e.Type, e.Version, envelope.MspID, envelope.Timestamp, string(e.Payload)); err != nil {
+		return fmt.Errorf("applyEvent: %v", err)
+	}
+	if e.Version > model.EVENT_PAYLOAD_VERSION {
+		return fmt.Errorf("applyEvent: %s payload version %d is newer than %d", e.Type, e.Version, model.EVENT_PAYLOAD_VERSION)
+	}
+
+	switch e.Type {
+	case model.EVENT_BUDGET_INITIALIZED, model.EVENT_BUDGET_UPDATED, model.EVENT_BUDGET_SUSPENDED,
+		model.EVENT_BUDGET_RESUMED, model.EVENT_BUDGET_REVOKED, model.EVENT_BUDGET_EXHAUSTED:
+		var p model.BudgetEventPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+		grantedBy := ""
+		if e.Type == model.EVENT_BUDGET_INITIALIZED {
+			grantedBy = envelope.MspID
+		}
+		_, err := tx.Exec(`INSERT INTO budgets
+			(user_id, dataset_id, status, status_reason, total_budget, consumed_budget, remaining_budget,
+			 agreement_id, warning_level, granted_by, subject_commitment, updated_by, updated_at, block_number, tx_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, dataset_id) DO UPDATE SET
+			 status = excluded.status, status_reason = excluded.status_reason,
+			 total_budget = excluded.total_budget, consumed_budget = excluded.consumed_budget,
+			 remaining_budget = excluded.remaining_budget, agreement_id = excluded.agreement_id,
+			 warning_level = excluded.warning_level,
+			 granted_by = CASE WHEN excluded.granted_by != '' THEN excluded.granted_by ELSE budgets.granted_by END,
+			 subject_commitment = CASE WHEN excluded.subject_commitment != ''
+			  THEN excluded.subject_commitment ELSE budgets.subject_commitment END,
+			 updated_by = excluded.updated_by, updated_at = excluded.updated_at,
+			 block_number = excluded.block_number, tx_id = excluded.tx_id`,
+			p.UserID, p.DatasetID, p.Status, p.StatusReason, p.TotalBudget, p.ConsumedBudget, p.RemainingBudget,
+			p.AgreementID, p.WarningLevel, grantedBy, p.SubjectCommitment, envelope.MspID, envelope.Timestamp, ev.BlockNumber, ev.TxID)
+		if err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+
+	case model.EVENT_BUDGET_CONSUMED:
+		var p model.BudgetConsumedPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO consumption_logs
+			(user_id, dataset_id, sequence, purpose, epsilon_used, consumed_budget, remaining_budget,
+			 log_hash, msp_id, timestamp, block_number, tx_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, dataset_id, sequence) DO NOTHING`,
+			p.UserID, p.DatasetID, p.Sequence, p.Purpose, p.EpsilonUsed, p.ConsumedBudget, p.RemainingBudget,
+			p.LogHash, envelope.MspID, envelope.Timestamp, ev.BlockNumber, ev.TxID); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+		// Consumption needs an Active budget; a budget first seen here was
+		// initialised before the block the listener started at.
+		_, err := tx.Exec(`INSERT INTO budgets
+			(user_id, dataset_id, status, total_budget, consumed_budget, remaining_budget,
+			 query_count, subject_commitment, updated_by, updated_at, block_number, tx_id)
+			VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, dataset_id) DO UPDATE SET
+			 consumed_budget = excluded.consumed_budget, remaining_budget = excluded.remaining_budget,
+			 query_count = budgets.query_count + 1,
+			 subject_commitment = CASE WHEN excluded.subject_commitment != ''
+			  THEN excluded.subject_commitment ELSE budgets.subject_commitment END,
+			 updated_by = excluded.updated_by, updated_at = excluded.updated_at,
+			 block_number = excluded.block_number, tx_id = excluded.tx_id`,
+			p.UserID, p.DatasetID, model.BUDGET_ACTIVE, p.ConsumedBudget+p.RemainingBudget,
+			p.ConsumedBudget, p.RemainingBudget, p.SubjectCommitment, envelope.MspID, envelope.Timestamp, ev.BlockNumber, ev.TxID)
+		if err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+
+	case model.EVENT_THRESHOLD_CROSSED:
+		var p model.ThresholdCrossedPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO warnings
+			(user_id, dataset_id, threshold, consumed_percent, timestamp, tx_id) VALUES (?, ?, ?, ?, ?, ?)`,
+			p.UserID, p.DatasetID, p.Threshold, p.ConsumedPercent, envelope.Timestamp, ev.TxID); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+		if _, err := tx.Exec(`UPDATE budgets SET warning_level = MAX(warning_level, ?)
+			WHERE user_id = ? AND dataset_id = ?`, p.Threshold, p.UserID, p.DatasetID); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+
+	case model.EVENT_BUDGET_ERASED:
+		var p model.BudgetErasedPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+		if err := pseudonymise(tx, &p); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+
+	case model.EVENT_QUERY_LOGGED:
+		var p model.QueryLoggedPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO queries
+			(tx_id, user_id, dataset_id, purpose, epsilon_used, query_digest, sequence, msp_id, timestamp, block_number)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (tx_id) DO NOTHING`,
+			ev.TxID, p.UserID, p.DatasetID, p.Purpose, p.EpsilonUsed, p.QueryDigest, p.Sequence,
+			envelope.MspID, envelope.Timestamp, ev.BlockNumber); err != nil {
+			return fmt.Errorf("applyEvent: %s: %v", e.Type, err)
+		}
+	}
+	return nil
+}
+
+// pseudonymise moves the rows of an erased budget to its pseudonym, as
+// EraseUserRecords does on the ledger: the budget, with the MSP that granted
+// it, its consumption logs and warnings are renamed and its queries, whose
+// logs the erasure deletes, are dropped. Stored event payloads are renamed
+// too, so no row keeps the erased user ID. The budget is found by its
+// subject commitment; one the listener never saw with a commitment is left
+// for EraseUser.
+func pseudonymise(tx *sql.Tx, p *model.BudgetErasedPayload) error {
+	if p.SubjectCommitment == "" {
+		return nil
+	}
+	var userID string
+	err := tx.QueryRow(`SELECT user_id FROM budgets WHERE dataset_id = ? AND subject_commitment = ?`,
+		p.DatasetID, p.SubjectCommitment).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("pseudonymise: %v", err)
+	}
+
+	for _, table := range []string{"budgets", "consumption_logs", "warnings"} {
+		if _, err := tx.Exec(`UPDATE OR REPLACE `+table+` SET user_id = ? WHERE user_id = ? AND dataset_id = ?`,
+			p.Pseudonym, userID, p.DatasetID); err != nil {
+			return fmt.Errorf("pseudonymise: %v", err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM queries WHERE user_id = ? AND dataset_id = ?`, userID, p.DatasetID); err != nil {
+		return fmt.Errorf("pseudonymise: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE events SET payload = json_set(payload, '$.userId', ?)
+		WHERE json_extract(payload, '$.userId') = ? AND json_extract(payload, '$.datasetId') = ?`,
+		p.Pseudonym, userID, p.DatasetID); err != nil {
+		return fmt.Errorf("pseudonymise: %v", err)
+	}
+	return nil
+}
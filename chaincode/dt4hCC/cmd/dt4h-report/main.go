@@ -0,0 +1,286 @@
+// Command dt4h-report turns an audit report returned by the GetAuditReport
+// chaincode query into files for a regulator: the report as JSON, its
+// budgets, consumption entries and administrative actions as CSV, and
+// optionally a detached signature over the JSON.
+//
+// The report is checked before anything is written: every chained entry
+// must match its recorded hash, the totals and per-purpose and per-MSP
+// figures must add up, and the report must reproduce its Merkle root. That
+// root is carried by the report itself, so it only shows the report is
+// consistent. With -root, the recomputed root must also equal a root
+// obtained independently, e.g. by running the same report on a peer of
+// another organisation, which shows the report is what the ledger holds.
+//
+// Usage:
+//
+//	peer chaincode query -C dt4h -n dt4hCC \
+//	  -c '{"function":"PrivacyBudgetContract:GetAuditReport","Args":["dataset","ds-cardio-2025","2025-01-01T00:00:00Z","2025-07-01T00:00:00Z"]}' \
+//	  | dt4h-report -out ./audit-2025H1 -key org1-signer.pem -root 19bcb4…
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/chaincode/dt4hCC/logchain"
+	"github.com/chaincode/dt4hCC/model"
+)
+
+func main() {
+	in := flag.String("in", "-", "audit report JSON, or - for stdin")
+	out := flag.String("out", ".", "directory to write the report files to")
+	keyFile := flag.String("key", "", "PEM PKCS#8 ECDSA or Ed25519 private key to sign report.json with (optional)")
+	root := flag.String("root", "", "Merkle root of the same report obtained from a trusted peer (optional)")
+	flag.Parse()
+	log.SetFlags(0)
+
+	report, err := readReport(*in)
+	if err != nil {
+		log.Fatalf("dt4h-report: %v", err)
+	}
+	if err := verifyReport(report, *root); err != nil {
+		log.Fatalf("dt4h-report: report does not verify: %v", err)
+	}
+	if *root == "" {
+		log.Printf("dt4h-report: warning: merkle root not compared with the ledger, pass -root to check it")
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("dt4h-report: %v", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatalf("dt4h-report: marshal error: %v", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(filepath.Join(*out, "report.json"), data, 0o644); err != nil {
+		log.Fatalf("dt4h-report: %v", err)
+	}
+	for name, rows := range map[string][][]string{
+		"budgets.csv":       budgetRows(report),
+		"entries.csv":       entryRows(report),
+		"admin_actions.csv": actionRows(report),
+	} {
+		if err := writeCSV(filepath.Join(*out, name), rows); err != nil {
+			log.Fatalf("dt4h-report: %v", err)
+		}
+	}
+
+	if *keyFile != "" {
+		sig, err := sign(*keyFile, data)
+		if err != nil {
+			log.Fatalf("dt4h-report: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(*out, "report.json.sig"), sig, 0o644); err != nil {
+			log.Fatalf("dt4h-report: %v", err)
+		}
+	}
+
+	log.Printf("dt4h-report: %s %s %s..%s: %d budgets, %d entries, %d admin actions, merkle root %s",
+		report.Scope, report.ScopeID, report.From, report.To,
+		len(report.Budgets), len(report.Entries), len(report.AdminActions), report.MerkleRoot)
+}
+
+// readReport decodes an audit report from a file or stdin.
+func readReport(path string) (*model.AuditReport, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	report := new(model.AuditReport)
+	if err := json.NewDecoder(r).Decode(report); err != nil {
+		return nil, fmt.Errorf("invalid report JSON: %v", err)
+	}
+	return report, nil
+}
+
+// verifyReport recomputes the hash of every chained entry, the figures
+// derived from the budgets and entries, and the Merkle root. Entries logged
+// before hash chaining carry no hash and are covered by the root only. A
+// non-empty trustedRoot must equal the recomputed root.
+func verifyReport(report *model.AuditReport, trustedRoot string) error {
+	for i, entry := range report.Entries {
+		if entry.Hash == "" {
+			continue
+		}
+		hash, err := logchain.Hash(entry)
+		if err != nil {
+			return err
+		}
+		if hash != entry.Hash {
+			return fmt.Errorf("entry %d (user %s, dataset %s, sequence %d) does not match its hash",
+				i, entry.UserID, entry.DatasetID, entry.Sequence)
+		}
+	}
+	if err := verifyFigures(report); err != nil {
+		return err
+	}
+	root, err := logchain.AuditRoot(report)
+	if err != nil {
+		return err
+	}
+	if root != report.MerkleRoot {
+		return fmt.Errorf("merkle root is %q, report says %q", root, report.MerkleRoot)
+	}
+	if trustedRoot != "" && root != trustedRoot {
+		return fmt.Errorf("merkle root is %q, the ledger's is %q", root, trustedRoot)
+	}
+	return nil
+}
+
+// verifyFigures recomputes the totals, the budget lines' period figures and
+// the per-purpose and per-MSP usage, which the Merkle root does not cover,
+// summing in report order as GetAuditReport does.
+func verifyFigures(report *model.AuditReport) error {
+	var totals model.AuditTotals
+	lines := map[string]*model.AuditBudgetLine{}
+	for _, b := range report.Budgets {
+		totals.BudgetCount++
+		totals.EpsilonAllocated += b.TotalBudget
+		totals.EpsilonConsumed += b.ConsumedBudget
+		lines[b.UserID+"\x00"+b.DatasetID] = &model.AuditBudgetLine{}
+	}
+	byPurpose := map[string]*model.PurposeUsage{}
+	byMSP := map[string]*model.MSPUsage{}
+	for _, e := range report.Entries {
+		totals.PeriodQueries++
+		totals.PeriodEpsilon += e.EpsilonUsed
+		if line := lines[e.UserID+"\x00"+e.DatasetID]; line != nil {
+			line.PeriodQueries++
+			line.PeriodEpsilon += e.EpsilonUsed
+		}
+		if byPurpose[e.Purpose] == nil {
+			byPurpose[e.Purpose] = &model.PurposeUsage{Purpose: e.Purpose}
+		}
+		byPurpose[e.Purpose].QueryCount++
+		byPurpose[e.Purpose].EpsilonConsumed += e.EpsilonUsed
+		if byMSP[e.MspID] == nil {
+			byMSP[e.MspID] = &model.MSPUsage{MspID: e.MspID}
+		}
+		byMSP[e.MspID].QueryCount++
+		byMSP[e.MspID].EpsilonConsumed += e.EpsilonUsed
+	}
+
+	if totals != report.Totals {
+		return fmt.Errorf("totals are %+v, report says %+v", totals, report.Totals)
+	}
+	for _, b := range report.Budgets {
+		line := lines[b.UserID+"\x00"+b.DatasetID]
+		if line.PeriodQueries != b.PeriodQueries || line.PeriodEpsilon != b.PeriodEpsilon {
+			return fmt.Errorf("budget user=%s dataset=%s spent %d queries and %g in the period, report says %d and %g",
+				b.UserID, b.DatasetID, line.PeriodQueries, line.PeriodEpsilon, b.PeriodQueries, b.PeriodEpsilon)
+		}
+	}
+	if len(report.ByPurpose) != len(byPurpose) {
+		return fmt.Errorf("entries use %d purposes, report lists %d", len(byPurpose), len(report.ByPurpose))
+	}
+	for _, u := range report.ByPurpose {
+		if want := byPurpose[u.Purpose]; want == nil || *want != *u {
+			return fmt.Errorf("usage of purpose %q does not match the entries", u.Purpose)
+		}
+	}
+	if len(report.ByMSP) != len(byMSP) {
+		return fmt.Errorf("entries come from %d MSPs, report lists %d", len(byMSP), len(report.ByMSP))
+	}
+	for _, u := range report.ByMSP {
+		if want := byMSP[u.MspID]; want == nil || *want != *u {
+			return fmt.Errorf("usage of MSP %q does not match the entries", u.MspID)
+		}
+	}
+	return nil
+}
+
+// sign signs data with the private key in keyFile. ECDSA signatures are
+// ASN.1 DER over SHA-256(data), as checked by
+// `openssl dgst -sha256 -verify pub.pem -signature report.json.sig report.json`;
+// Ed25519 signatures are the raw 64 bytes over data.
+func sign(keyFile string, data []byte) ([]byte, error) {
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", keyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", keyFile, err)
+	}
+
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.SignASN1(rand.Reader, key, digest[:])
+	case ed25519.PrivateKey:
+		return ed25519.Sign(key, data), nil
+	}
+	return nil, fmt.Errorf("%s: unsupported key type %T, expected ECDSA or Ed25519", keyFile, key)
+}
+
+func budgetRows(report *model.AuditReport) [][]string {
+	rows := [][]string{{"userId", "datasetId", "status", "totalBudget", "consumedBudget", "periodQueries", "periodEpsilon"}}
+	for _, b := range report.Budgets {
+		rows = append(rows, []string{
+			b.UserID, b.DatasetID, b.Status, formatFloat(b.TotalBudget), formatFloat(b.ConsumedBudget),
+			strconv.Itoa(b.PeriodQueries), formatFloat(b.PeriodEpsilon),
+		})
+	}
+	return rows
+}
+
+func entryRows(report *model.AuditReport) [][]string {
+	rows := [][]string{{"timestamp", "txId", "userId", "datasetId", "sequence", "purpose", "mspId",
+		"epsilonUsed", "cumulativeEpsilon", "remainingEpsilon", "queryDigest", "hash"}}
+	for _, e := range report.Entries {
+		rows = append(rows, []string{
+			e.Timestamp, e.TxID, e.UserID, e.DatasetID, strconv.Itoa(e.Sequence), e.Purpose, e.MspID,
+			formatFloat(e.EpsilonUsed), formatFloat(e.CumulativeEpsilon), formatFloat(e.RemainingEpsilon),
+			e.QueryDigest, e.Hash,
+		})
+	}
+	return rows
+}
+
+func actionRows(report *model.AuditReport) [][]string {
+	rows := [][]string{{"timestamp", "txId", "actor", "action", "userId", "datasetId", "detail"}}
+	for _, a := range report.AdminActions {
+		rows = append(rows, []string{a.Timestamp, a.TxID, a.Actor, a.Action, a.UserID, a.DatasetID, a.Detail})
+	}
+	return rows
+}
+
+func writeCSV(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,482 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// ============================================================================
+// Agreement Contract – data use agreements that budgets are granted under
+// ============================================================================
+
+// agreementKey returns the primary composite key for a DataUseAgreement.
+func agreementKey(ctx TransactionContextInterface, agreementID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(AGREEMENT_OBJECT_TYPE, []string{agreementID})
+}
+
+// ---------------------------------------------------------------------------
+// Write operations
+// ---------------------------------------------------------------------------
+
+// ProposeAgreement records a data use agreement. Every MSP that owns one of
+// the covered datasets must approve it before it becomes Active; the
+// proposer's approval is counted straight away when it is one of them.
+//
+// Parameters:
+//   - agreementID:  unique identifier budgets refer to
+//   - partiesJSON:  JSON array of registered user IDs covered, e.g. ["user1"]
+//   - datasetsJSON: JSON array of Active dataset IDs covered
+//   - purposesJSON: JSON array of vocabulary purposes covered
+//   - validFrom:    RFC 3339 start of the validity period
+//   - validUntil:   RFC 3339 end of the validity period (exclusive)
+//   - documentHash: hash of the signed agreement document
+func (s *AgreementContract) ProposeAgreement(
+	ctx TransactionContextInterface,
+	agreementID string,
+	partiesJSON string,
+	datasetsJSON string,
+	purposesJSON string,
+	validFrom string,
+	validUntil string,
+	documentHash string,
+) (*DataUseAgreement, error) {
+	method := "ProposeAgreement"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if agreementID == "" || documentHash == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: agreementID and documentHash are required", method)
+	}
+	if err := validateValidityPeriod(ctx, validFrom, validUntil); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	var parties, datasets []string
+	if err := json.Unmarshal([]byte(partiesJSON), &parties); err != nil {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: invalid parties JSON: %v", method, err)
+	}
+	if err := json.Unmarshal([]byte(datasetsJSON), &datasets); err != nil {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: invalid datasets JSON: %v", method, err)
+	}
+	if len(parties) == 0 || len(datasets) == 0 {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: at least one party and one dataset are required", method)
+	}
+	for _, userID := range parties {
+		if _, _, err := readResearcher(ctx, userID); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+	}
+	required := []string{}
+	for _, datasetID := range datasets {
+		dataset, _, err := readDataset(ctx, datasetID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		if dataset.Status != DATASET_ACTIVE {
+			return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: dataset %s is %s", method, datasetID, dataset.Status)
+		}
+		if !slices.Contains(required, dataset.OwnerMSP) {
+			required = append(required, dataset.OwnerMSP)
+		}
+	}
+	purposes, err := parsePurposeList(ctx, purposesJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if len(purposes) == 0 {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: at least one purpose is required", method)
+	}
+
+	key, err := agreementKey(ctx, agreementID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ledger read error: %v", method, err)
+	}
+	if existing != nil {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: agreement %s already exists", method, agreementID)
+	}
+
+	now := ctx.GetTimestamp()
+	agreement := &DataUseAgreement{
+		ObjectType:        AGREEMENT_OBJECT_TYPE,
+		SchemaVersion:     AGREEMENT_SCHEMA_VERSION,
+		AgreementID:       agreementID,
+		Parties:           parties,
+		Datasets:          datasets,
+		Purposes:          purposes,
+		ValidFrom:         validFrom,
+		ValidUntil:        validUntil,
+		DocumentHash:      documentHash,
+		ProposedBy:        ctx.GetMspID(),
+		RequiredApprovals: required,
+		ApprovedBy:        []string{},
+		Status:            AGREEMENT_PROPOSED,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if slices.Contains(required, agreement.ProposedBy) {
+		agreement.ApprovedBy = append(agreement.ApprovedBy, agreement.ProposedBy)
+	}
+	activateIfApproved(agreement)
+
+	if err := putAgreement(ctx, key, agreement); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: proposed agreement=%s datasets=%v requiredApprovals=%v status=%s",
+		method, agreementID, datasets, required, agreement.Status)
+	return agreement, nil
+}
+
+// ApproveAgreement records the caller MSP's approval of a Proposed agreement.
+// The agreement becomes Active once every required MSP has approved it.
+func (s *AgreementContract) ApproveAgreement(
+	ctx TransactionContextInterface,
+	agreementID string,
+) (*DataUseAgreement, error) {
+	method := "ApproveAgreement"
+
+	agreement, key, err := readAgreement(ctx, agreementID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if agreement.Status != AGREEMENT_PROPOSED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: agreement %s is %s", method, agreementID, agreement.Status)
+	}
+	msp := ctx.GetMspID()
+	if !slices.Contains(agreement.RequiredApprovals, msp) {
+		return nil, codedErrorf(ERR_UNAUTHORIZED, "%s: %s is not a required approver of agreement %s", method, msp, agreementID)
+	}
+	if slices.Contains(agreement.ApprovedBy, msp) {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: %s has already approved agreement %s", method, msp, agreementID)
+	}
+
+	agreement.ApprovedBy = append(agreement.ApprovedBy, msp)
+	activateIfApproved(agreement)
+	agreement.UpdatedAt = ctx.GetTimestamp()
+	if err := putAgreement(ctx, key, agreement); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: agreement=%s approvedBy=%s status=%s", method, agreementID, msp, agreement.Status)
+	return agreement, nil
+}
+
+// TerminateAgreement ends a Proposed or Active agreement before its validity
+// period is over. Only the proposing MSP or a required approver may
+// terminate it. Every Active or Exhausted budget granted under it is
+// suspended with reason AGREEMENT_ENDED.
+func (s *AgreementContract) TerminateAgreement(
+	ctx TransactionContextInterface,
+	agreementID string,
+	note string,
+) (*DataUseAgreement, error) {
+	method := "TerminateAgreement"
+
+	agreement, key, err := readAgreement(ctx, agreementID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	msp := ctx.GetMspID()
+	if msp != agreement.ProposedBy && !slices.Contains(agreement.RequiredApprovals, msp) {
+		return nil, codedErrorf(ERR_UNAUTHORIZED, "%s: %s is not a party to agreement %s", method, msp, agreementID)
+	}
+	if agreement.Status != AGREEMENT_PROPOSED && agreement.Status != AGREEMENT_ACTIVE {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: agreement %s is already %s", method, agreementID, agreement.Status)
+	}
+
+	agreement.Status = AGREEMENT_TERMINATED
+	agreement.StatusNote = note
+	agreement.UpdatedAt = ctx.GetTimestamp()
+	if err := putAgreement(ctx, key, agreement); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	suspended, err := suspendAgreementBudgets(ctx, agreementID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: terminated agreement=%s budgetsSuspended=%d", method, agreementID, suspended)
+	return agreement, nil
+}
+
+// SweepExpiredAgreements moves every Active agreement whose validity period
+// has ended to Expired and suspends the budgets granted under it.
+//
+// Nothing else records an expiry. ConsumeBudget refuses charges under an
+// agreement past its validUntil, but a refused transaction writes nothing,
+// and reads such as GetBudget are never committed. Until the sweep runs, an
+// expired agreement stays Active and its budgets keep their status, so an
+// administrator has to invoke it periodically.
+func (s *AgreementContract) SweepExpiredAgreements(
+	ctx TransactionContextInterface,
+) (*AgreementSweepReport, error) {
+	method := "SweepExpiredAgreements"
+
+	if err := assertAdmin(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	agreements, err := s.ListAgreements(ctx, AGREEMENT_ACTIVE)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	report := &AgreementSweepReport{Expired: []string{}}
+	for _, agreement := range agreements {
+		until, err := time.Parse(time.RFC3339, agreement.ValidUntil)
+		if err != nil || now.Before(until) {
+			continue
+		}
+		agreement.Status = AGREEMENT_EXPIRED
+		agreement.UpdatedAt = ctx.GetTimestamp()
+		key, err := agreementKey(ctx, agreement.AgreementID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key error: %v", method, err)
+		}
+		if err := putAgreement(ctx, key, agreement); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		suspended, err := suspendAgreementBudgets(ctx, agreement.AgreementID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		report.Expired = append(report.Expired, agreement.AgreementID)
+		report.BudgetsSuspended += suspended
+	}
+
+	log.Printf("%s: expired=%v budgetsSuspended=%d", method, report.Expired, report.BudgetsSuspended)
+	return report, nil
+}
+
+// ---------------------------------------------------------------------------
+// Read / query operations
+// ---------------------------------------------------------------------------
+
+// GetAgreement returns a data use agreement.
+func (s *AgreementContract) GetAgreement(
+	ctx TransactionContextInterface,
+	agreementID string,
+) (*DataUseAgreement, error) {
+	agreement, _, err := readAgreement(ctx, agreementID)
+	return agreement, err
+}
+
+// ListAgreements returns every agreement, optionally filtered by status.
+// Pass "" to return all of them.
+func (s *AgreementContract) ListAgreements(
+	ctx TransactionContextInterface,
+	status string,
+) ([]*DataUseAgreement, error) {
+	method := "ListAgreements"
+
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(AGREEMENT_OBJECT_TYPE, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	agreements := []*DataUseAgreement{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		agreement, _, err := decodeAgreement(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+		}
+		if status != "" && agreement.Status != status {
+			continue
+		}
+		agreements = append(agreements, agreement)
+	}
+	return agreements, nil
+}
+
+// GetAgreementBudgets returns every budget granted under an agreement.
+func (s *AgreementContract) GetAgreementBudgets(
+	ctx TransactionContextInterface,
+	agreementID string,
+) ([]*PrivacyBudget, error) {
+	return new(PrivacyBudgetContract).queryBudgetsByIndex(ctx, INDEX_BUDGET_BY_AGREEMENT, agreementID)
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// assertAgreementCovers rejects a use of a dataset that the agreement does
+// not cover: agreement not Active, outside its validity period, user not a
+// party or dataset not listed. A non-empty purpose must also be listed.
+func assertAgreementCovers(ctx TransactionContextInterface, agreementID, userID, datasetID, purpose string) error {
+	if agreementID == "" {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "a data use agreement is required")
+	}
+	agreement, _, err := readAgreement(ctx, agreementID)
+	if err != nil {
+		return err
+	}
+	if agreement.Status != AGREEMENT_ACTIVE {
+		return codedErrorf(ERR_NOT_ACTIVE, "agreement %s is %s", agreementID, agreement.Status)
+	}
+	from, err := time.Parse(time.RFC3339, agreement.ValidFrom)
+	if err != nil {
+		return fmt.Errorf("agreement %s has invalid validFrom: %v", agreementID, err)
+	}
+	until, err := time.Parse(time.RFC3339, agreement.ValidUntil)
+	if err != nil {
+		return fmt.Errorf("agreement %s has invalid validUntil: %v", agreementID, err)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now.Before(from) || !now.Before(until) {
+		return codedErrorf(ERR_NOT_ACTIVE, "agreement %s is valid from %s until %s", agreementID, agreement.ValidFrom, agreement.ValidUntil)
+	}
+	if !slices.Contains(agreement.Parties, userID) {
+		return codedErrorf(ERR_UNAUTHORIZED, "user %s is not a party to agreement %s", userID, agreementID)
+	}
+	if !slices.Contains(agreement.Datasets, datasetID) {
+		return codedErrorf(ERR_PURPOSE_NOT_ALLOWED, "dataset %s is not covered by agreement %s", datasetID, agreementID)
+	}
+	if purpose != "" && !slices.Contains(agreement.Purposes, purpose) {
+		return codedErrorf(ERR_PURPOSE_NOT_ALLOWED, "purpose %q is not covered by agreement %s", purpose, agreementID)
+	}
+	return nil
+}
+
+// activateIfApproved moves a Proposed agreement to Active once every
+// required MSP has approved it.
+func activateIfApproved(agreement *DataUseAgreement) {
+	for _, msp := range agreement.RequiredApprovals {
+		if !slices.Contains(agreement.ApprovedBy, msp) {
+			return
+		}
+	}
+	agreement.Status = AGREEMENT_ACTIVE
+}
+
+// validateValidityPeriod checks that both bounds are RFC 3339, that the
+// period is not empty and that it has not already ended.
+func validateValidityPeriod(ctx TransactionContextInterface, validFrom, validUntil string) error {
+	from, err := time.Parse(time.RFC3339, validFrom)
+	if err != nil {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "invalid validFrom: %v", err)
+	}
+	until, err := time.Parse(time.RFC3339, validUntil)
+	if err != nil {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "invalid validUntil: %v", err)
+	}
+	if !from.Before(until) {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "validFrom %s must be before validUntil %s", validFrom, validUntil)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !until.After(now) {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "validUntil %s is in the past", validUntil)
+	}
+	return nil
+}
+
+// suspendAgreementBudgets suspends every Active or Exhausted budget granted
+// under an agreement and returns how many it suspended.
+func suspendAgreementBudgets(ctx TransactionContextInterface, agreementID string) (int, error) {
+	budgets := new(PrivacyBudgetContract)
+	held, err := budgets.queryBudgetsByIndex(ctx, INDEX_BUDGET_BY_AGREEMENT, agreementID)
+	if err != nil {
+		return 0, err
+	}
+
+	suspended := 0
+	for _, budget := range held {
+		if budget.Status != BUDGET_ACTIVE && budget.Status != BUDGET_EXHAUSTED {
+			continue
+		}
+		if err := transitionBudget(budget, BUDGET_SUSPENDED, REASON_AGREEMENT_ENDED, agreementID); err != nil {
+			return suspended, err
+		}
+		budget.UpdatedAt = ctx.GetTimestamp()
+		key, err := budgetKey(ctx, budget.UserID, budget.DatasetID)
+		if err != nil {
+			return suspended, fmt.Errorf("key error: %v", err)
+		}
+		if err := budgets.putBudget(ctx, key, budget); err != nil {
+			return suspended, err
+		}
+		suspended++
+	}
+	return suspended, nil
+}
+
+// replaceAgreementParty substitutes a party's user ID in every agreement
+// that lists it, so that erasure leaves no plain user ID behind.
+func replaceAgreementParty(ctx TransactionContextInterface, userID, replacement string) error {
+	agreements, err := new(AgreementContract).ListAgreements(ctx, EMPTY_STR)
+	if err != nil {
+		return err
+	}
+	for _, agreement := range agreements {
+		i := slices.Index(agreement.Parties, userID)
+		if i < 0 {
+			continue
+		}
+		agreement.Parties[i] = replacement
+		agreement.UpdatedAt = ctx.GetTimestamp()
+		key, err := agreementKey(ctx, agreement.AgreementID)
+		if err != nil {
+			return fmt.Errorf("key error: %v", err)
+		}
+		if err := putAgreement(ctx, key, agreement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAgreement fetches and unmarshals a DataUseAgreement from the ledger.
+func readAgreement(ctx TransactionContextInterface, agreementID string) (*DataUseAgreement, string, error) {
+	key, err := agreementKey(ctx, agreementID)
+	if err != nil {
+		return nil, "", fmt.Errorf("readAgreement: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("readAgreement: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, "", codedErrorf(ERR_NOT_FOUND, "readAgreement: agreement %s does not exist", agreementID)
+	}
+
+	agreement, _, err := decodeAgreement(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("readAgreement: unmarshal error: %v", err)
+	}
+	return agreement, key, nil
+}
+
+// putAgreement marshals and stores a DataUseAgreement.
+func putAgreement(ctx TransactionContextInterface, key string, agreement *DataUseAgreement) error {
+	data, err := json.Marshal(agreement)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("put error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,455 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+)
+
+// ============================================================================
+// Dataset analytics – maintained aggregates and consumer leaderboard
+// ============================================================================
+//
+// The aggregates of a dataset are kept in one DatasetStats shard per budget
+// holder, under datasetStats\0{datasetID}\0{userID}. A budget write or
+// consumption only touches its own holder's shard, which the transaction
+// already conflicts on through the budget itself, so concurrent consumptions
+// by different users do not collide on a shared record. The budget part of a
+// shard is recomputed from the budget on every write; the consumption part
+// grows with every logged query. GetDatasetStats adds up the shards, so its
+// cost grows with the number of budget holders but never with the number of
+// queries, and no budget or log is scanned at read time. A budget that
+// predates the shards is seeded from its consumption logs the first time it
+// changes.
+
+// datasetStatsKey returns the composite key of the DatasetStats shard of a
+// budget holder.
+func datasetStatsKey(ctx TransactionContextInterface, datasetID, userID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(DATASET_STATS_OBJECT_TYPE, []string{datasetID, userID})
+}
+
+// budgetConsumedIndexKey creates the leaderboard index key of a budget.
+// Ascending key order lists the largest consumers of a dataset first.
+func budgetConsumedIndexKey(ctx TransactionContextInterface, budget *PrivacyBudget) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(INDEX_BUDGET_BY_CONSUMED,
+		[]string{budget.DatasetID, consumedRank(budget.ConsumedBudget), budget.UserID})
+}
+
+// GetDatasetStats returns the aggregates of a dataset: budget counts by
+// status, ε allocated and consumed, the per-MSP breakdown and the per-query
+// ε histogram.
+func (s *PrivacyBudgetContract) GetDatasetStats(
+	ctx TransactionContextInterface,
+	datasetID string,
+) (*DatasetStats, error) {
+	method := "GetDatasetStats"
+
+	if _, _, err := readDataset(ctx, datasetID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(DATASET_STATS_OBJECT_TYPE, []string{datasetID})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	stats := newDatasetStats(datasetID)
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		shard, _, err := decodeDatasetStats(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+		}
+		// The per-dataset record of schema v1 has no holder; it is
+		// superseded by the shards and removed by RebuildDatasetStats.
+		if shard.UserID == "" {
+			continue
+		}
+		mergeStats(stats, shard)
+	}
+	return stats, nil
+}
+
+// GetTopConsumers returns the n budgets that consumed the most ε on a
+// dataset, largest first.
+func (s *PrivacyBudgetContract) GetTopConsumers(
+	ctx TransactionContextInterface,
+	datasetID string,
+	n int,
+) ([]*PrivacyBudget, error) {
+	method := "GetTopConsumers"
+
+	if n < 1 || n > MAX_PAGE_SIZE {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: n must be between 1 and %d, got %d", method, MAX_PAGE_SIZE, n)
+	}
+
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(INDEX_BUDGET_BY_CONSUMED, []string{datasetID})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	top := []*PrivacyBudget{}
+	for iter.HasNext() && len(top) < n {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		if budget := s.budgetFromIndexKey(ctx, INDEX_BUDGET_BY_CONSUMED, kv.Key); budget != nil {
+			top = append(top, budget)
+		}
+	}
+	return top, nil
+}
+
+// RebuildDatasetStats recomputes the aggregates and leaderboard of a dataset
+// from its budgets and consumption logs. Budgets that predate the aggregates
+// are seeded on their next change; this rebuilds all of them at once and
+// removes the per-dataset record of schema v1.
+func (s *PrivacyBudgetContract) RebuildDatasetStats(
+	ctx TransactionContextInterface,
+	datasetID string,
+) (*DatasetStats, error) {
+	method := "RebuildDatasetStats"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if _, _, err := readDataset(ctx, datasetID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	// ---------- drop the old leaderboard and shards ----------
+	for _, objectType := range []string{INDEX_BUDGET_BY_CONSUMED, DATASET_STATS_OBJECT_TYPE} {
+		iter, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{datasetID})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		var stale []string
+		for iter.HasNext() {
+			kv, err := iter.Next()
+			if err != nil {
+				iter.Close()
+				return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+			}
+			stale = append(stale, kv.Key)
+		}
+		iter.Close()
+		for _, key := range stale {
+			if err := ctx.GetStub().DelState(key); err != nil {
+				return nil, fmt.Errorf("%s: delete error: %v", method, err)
+			}
+		}
+	}
+
+	// ---------- recompute ----------
+	budgets, err := s.GetBudgetsByDataset(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	stats := newDatasetStats(datasetID)
+	now := ctx.GetTimestamp()
+	for _, budget := range budgets {
+		// Read through the primary key, which also finds entries logged
+		// before the dataset index existed.
+		logs, err := s.GetConsumptionLogs(ctx, budget.UserID, datasetID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		shard := newStatsShard(datasetID, budget.UserID)
+		setBudgetStats(shard, budget)
+		for _, entry := range logs {
+			addConsumptionToStats(shard, entry.MspID, entry.EpsilonUsed)
+		}
+		shard.UpdatedAt = now
+		if err := putDatasetStats(ctx, shard); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		mergeStats(stats, shard)
+
+		idx, err := budgetConsumedIndexKey(ctx, budget)
+		if err != nil {
+			return nil, fmt.Errorf("%s: index key error: %v", method, err)
+		}
+		if err := ctx.GetStub().PutState(idx, []byte{0x00}); err != nil {
+			return nil, fmt.Errorf("%s: index put error: %v", method, err)
+		}
+	}
+
+	log.Printf("%s: dataset=%s budgets=%d queries=%d", method, datasetID, stats.BudgetCount, stats.QueryCount)
+	return stats, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// trackBudgetChange folds a budget write into its holder's DatasetStats
+// shard and the dataset's leaderboard. before is the stored budget (nil when
+// it is being created), after the new one (nil when it is being deleted).
+func trackBudgetChange(ctx TransactionContextInterface, before, after *PrivacyBudget) error {
+	if before != nil && after != nil &&
+		before.Status == after.Status &&
+		before.TotalBudget == after.TotalBudget &&
+		before.ConsumedBudget == after.ConsumedBudget &&
+		before.UserID == after.UserID {
+		return nil
+	}
+
+	if before != nil {
+		idx, err := budgetConsumedIndexKey(ctx, before)
+		if err != nil {
+			return fmt.Errorf("index key error: %v", err)
+		}
+		if err := ctx.GetStub().DelState(idx); err != nil {
+			return fmt.Errorf("index delete error: %v", err)
+		}
+	}
+	if after == nil {
+		if before == nil {
+			return nil
+		}
+		key, err := datasetStatsKey(ctx, before.DatasetID, before.UserID)
+		if err != nil {
+			return fmt.Errorf("key error: %v", err)
+		}
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return fmt.Errorf("delete error: %v", err)
+		}
+		ctx.StageState(key, nil)
+		return nil
+	}
+
+	shard, err := readStatsShard(ctx, after.DatasetID, after.UserID, before != nil)
+	if err != nil {
+		return err
+	}
+	setBudgetStats(shard, after)
+	shard.UpdatedAt = ctx.GetTimestamp()
+	if err := putDatasetStats(ctx, shard); err != nil {
+		return err
+	}
+	idx, err := budgetConsumedIndexKey(ctx, after)
+	if err != nil {
+		return fmt.Errorf("index key error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(idx, []byte{0x00}); err != nil {
+		return fmt.Errorf("index put error: %v", err)
+	}
+	return nil
+}
+
+// trackConsumption adds a consumption to its holder's per-MSP breakdown and
+// ε histogram.
+func trackConsumption(ctx TransactionContextInterface, entry *BudgetConsumptionLog) error {
+	shard, err := readStatsShard(ctx, entry.DatasetID, entry.UserID, false)
+	if err != nil {
+		return err
+	}
+	addConsumptionToStats(shard, entry.MspID, entry.EpsilonUsed)
+	shard.UpdatedAt = ctx.GetTimestamp()
+	return putDatasetStats(ctx, shard)
+}
+
+// moveStatsShard re-keys a holder's shard to a new user ID, as erasure does
+// with the holder's budgets. A missing shard is seeded from the logs first.
+func moveStatsShard(ctx TransactionContextInterface, datasetID, fromUserID, toUserID string) error {
+	shard, err := readStatsShard(ctx, datasetID, fromUserID, true)
+	if err != nil {
+		return err
+	}
+	key, err := datasetStatsKey(ctx, datasetID, fromUserID)
+	if err != nil {
+		return fmt.Errorf("moveStatsShard: key error: %v", err)
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return fmt.Errorf("moveStatsShard: delete error: %v", err)
+	}
+	ctx.StageState(key, nil)
+	shard.UserID = toUserID
+	return putDatasetStats(ctx, shard)
+}
+
+// newDatasetStats returns empty aggregates for a dataset.
+func newDatasetStats(datasetID string) *DatasetStats {
+	return &DatasetStats{
+		ObjectType:       DATASET_STATS_OBJECT_TYPE,
+		SchemaVersion:    DATASET_STATS_SCHEMA_VERSION,
+		DatasetID:        datasetID,
+		ByMSP:            []*MSPUsage{},
+		EpsilonHistogram: newEpsilonHistogram(),
+	}
+}
+
+// newStatsShard returns an empty shard for a budget holder.
+func newStatsShard(datasetID, userID string) *DatasetStats {
+	shard := newDatasetStats(datasetID)
+	shard.UserID = userID
+	return shard
+}
+
+// newEpsilonHistogram returns one empty bucket per EPSILON_HISTOGRAM_BOUNDS
+// plus the unbounded last bucket.
+func newEpsilonHistogram() []*EpsilonBucket {
+	buckets := make([]*EpsilonBucket, 0, len(EPSILON_HISTOGRAM_BOUNDS)+1)
+	lower := 0.0
+	for _, upper := range EPSILON_HISTOGRAM_BOUNDS {
+		buckets = append(buckets, &EpsilonBucket{LowerBound: lower, UpperBound: upper})
+		lower = upper
+	}
+	return append(buckets, &EpsilonBucket{LowerBound: lower})
+}
+
+// setBudgetStats sets the budget part of a holder's shard to the budget's
+// current state.
+func setBudgetStats(shard *DatasetStats, budget *PrivacyBudget) {
+	shard.BudgetCount = 1
+	shard.ActiveBudgets, shard.ExhaustedBudgets, shard.SuspendedBudgets, shard.RevokedBudgets = 0, 0, 0, 0
+	switch budget.Status {
+	case BUDGET_ACTIVE:
+		shard.ActiveBudgets = 1
+	case BUDGET_EXHAUSTED:
+		shard.ExhaustedBudgets = 1
+	case BUDGET_SUSPENDED:
+		shard.SuspendedBudgets = 1
+	case BUDGET_REVOKED:
+		shard.RevokedBudgets = 1
+	}
+	shard.TotalAllocated = budget.TotalBudget
+	shard.TotalConsumed = budget.ConsumedBudget
+}
+
+// mergeStats adds a holder's shard to a dataset's aggregates and keeps the
+// latest update time.
+func mergeStats(ds, shard *DatasetStats) {
+	ds.BudgetCount += shard.BudgetCount
+	ds.ActiveBudgets += shard.ActiveBudgets
+	ds.ExhaustedBudgets += shard.ExhaustedBudgets
+	ds.SuspendedBudgets += shard.SuspendedBudgets
+	ds.RevokedBudgets += shard.RevokedBudgets
+	ds.TotalAllocated += shard.TotalAllocated
+	ds.TotalConsumed += shard.TotalConsumed
+	ds.QueryCount += shard.QueryCount
+	for _, usage := range shard.ByMSP {
+		msp := mspUsage(&ds.ByMSP, usage.MspID)
+		msp.QueryCount += usage.QueryCount
+		msp.EpsilonConsumed += usage.EpsilonConsumed
+	}
+	for i, bucket := range shard.EpsilonHistogram {
+		if i < len(ds.EpsilonHistogram) {
+			ds.EpsilonHistogram[i].QueryCount += bucket.QueryCount
+			ds.EpsilonHistogram[i].Epsilon += bucket.Epsilon
+		}
+	}
+	if shard.UpdatedAt > ds.UpdatedAt {
+		ds.UpdatedAt = shard.UpdatedAt
+	}
+}
+
+// addConsumptionToStats counts one query of the given ε submitted by an MSP.
+func addConsumptionToStats(ds *DatasetStats, mspID string, epsilon float64) {
+	ds.QueryCount++
+
+	msp := mspUsage(&ds.ByMSP, mspID)
+	msp.QueryCount++
+	msp.EpsilonConsumed += epsilon
+
+	bucket := ds.EpsilonHistogram[len(ds.EpsilonHistogram)-1]
+	for _, b := range ds.EpsilonHistogram {
+		if b.UpperBound != 0 && epsilon <= b.UpperBound {
+			bucket = b
+			break
+		}
+	}
+	bucket.QueryCount++
+	bucket.Epsilon += epsilon
+}
+
+// consumedRank encodes consumed ε as a fixed-width string that sorts in
+// descending order of consumption, at micro-ε resolution.
+func consumedRank(consumed float64) string {
+	return fmt.Sprintf("%019d", math.MaxInt64-int64(math.Round(consumed*1e6)))
+}
+
+// readStagedBudget returns the budget stored under key as this transaction
+// sees it, or nil if there is none.
+func readStagedBudget(ctx TransactionContextInterface, key string) (*PrivacyBudget, error) {
+	raw, err := getStagedState(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("readStagedBudget: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	budget, _, err := decodeBudget(raw)
+	if err != nil {
+		return nil, fmt.Errorf("readStagedBudget: unmarshal error: %v", err)
+	}
+	return budget, nil
+}
+
+// readStatsShard fetches a holder's DatasetStats shard as this transaction
+// sees it. A missing shard starts empty, unless seed is set: then the holder
+// has a budget from before the shards existed, and its consumption logs are
+// counted into the new shard.
+func readStatsShard(ctx TransactionContextInterface, datasetID, userID string, seed bool) (*DatasetStats, error) {
+	key, err := datasetStatsKey(ctx, datasetID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("readStatsShard: key error: %v", err)
+	}
+	raw, err := getStagedState(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("readStatsShard: ledger read error: %v", err)
+	}
+	if raw != nil {
+		shard, _, err := decodeDatasetStats(raw)
+		if err != nil {
+			return nil, fmt.Errorf("readStatsShard: unmarshal error: %v", err)
+		}
+		return shard, nil
+	}
+
+	shard := newStatsShard(datasetID, userID)
+	if seed {
+		logs, err := new(PrivacyBudgetContract).GetConsumptionLogs(ctx, userID, datasetID)
+		if err != nil {
+			return nil, fmt.Errorf("readStatsShard: %v", err)
+		}
+		for _, entry := range logs {
+			addConsumptionToStats(shard, entry.MspID, entry.EpsilonUsed)
+		}
+	}
+	return shard, nil
+}
+
+// putDatasetStats marshals and stores a DatasetStats shard, staging it so
+// later writes in the same transaction build on it.
+func putDatasetStats(ctx TransactionContextInterface, stats *DatasetStats) error {
+	key, err := datasetStatsKey(ctx, stats.DatasetID, stats.UserID)
+	if err != nil {
+		return fmt.Errorf("putDatasetStats: key error: %v", err)
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("putDatasetStats: marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("putDatasetStats: put error: %v", err)
+	}
+	ctx.StageState(key, data)
+	return nil
+}
+
+// getStagedState reads a key as this transaction sees it: the value it
+// staged itself, or else the committed ledger value.
+func getStagedState(ctx TransactionContextInterface, key string) ([]byte, error) {
+	if value, ok := ctx.GetStagedState(key); ok {
+		return value, nil
+	}
+	return ctx.GetStub().GetState(key)
+}
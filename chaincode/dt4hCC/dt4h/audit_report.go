@@ -0,0 +1,293 @@
+package dt4h
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/chaincode/dt4hCC/logchain"
+)
+
+// ============================================================================
+// Audit reports – privacy expenditure over a period, for regulators
+// ============================================================================
+//
+// GetAuditReport collects the budgets, consumption and administrative
+// changes on a dataset, or on every dataset an organisation owns, into one
+// document. Consumption entries are found through the day-bucketed log
+// indexes and administrative changes through the budgets' ledger history.
+// The report's Merkle root, see logchain.AuditRoot, covers its scope, budget
+// lines, administrative actions and entries. Recomputing it from an exported
+// copy only shows the copy is consistent with the root it carries; checking
+// it against the root of the same report run on a peer the reader trusts
+// shows the copy is what the ledger holds.
+//
+// Administrative actions cover the budgets' own history only: changes to
+// agreements, consent, datasets and the purpose vocabulary are not listed.
+
+// GetAuditReport returns the audit report of a dataset or an organisation
+// for [from, to). Both bounds are RFC 3339 and may span at most
+// MAX_TIME_RANGE_DAYS days.
+//
+// Parameters:
+//   - scope:   "dataset" or "organisation"
+//   - scopeID: the dataset ID, or the MSP ID of the organisation
+//   - from, to: the reporting period, e.g. "2025-01-01T00:00:00Z"
+func (s *PrivacyBudgetContract) GetAuditReport(
+	ctx TransactionContextInterface,
+	scope string,
+	scopeID string,
+	from string,
+	to string,
+) (*AuditReport, error) {
+	method := "GetAuditReport"
+
+	lower, upper, _, err := parseTimeRange(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	datasetIDs, err := reportDatasets(ctx, scope, scopeID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	report := &AuditReport{
+		Scope:        scope,
+		ScopeID:      scopeID,
+		From:         lower,
+		To:           upper,
+		GeneratedAt:  ctx.GetTimestamp(),
+		TxID:         ctx.GetStub().GetTxID(),
+		DatasetIDs:   datasetIDs,
+		Budgets:      []*AuditBudgetLine{},
+		ByPurpose:    []*PurposeUsage{},
+		ByMSP:        []*MSPUsage{},
+		AdminActions: []*AdminAction{},
+		Entries:      []*BudgetConsumptionLog{},
+	}
+
+	// ---------- budgets and their administrative changes ----------
+	lines := map[string]*AuditBudgetLine{}
+	for _, datasetID := range datasetIDs {
+		budgets, err := s.GetBudgetsByDataset(ctx, datasetID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		for _, budget := range budgets {
+			if budget.CreatedAt >= upper {
+				continue
+			}
+			line := &AuditBudgetLine{
+				UserID:         budget.UserID,
+				DatasetID:      budget.DatasetID,
+				Status:         budget.Status,
+				TotalBudget:    budget.TotalBudget,
+				ConsumedBudget: budget.ConsumedBudget,
+			}
+			report.Budgets = append(report.Budgets, line)
+			lines[budget.UserID+"\x00"+budget.DatasetID] = line
+			report.Totals.BudgetCount++
+			report.Totals.EpsilonAllocated += budget.TotalBudget
+			report.Totals.EpsilonConsumed += budget.ConsumedBudget
+
+			actions, err := s.budgetAdminActions(ctx, budget.UserID, budget.DatasetID, lower, upper)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", method, err)
+			}
+			report.AdminActions = append(report.AdminActions, actions...)
+		}
+
+		entries, err := s.GetConsumptionLogsByTimeRange(ctx, lower, upper, "", datasetID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		report.Entries = append(report.Entries, entries...)
+	}
+	sort.SliceStable(report.AdminActions, func(i, j int) bool {
+		return report.AdminActions[i].Timestamp < report.AdminActions[j].Timestamp
+	})
+
+	// ---------- consumption in the period ----------
+	sortReportEntries(report.Entries)
+	for _, entry := range report.Entries {
+		report.Totals.PeriodQueries++
+		report.Totals.PeriodEpsilon += entry.EpsilonUsed
+		if line := lines[entry.UserID+"\x00"+entry.DatasetID]; line != nil {
+			line.PeriodQueries++
+			line.PeriodEpsilon += entry.EpsilonUsed
+		}
+		usage := purposeUsage(&report.ByPurpose, entry.Purpose)
+		usage.QueryCount++
+		usage.EpsilonConsumed += entry.EpsilonUsed
+		msp := mspUsage(&report.ByMSP, entry.MspID)
+		msp.QueryCount++
+		msp.EpsilonConsumed += entry.EpsilonUsed
+	}
+
+	if report.MerkleRoot, err = logchain.AuditRoot(report); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: %s=%s from=%s to=%s budgets=%d entries=%d actions=%d",
+		method, scope, scopeID, lower, upper, len(report.Budgets), len(report.Entries), len(report.AdminActions))
+	return report, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// reportDatasets resolves the scope of an audit report to its datasets.
+func reportDatasets(ctx TransactionContextInterface, scope, scopeID string) ([]string, error) {
+	switch scope {
+	case REPORT_SCOPE_DATASET:
+		if _, _, err := readDataset(ctx, scopeID); err != nil {
+			return nil, err
+		}
+		return []string{scopeID}, nil
+	case REPORT_SCOPE_ORGANISATION:
+		datasets, err := new(DatasetContract).GetDatasetsByOwner(ctx, scopeID)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(datasets))
+		for _, dataset := range datasets {
+			ids = append(ids, dataset.DatasetID)
+		}
+		return ids, nil
+	}
+	return nil, codedErrorf(ERR_INVALID_ARGUMENT, "unknown report scope %q, expected %q or %q", scope, REPORT_SCOPE_DATASET, REPORT_SCOPE_ORGANISATION)
+}
+
+// budgetAdminActions derives the administrative changes made to a budget in
+// [lower, upper) by comparing consecutive states in its ledger history.
+// Changes made by consumption alone are not listed.
+func (s *PrivacyBudgetContract) budgetAdminActions(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	lower string,
+	upper string,
+) ([]*AdminAction, error) {
+	history, err := s.GetBudgetHistory(ctx, userID, datasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []*AdminAction{}
+	var prev *PrivacyBudget
+	for _, change := range history {
+		if change.IsDelete {
+			prev = nil
+			continue
+		}
+		if change.Timestamp >= lower && change.Timestamp < upper {
+			for _, action := range adminChanges(prev, change.Budget) {
+				action.TxID = change.TxID
+				action.Timestamp = change.Timestamp
+				action.Actor = change.Actor
+				action.UserID = userID
+				action.DatasetID = datasetID
+				actions = append(actions, action)
+			}
+		}
+		prev = change.Budget
+	}
+	return actions, nil
+}
+
+// adminChanges lists the administrative actions that turned prev into cur;
+// prev is nil for the first state of the budget.
+func adminChanges(prev, cur *PrivacyBudget) []*AdminAction {
+	if prev == nil {
+		if cur.Status == BUDGET_REVOKED && cur.StatusReason == REASON_ERASURE {
+			return []*AdminAction{{Action: ACTION_BUDGET_ERASED, Detail: statusDetail(cur)}}
+		}
+		detail := fmt.Sprintf("total=%g", cur.TotalBudget)
+		if cur.AgreementID != "" {
+			detail += " agreement=" + cur.AgreementID
+		}
+		return []*AdminAction{{Action: ACTION_BUDGET_INITIALIZED, Detail: detail}}
+	}
+
+	var actions []*AdminAction
+	if cur.TotalBudget != prev.TotalBudget {
+		actions = append(actions, &AdminAction{
+			Action: ACTION_BUDGET_UPDATED,
+			Detail: fmt.Sprintf("total %g -> %g", prev.TotalBudget, cur.TotalBudget),
+		})
+	}
+	if cur.AgreementID != prev.AgreementID {
+		actions = append(actions, &AdminAction{
+			Action: ACTION_BUDGET_UPDATED,
+			Detail: "agreement=" + cur.AgreementID,
+		})
+	}
+	if cur.Status != prev.Status {
+		switch {
+		case cur.Status == BUDGET_SUSPENDED:
+			actions = append(actions, &AdminAction{Action: ACTION_BUDGET_SUSPENDED, Detail: statusDetail(cur)})
+		case cur.Status == BUDGET_REVOKED:
+			actions = append(actions, &AdminAction{Action: ACTION_BUDGET_REVOKED, Detail: statusDetail(cur)})
+		case cur.Status == BUDGET_ACTIVE && prev.Status == BUDGET_SUSPENDED:
+			actions = append(actions, &AdminAction{Action: ACTION_BUDGET_RESUMED, Detail: statusDetail(cur)})
+		}
+	}
+	return actions
+}
+
+// statusDetail describes the reason recorded with a budget's status.
+func statusDetail(budget *PrivacyBudget) string {
+	parts := []string{}
+	for _, s := range []string{budget.StatusReason, budget.StatusNote} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, ": ")
+}
+
+// sortReportEntries puts consumption log entries in report order: by
+// timestamp, dataset, user and sequence.
+func sortReportEntries(entries []*BudgetConsumptionLog) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Timestamp != b.Timestamp {
+			return a.Timestamp < b.Timestamp
+		}
+		if a.DatasetID != b.DatasetID {
+			return a.DatasetID < b.DatasetID
+		}
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.Sequence < b.Sequence
+	})
+}
+
+// purposeUsage returns the entry for a purpose, inserting it in order.
+func purposeUsage(usages *[]*PurposeUsage, purpose string) *PurposeUsage {
+	list := *usages
+	i := sort.Search(len(list), func(i int) bool { return list[i].Purpose >= purpose })
+	if i == len(list) || list[i].Purpose != purpose {
+		list = append(list, nil)
+		copy(list[i+1:], list[i:])
+		list[i] = &PurposeUsage{Purpose: purpose}
+		*usages = list
+	}
+	return list[i]
+}
+
+// mspUsage returns the entry for an MSP, inserting it in order.
+func mspUsage(usages *[]*MSPUsage, mspID string) *MSPUsage {
+	list := *usages
+	i := sort.Search(len(list), func(i int) bool { return list[i].MspID >= mspID })
+	if i == len(list) || list[i].MspID != mspID {
+		list = append(list, nil)
+		copy(list[i+1:], list[i:])
+		list[i] = &MSPUsage{MspID: mspID}
+		*usages = list
+	}
+	return list[i]
+}
@@ -0,0 +1,200 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ============================================================================
+// Batch provisioning – many budget changes in a single transaction
+// ============================================================================
+
+// InitializeBudgetsBatch creates a budget for every entry of requestsJSON, a
+// JSON array of BudgetRequest. Every dataset and user must be registered and
+// Active, and each entry must name an Active data use agreement covering
+// them. All entries are validated before anything is written: if any entry
+// is invalid the whole batch is rejected and the error lists every failing
+// entry by index.
+//
+// Example requestsJSON:
+//
+//	[{"userId":"user1","datasetId":"ds1","totalEpsilon":10,"agreementId":"dua-1"},
+//	 {"userId":"user2","datasetId":"ds1","totalEpsilon":5,"agreementId":"dua-1"}]
+func (s *PrivacyBudgetContract) InitializeBudgetsBatch(
+	ctx TransactionContextInterface,
+	requestsJSON string,
+) ([]*BudgetBatchResult, error) {
+	return s.runBatch(ctx, "InitializeBudgetsBatch", requestsJSON,
+		func(current *PrivacyBudget, req BudgetRequest) (*PrivacyBudget, error) {
+			if current != nil {
+				return nil, codedErrorf(ERR_ALREADY_EXISTS, "budget already exists")
+			}
+			if err := assertDatasetActive(ctx, req.DatasetID); err != nil {
+				return nil, err
+			}
+			if err := assertUserActive(ctx, req.UserID); err != nil {
+				return nil, err
+			}
+			if err := assertAgreementCovers(ctx, req.AgreementID, req.UserID, req.DatasetID, ""); err != nil {
+				return nil, err
+			}
+			return newBudget(ctx, req.UserID, req.DatasetID, req.TotalEpsilon, req.AgreementID)
+		})
+}
+
+// UpdateBudgetsBatch sets a new total epsilon for every entry of requestsJSON
+// with the same rules as UpdateBudget. Entries may repeat a (user, dataset)
+// pair; each sees the result of the previous one.
+func (s *PrivacyBudgetContract) UpdateBudgetsBatch(
+	ctx TransactionContextInterface,
+	requestsJSON string,
+) ([]*BudgetBatchResult, error) {
+	return s.runBatch(ctx, "UpdateBudgetsBatch", requestsJSON,
+		func(current *PrivacyBudget, req BudgetRequest) (*PrivacyBudget, error) {
+			if current == nil {
+				return nil, codedErrorf(ERR_NOT_FOUND, "no budget found")
+			}
+			if err := applyBudgetUpdate(ctx, current, req.TotalEpsilon); err != nil {
+				return nil, err
+			}
+			return current, refreshWarningLevel(ctx, current)
+		})
+}
+
+// RevokeBudgetsBatch revokes every budget listed in requestsJSON. The
+// totalEpsilon field of each entry is ignored.
+func (s *PrivacyBudgetContract) RevokeBudgetsBatch(
+	ctx TransactionContextInterface,
+	requestsJSON string,
+) ([]*BudgetBatchResult, error) {
+	return s.runBatch(ctx, "RevokeBudgetsBatch", requestsJSON,
+		func(current *PrivacyBudget, req BudgetRequest) (*PrivacyBudget, error) {
+			if current == nil {
+				return nil, codedErrorf(ERR_NOT_FOUND, "no budget found")
+			}
+			if err := transitionBudget(current, BUDGET_REVOKED, "", ""); err != nil {
+				return nil, err
+			}
+			current.UpdatedAt = ctx.GetTimestamp()
+			return current, nil
+		})
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// batchStep computes the state of one budget after a batch entry. current is
+// a private copy of the budget (nil if it does not exist yet) that the step
+// may modify and return.
+type batchStep func(current *PrivacyBudget, req BudgetRequest) (*PrivacyBudget, error)
+
+// runBatch validates every entry against a staged working set and, only if
+// all entries pass, writes the final state of each touched budget.
+//
+// Fabric does not return a transaction's own writes from GetState, so the
+// working set – not the ledger – is the source of truth for pairs that
+// appear more than once in the batch.
+func (s *PrivacyBudgetContract) runBatch(
+	ctx TransactionContextInterface,
+	method string,
+	requestsJSON string,
+	step batchStep,
+) ([]*BudgetBatchResult, error) {
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	var requests []BudgetRequest
+	if err := json.Unmarshal([]byte(requestsJSON), &requests); err != nil {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: invalid requests JSON: %v", method, err)
+	}
+	if len(requests) == 0 || len(requests) > MAX_BATCH_SIZE {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: batch must contain 1..%d entries, got %d", method, MAX_BATCH_SIZE, len(requests))
+	}
+
+	working := make(map[string]*PrivacyBudget) // budget key -> staged state
+	created := make(map[string]bool)           // keys that need index entries
+	var order []string                         // keys in first-touched order
+	var failures []string
+	results := make([]*BudgetBatchResult, 0, len(requests))
+
+	// ---------- validate and stage ----------
+	for i, req := range requests {
+		key, err := budgetKey(ctx, req.UserID, req.DatasetID)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("[%d] user=%s dataset=%s: key error: %v", i, req.UserID, req.DatasetID, err))
+			continue
+		}
+
+		current, staged := working[key]
+		if !staged {
+			current, err = s.lookupBudget(ctx, key)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", method, err)
+			}
+		}
+		if current != nil {
+			copied := *current
+			current = &copied
+		}
+
+		next, err := step(current, req)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("[%d] user=%s dataset=%s: %v", i, req.UserID, req.DatasetID, err))
+			continue
+		}
+
+		if !staged {
+			order = append(order, key)
+			created[key] = current == nil
+		}
+		working[key] = next
+		snapshot := *next
+		results = append(results, &BudgetBatchResult{Index: i, Budget: &snapshot})
+	}
+
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("%s: %d of %d entries rejected, nothing was applied: %s",
+			method, len(failures), len(requests), strings.Join(failures, "; "))
+	}
+
+	// ---------- apply ----------
+	for _, key := range order {
+		budget := working[key]
+		var err error
+		if created[key] {
+			err = s.putBudgetWithIndexes(ctx, budget)
+		} else {
+			err = s.putBudget(ctx, key, budget)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+	}
+
+	log.Printf("%s: applied %d entries to %d budgets", method, len(requests), len(order))
+	return results, nil
+}
+
+// lookupBudget reads a budget by primary key, returning nil if it does not
+// exist.
+func (s *PrivacyBudgetContract) lookupBudget(
+	ctx TransactionContextInterface,
+	key string,
+) (*PrivacyBudget, error) {
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("lookupBudget: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	budget, err := s.loadBudget(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("lookupBudget: %v", err)
+	}
+	return budget, nil
+}
@@ -0,0 +1,269 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// ============================================================================
+// Consent Contract – data subject consent scope per dataset
+// ============================================================================
+
+// consentKey returns the primary composite key for a dataset's Consent.
+func consentKey(ctx TransactionContextInterface, datasetID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(CONSENT_OBJECT_TYPE, []string{datasetID})
+}
+
+// ---------------------------------------------------------------------------
+// Write operations
+// ---------------------------------------------------------------------------
+
+// RecordConsent sets the consent scope of a dataset, replacing any earlier
+// scope. Only the MSP that owns the dataset may record its consent.
+//
+// Parameters:
+//   - datasetID:           the dataset the consent applies to
+//   - allowedPurposesJSON: JSON array of vocabulary purposes, e.g. ["clinical-research"]
+//   - secondaryUse:        whether secondary-use purposes beyond the allowed
+//     ones are covered
+//   - expiresAt:           RFC 3339 expiry, or "" for no expiry
+func (s *ConsentContract) RecordConsent(
+	ctx TransactionContextInterface,
+	datasetID string,
+	allowedPurposesJSON string,
+	secondaryUse bool,
+	expiresAt string,
+) (*Consent, error) {
+	method := "RecordConsent"
+
+	if _, _, err := readOwnedDataset(ctx, datasetID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	purposes, err := parsePurposeList(ctx, allowedPurposesJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if len(purposes) == 0 {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: at least one allowed purpose is required", method)
+	}
+	if expiresAt != "" {
+		expiry, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: invalid expiresAt: %v", method, err)
+		}
+		now, err := txTime(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		if !expiry.After(now) {
+			return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: expiresAt %s is in the past", method, expiresAt)
+		}
+	}
+
+	key, err := consentKey(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	now := ctx.GetTimestamp()
+	consent := &Consent{
+		ObjectType:      CONSENT_OBJECT_TYPE,
+		SchemaVersion:   CONSENT_SCHEMA_VERSION,
+		DatasetID:       datasetID,
+		ProviderMSP:     ctx.GetMspID(),
+		AllowedPurposes: purposes,
+		SecondaryUse:    secondaryUse,
+		ExpiresAt:       expiresAt,
+		Status:          CONSENT_ACTIVE,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if previous, err := readConsent(ctx, datasetID); err == nil {
+		consent.CreatedAt = previous.CreatedAt
+	}
+	if err := putConsent(ctx, key, consent); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: dataset=%s purposes=%v secondaryUse=%t expiresAt=%s",
+		method, datasetID, purposes, secondaryUse, expiresAt)
+	return consent, nil
+}
+
+// WithdrawConsent records that consent for a dataset was withdrawn. No
+// further queries are accepted until a new consent is recorded.
+func (s *ConsentContract) WithdrawConsent(
+	ctx TransactionContextInterface,
+	datasetID string,
+	note string,
+) (*Consent, error) {
+	method := "WithdrawConsent"
+
+	if _, _, err := readOwnedDataset(ctx, datasetID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	consent, err := readConsent(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if consent.Status == CONSENT_WITHDRAWN {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: consent for dataset %s is already %s", method, datasetID, CONSENT_WITHDRAWN)
+	}
+
+	consent.Status = CONSENT_WITHDRAWN
+	consent.StatusNote = note
+	consent.UpdatedAt = ctx.GetTimestamp()
+	key, err := consentKey(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	if err := putConsent(ctx, key, consent); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: dataset=%s", method, datasetID)
+	return consent, nil
+}
+
+// ---------------------------------------------------------------------------
+// Read / query operations
+// ---------------------------------------------------------------------------
+
+// GetConsent returns the current consent of a dataset.
+func (s *ConsentContract) GetConsent(
+	ctx TransactionContextInterface,
+	datasetID string,
+) (*Consent, error) {
+	return readConsent(ctx, datasetID)
+}
+
+// GetConsentHistory returns every consent scope recorded for a dataset,
+// oldest first.
+func (s *ConsentContract) GetConsentHistory(
+	ctx TransactionContextInterface,
+	datasetID string,
+) ([]*Consent, error) {
+	method := "GetConsentHistory"
+
+	key, err := consentKey(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	iter, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	history := []*Consent{}
+	for iter.HasNext() {
+		mod, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		if mod.IsDelete {
+			continue
+		}
+		c, _, err := decodeConsent(mod.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+		}
+		history = append(history, c)
+	}
+	// Fabric returns history newest first.
+	slices.Reverse(history)
+	return history, nil
+}
+
+// CheckConsent reports whether the current consent of a dataset covers the
+// given purpose. It returns the reason when it does not.
+func (s *ConsentContract) CheckConsent(
+	ctx TransactionContextInterface,
+	datasetID string,
+	purpose string,
+) (*ConsentCheck, error) {
+	check := &ConsentCheck{DatasetID: datasetID, Purpose: purpose, Covered: true}
+	def, err := assertPurposeActive(ctx, purpose)
+	if err == nil {
+		err = assertConsentCovers(ctx, datasetID, def)
+	}
+	if err != nil {
+		check.Covered = false
+		check.Reason = err.Error()
+	}
+	return check, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// assertConsentCovers rejects a purpose that the dataset's current consent
+// does not cover: no consent recorded, consent withdrawn or expired, or a
+// purpose outside AllowedPurposes that is not a secondary use consented to.
+func assertConsentCovers(ctx TransactionContextInterface, datasetID string, purpose *Purpose) error {
+	consent, err := readConsent(ctx, datasetID)
+	if err != nil {
+		return err
+	}
+	if consent.Status != CONSENT_ACTIVE {
+		return codedErrorf(ERR_NOT_ACTIVE, "consent for dataset %s is %s", datasetID, consent.Status)
+	}
+	if consent.ExpiresAt != "" {
+		expiry, err := time.Parse(time.RFC3339, consent.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("consent for dataset %s has invalid expiry: %v", datasetID, err)
+		}
+		now, err := txTime(ctx)
+		if err != nil {
+			return err
+		}
+		if !now.Before(expiry) {
+			return codedErrorf(ERR_NOT_ACTIVE, "consent for dataset %s expired at %s", datasetID, consent.ExpiresAt)
+		}
+	}
+	if slices.Contains(consent.AllowedPurposes, purpose.PurposeID) {
+		return nil
+	}
+	if !purpose.SecondaryUse || !consent.SecondaryUse {
+		return codedErrorf(ERR_PURPOSE_NOT_ALLOWED, "purpose %q is not covered by consent for dataset %s", purpose.PurposeID, datasetID)
+	}
+	return nil
+}
+
+// readConsent fetches and unmarshals the Consent of a dataset.
+func readConsent(ctx TransactionContextInterface, datasetID string) (*Consent, error) {
+	key, err := consentKey(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("readConsent: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("readConsent: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, codedErrorf(ERR_NOT_FOUND, "readConsent: no consent recorded for dataset %s", datasetID)
+	}
+
+	consent, _, err := decodeConsent(raw)
+	if err != nil {
+		return nil, fmt.Errorf("readConsent: unmarshal error: %v", err)
+	}
+	return consent, nil
+}
+
+// putConsent marshals and stores a Consent.
+func putConsent(ctx TransactionContextInterface, key string, consent *Consent) error {
+	data, err := json.Marshal(consent)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("put error: %v", err)
+	}
+	return nil
+}
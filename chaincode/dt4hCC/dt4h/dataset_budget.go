@@ -0,0 +1,161 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// ============================================================================
+// Dataset-level budgets – total epsilon cap per dataset across all users
+// ============================================================================
+
+// datasetBudgetKey returns the primary composite key for a DatasetBudget.
+func datasetBudgetKey(ctx TransactionContextInterface, datasetID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(DATASET_BUDGET_OBJECT_TYPE, []string{datasetID})
+}
+
+// SetDatasetBudget sets the total epsilon that may be spent on a dataset by
+// all users together. Queries on datasets derived from it are charged
+// against this cap too. The cap may be raised or lowered, but not below
+// what has already been spent. Only the owning MSP may set it.
+func (s *PrivacyBudgetContract) SetDatasetBudget(
+	ctx TransactionContextInterface,
+	datasetID string,
+	totalEpsilon float64,
+) (*DatasetBudget, error) {
+	method := "SetDatasetBudget"
+
+	if _, _, err := readOwnedDataset(ctx, datasetID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if totalEpsilon <= 0 {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: totalEpsilon must be > 0, got %f", method, totalEpsilon)
+	}
+
+	now := ctx.GetTimestamp()
+	budget, err := readDatasetBudget(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if budget == nil {
+		budget = &DatasetBudget{
+			ObjectType:    DATASET_BUDGET_OBJECT_TYPE,
+			SchemaVersion: DATASET_BUDGET_SCHEMA_VERSION,
+			DatasetID:     datasetID,
+			CreatedAt:     now,
+		}
+	}
+	if totalEpsilon < budget.ConsumedBudget {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: totalEpsilon (%f) must be >= consumed (%f)", method, totalEpsilon, budget.ConsumedBudget)
+	}
+	budget.TotalBudget = totalEpsilon
+	budget.SetBy = ctx.GetMspID()
+	budget.UpdatedAt = now
+	if err := putDatasetBudget(ctx, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: dataset=%s total=%f", method, datasetID, totalEpsilon)
+	return budget, nil
+}
+
+// GetDatasetBudget returns the dataset-level budget of a dataset.
+func (s *PrivacyBudgetContract) GetDatasetBudget(
+	ctx TransactionContextInterface,
+	datasetID string,
+) (*DatasetBudget, error) {
+	method := "GetDatasetBudget"
+
+	budget, err := readDatasetBudget(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if budget == nil {
+		return nil, codedErrorf(ERR_NOT_FOUND, "%s: no dataset-level budget set for dataset %s", method, datasetID)
+	}
+	return budget, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// chargeLineageBudgets deducts epsilon from the dataset-level budget of a
+// dataset and of every dataset it was derived from. Datasets without a
+// dataset-level budget are not capped. Every budget is checked before any
+// is written, so a shortfall anywhere leaves all of them unchanged.
+func chargeLineageBudgets(ctx TransactionContextInterface, datasetID string, epsilon float64) error {
+	ancestors, err := ancestorIDs(ctx, datasetID)
+	if err != nil {
+		return err
+	}
+
+	var charged []*DatasetBudget
+	for _, id := range append([]string{datasetID}, ancestors...) {
+		budget, err := readDatasetBudget(ctx, id)
+		if err != nil {
+			return err
+		}
+		if budget == nil {
+			continue
+		}
+		if budget.RemainingBudget() < epsilon {
+			if id == datasetID {
+				return codedErrorf(ERR_INSUFFICIENT_BUDGET, "insufficient dataset-level budget for dataset=%s: requested=%f remaining=%f",
+					id, epsilon, budget.RemainingBudget())
+			}
+			return codedErrorf(ERR_INSUFFICIENT_BUDGET, "insufficient dataset-level budget for ancestor dataset=%s of %s: requested=%f remaining=%f",
+				id, datasetID, epsilon, budget.RemainingBudget())
+		}
+		charged = append(charged, budget)
+	}
+
+	now := ctx.GetTimestamp()
+	for _, budget := range charged {
+		budget.ConsumedBudget += epsilon
+		budget.UpdatedAt = now
+		if err := putDatasetBudget(ctx, budget); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDatasetBudget fetches and unmarshals a DatasetBudget. It returns nil
+// without error when no dataset-level budget has been set.
+func readDatasetBudget(ctx TransactionContextInterface, datasetID string) (*DatasetBudget, error) {
+	key, err := datasetBudgetKey(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("readDatasetBudget: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("readDatasetBudget: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	budget, _, err := decodeDatasetBudget(raw)
+	if err != nil {
+		return nil, fmt.Errorf("readDatasetBudget: unmarshal error: %v", err)
+	}
+	return budget, nil
+}
+
+// putDatasetBudget marshals and stores a DatasetBudget.
+func putDatasetBudget(ctx TransactionContextInterface, budget *DatasetBudget) error {
+	key, err := datasetBudgetKey(ctx, budget.DatasetID)
+	if err != nil {
+		return fmt.Errorf("putDatasetBudget: key error: %v", err)
+	}
+	data, err := json.Marshal(budget)
+	if err != nil {
+		return fmt.Errorf("putDatasetBudget: marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("putDatasetBudget: put error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// ============================================================================
+// Dataset Contract – catalogue of datasets with referential integrity
+// ============================================================================
+
+// ---------------------------------------------------------------------------
+// Ledger key helpers
+// ---------------------------------------------------------------------------
+
+// datasetKey returns the primary composite key for a Dataset.
+func datasetKey(ctx TransactionContextInterface, datasetID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(DATASET_OBJECT_TYPE, []string{datasetID})
+}
+
+// datasetOwnerIndexKey creates the index key used to list datasets by owner.
+func datasetOwnerIndexKey(ctx TransactionContextInterface, ownerMSP, datasetID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(INDEX_DATASET_BY_OWNER, []string{ownerMSP, datasetID})
+}
+
+// ---------------------------------------------------------------------------
+// Write operations
+// ---------------------------------------------------------------------------
+
+// RegisterDataset adds a dataset to the catalogue. The caller's MSP becomes
+// the dataset owner; only the owner may update or retire it.
+//
+// Parameters:
+//   - datasetID:        unique identifier budgets and queries refer to
+//   - title:            human-readable name
+//   - sensitivityLevel: one of SENSITIVITY_LEVELS
+//   - recordCount:      number of records in the dataset
+//   - schemaHash:       hash of the dataset's data schema
+func (s *DatasetContract) RegisterDataset(
+	ctx TransactionContextInterface,
+	datasetID string,
+	title string,
+	sensitivityLevel string,
+	recordCount int64,
+	schemaHash string,
+) (*Dataset, error) {
+	method := "RegisterDataset"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if datasetID == "" || title == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: datasetID and title are required", method)
+	}
+	if err := validateDatasetFields(sensitivityLevel, recordCount); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	key, err := datasetKey(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ledger read error: %v", method, err)
+	}
+	if existing != nil {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: dataset %s already exists", method, datasetID)
+	}
+
+	now := ctx.GetTimestamp()
+	dataset := &Dataset{
+		ObjectType:       DATASET_OBJECT_TYPE,
+		SchemaVersion:    DATASET_SCHEMA_VERSION,
+		DatasetID:        datasetID,
+		OwnerMSP:         ctx.GetMspID(),
+		Title:            title,
+		SensitivityLevel: sensitivityLevel,
+		RecordCount:      recordCount,
+		SchemaHash:       schemaHash,
+		Status:           DATASET_ACTIVE,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := putDataset(ctx, key, dataset); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	idx, err := datasetOwnerIndexKey(ctx, dataset.OwnerMSP, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: index key error: %v", method, err)
+	}
+	if err := ctx.GetStub().PutState(idx, []byte{0x00}); err != nil {
+		return nil, fmt.Errorf("%s: index put error: %v", method, err)
+	}
+
+	log.Printf("%s: registered dataset=%s owner=%s", method, datasetID, dataset.OwnerMSP)
+	return dataset, nil
+}
+
+// UpdateDataset changes the descriptive fields of an Active dataset.
+// Only the owning MSP may update it.
+func (s *DatasetContract) UpdateDataset(
+	ctx TransactionContextInterface,
+	datasetID string,
+	title string,
+	sensitivityLevel string,
+	recordCount int64,
+	schemaHash string,
+) (*Dataset, error) {
+	method := "UpdateDataset"
+
+	dataset, key, err := readOwnedDataset(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if dataset.Status != DATASET_ACTIVE {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: dataset %s is %s", method, datasetID, dataset.Status)
+	}
+	if title == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: title is required", method)
+	}
+	if err := validateDatasetFields(sensitivityLevel, recordCount); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	dataset.Title = title
+	dataset.SensitivityLevel = sensitivityLevel
+	dataset.RecordCount = recordCount
+	dataset.SchemaHash = schemaHash
+	dataset.UpdatedAt = ctx.GetTimestamp()
+	if err := putDataset(ctx, key, dataset); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: updated dataset=%s", method, datasetID)
+	return dataset, nil
+}
+
+// RetireDataset withdraws a dataset from use. Existing budgets and logs are
+// kept for auditing, but no new budgets can be created and no further
+// queries are accepted. Retirement is terminal.
+func (s *DatasetContract) RetireDataset(
+	ctx TransactionContextInterface,
+	datasetID string,
+) (*Dataset, error) {
+	method := "RetireDataset"
+
+	dataset, key, err := readOwnedDataset(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if dataset.Status == DATASET_RETIRED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: dataset %s is already %s", method, datasetID, DATASET_RETIRED)
+	}
+
+	dataset.Status = DATASET_RETIRED
+	dataset.UpdatedAt = ctx.GetTimestamp()
+	if err := putDataset(ctx, key, dataset); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: retired dataset=%s", method, datasetID)
+	return dataset, nil
+}
+
+// SetDatasetWarningThresholds sets the default warning thresholds of the
+// budgets on a dataset. thresholdsJSON is a JSON array of percentages in
+// (0, 100), ascending, e.g. "[50,80,95]"; "[]" removes them. Budgets with
+// their own thresholds keep them, and existing budgets pick up the new
+// level on their next charge. Only the owning MSP may set them.
+func (s *DatasetContract) SetDatasetWarningThresholds(
+	ctx TransactionContextInterface,
+	datasetID string,
+	thresholdsJSON string,
+) (*Dataset, error) {
+	method := "SetDatasetWarningThresholds"
+
+	dataset, key, err := readOwnedDataset(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if dataset.Status != DATASET_ACTIVE {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: dataset %s is %s", method, datasetID, dataset.Status)
+	}
+	thresholds, err := parseWarningThresholds(thresholdsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	dataset.WarningThresholds = thresholds
+	dataset.UpdatedAt = ctx.GetTimestamp()
+	if err := putDataset(ctx, key, dataset); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: dataset=%s thresholds=%v", method, datasetID, thresholds)
+	return dataset, nil
+}
+
+// ---------------------------------------------------------------------------
+// Read / query operations
+// ---------------------------------------------------------------------------
+
+// GetDataset returns a catalogue entry.
+func (s *DatasetContract) GetDataset(
+	ctx TransactionContextInterface,
+	datasetID string,
+) (*Dataset, error) {
+	dataset, _, err := readDataset(ctx, datasetID)
+	return dataset, err
+}
+
+// ListDatasets returns the whole catalogue.
+func (s *DatasetContract) ListDatasets(
+	ctx TransactionContextInterface,
+) ([]*Dataset, error) {
+	return s.SearchDatasets(ctx, EMPTY_STR, EMPTY_STR, EMPTY_STR, EMPTY_STR)
+}
+
+// GetDatasetsByOwner returns every dataset registered by an MSP.
+func (s *DatasetContract) GetDatasetsByOwner(
+	ctx TransactionContextInterface,
+	ownerMSP string,
+) ([]*Dataset, error) {
+	method := "GetDatasetsByOwner"
+
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(INDEX_DATASET_BY_OWNER, []string{ownerMSP})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	datasets := []*Dataset{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		_, parts, err := ctx.GetStub().SplitCompositeKey(kv.Key)
+		if err != nil || len(parts) < 2 {
+			continue
+		}
+		dataset, _, err := readDataset(ctx, parts[1])
+		if err != nil {
+			continue
+		}
+		datasets = append(datasets, dataset)
+	}
+	return datasets, nil
+}
+
+// SearchDatasets filters the catalogue. Every filter is optional; pass ""
+// to ignore it. titleContains matches case-insensitively.
+func (s *DatasetContract) SearchDatasets(
+	ctx TransactionContextInterface,
+	ownerMSP string,
+	sensitivityLevel string,
+	status string,
+	titleContains string,
+) ([]*Dataset, error) {
+	method := "SearchDatasets"
+
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(DATASET_OBJECT_TYPE, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	needle := strings.ToLower(titleContains)
+	datasets := []*Dataset{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		dataset, _, err := decodeDataset(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+		}
+		if (ownerMSP != "" && dataset.OwnerMSP != ownerMSP) ||
+			(sensitivityLevel != "" && dataset.SensitivityLevel != sensitivityLevel) ||
+			(status != "" && dataset.Status != status) ||
+			(needle != "" && !strings.Contains(strings.ToLower(dataset.Title), needle)) {
+			continue
+		}
+		datasets = append(datasets, dataset)
+	}
+	return datasets, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// assertDatasetActive rejects references to datasets that are not
+// registered or have been retired.
+func assertDatasetActive(ctx TransactionContextInterface, datasetID string) error {
+	dataset, _, err := readDataset(ctx, datasetID)
+	if err != nil {
+		return err
+	}
+	if dataset.Status != DATASET_ACTIVE {
+		return codedErrorf(ERR_NOT_ACTIVE, "dataset %s is %s", datasetID, dataset.Status)
+	}
+	return nil
+}
+
+// validateDatasetFields checks the descriptive fields shared by register and
+// update.
+func validateDatasetFields(sensitivityLevel string, recordCount int64) error {
+	if !slices.Contains(SENSITIVITY_LEVELS, sensitivityLevel) {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "invalid sensitivity level %q, expected one of %v", sensitivityLevel, SENSITIVITY_LEVELS)
+	}
+	if recordCount < 0 {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "recordCount must be >= 0, got %d", recordCount)
+	}
+	return nil
+}
+
+// readDataset fetches and unmarshals a Dataset from the ledger.
+func readDataset(ctx TransactionContextInterface, datasetID string) (*Dataset, string, error) {
+	key, err := datasetKey(ctx, datasetID)
+	if err != nil {
+		return nil, "", fmt.Errorf("readDataset: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("readDataset: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, "", codedErrorf(ERR_NOT_FOUND, "readDataset: dataset %s is not registered", datasetID)
+	}
+
+	dataset, _, err := decodeDataset(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("readDataset: unmarshal error: %v", err)
+	}
+	return dataset, key, nil
+}
+
+// readOwnedDataset reads a dataset and checks that the caller's MSP owns it.
+func readOwnedDataset(ctx TransactionContextInterface, datasetID string) (*Dataset, string, error) {
+	dataset, key, err := readDataset(ctx, datasetID)
+	if err != nil {
+		return nil, "", err
+	}
+	if dataset.OwnerMSP != ctx.GetMspID() {
+		return nil, "", codedErrorf(ERR_UNAUTHORIZED, "dataset %s is owned by %s, caller is %s", datasetID, dataset.OwnerMSP, ctx.GetMspID())
+	}
+	return dataset, key, nil
+}
+
+// putDataset marshals and stores a Dataset.
+func putDataset(ctx TransactionContextInterface, key string, dataset *Dataset) error {
+	data, err := json.Marshal(dataset)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("put error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package dt4h
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// ============================================================================
+// Erasure Contract – GDPR right to erasure for query logs
+// ============================================================================
+
+// erasureCertificateKey returns the primary composite key for an
+// ErasureCertificate.
+func erasureCertificateKey(ctx TransactionContextInterface, certificateID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(ERASURE_CERTIFICATE_OBJECT_TYPE, []string{certificateID})
+}
+
+// EraseUserRecords removes a budget holder's personal data from the world
+// state while keeping the ε accounting that the privacy guarantee relies on:
+//   - every budget and consumption log is moved under a salted pseudonym,
+//     the query text is cleared and the budget is revoked
+//   - every query log entry is deleted
+//   - the identity account, its enrollment index and certificate links are
+//     deleted, so no mapping from certificate to pseudonym survives
+//   - the researcher profile and its project memberships are deleted
+//   - the user is replaced by the pseudonym in data use agreement parties
+//
+// The caller must pass a secret salt of at least ERASURE_MIN_SALT_BYTES in
+// the transient map under ERASURE_SALT_TRANSIENT_KEY. The pseudonym and the
+// certificate's subject digest are derived from it, so neither can be linked
+// back to the user without the salt.
+//
+// Only an administrator of the MSP that manages the user may erase them: the
+// MSP that registered the researcher profile and the MSP of the identity
+// account, whichever exist. A user with neither has to be registered first.
+//
+// The block store still contains the original transactions; erasure applies
+// to the world state that queries are served from.
+func (s *ErasureContract) EraseUserRecords(
+	ctx TransactionContextInterface,
+	userID string,
+	requestRef string,
+) (*ErasureCertificate, error) {
+	method := "EraseUserRecords"
+
+	if err := assertAdmin(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if userID == "" || requestRef == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: userID and requestRef are required", method)
+	}
+	if err := assertManagesUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("%s: transient read error: %v", method, err)
+	}
+	salt := transient[ERASURE_SALT_TRANSIENT_KEY]
+	if len(salt) < ERASURE_MIN_SALT_BYTES {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: transient %q must hold at least %d bytes", method, ERASURE_SALT_TRANSIENT_KEY, ERASURE_MIN_SALT_BYTES)
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	pseudonym := "erased:" + saltedDigest(salt, []byte(txID), []byte(userID))[:32]
+
+	cert := &ErasureCertificate{
+		ObjectType:    ERASURE_CERTIFICATE_OBJECT_TYPE,
+		SchemaVersion: ERASURE_SCHEMA_VERSION,
+		CertificateID: txID,
+		RequestRef:    requestRef,
+		SubjectDigest: saltedDigest(salt, []byte(userID)),
+		DatasetIDs:    []string{},
+		ErasedBy:      ctx.GetMspID(),
+		ErasedAt:      ctx.GetTimestamp(),
+	}
+
+	// ---------- budgets and consumption logs ----------
+	budgets := new(PrivacyBudgetContract)
+	held, err := budgets.GetBudgetsByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	for _, budget := range held {
+		if err := moveStatsShard(ctx, budget.DatasetID, userID, pseudonym); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		logs, err := budgets.GetConsumptionLogs(ctx, userID, budget.DatasetID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		// Number entries logged before v5 while all of them are still in
+		// place, as MigrateRecords would; writeLog files them under it.
+		sequences := make([]int, len(logs))
+		for i, entry := range logs {
+			sequences[i] = entry.Sequence
+			if entry.Sequence == 0 {
+				if sequences[i], err = legacyLogSequence(ctx, entry); err != nil {
+					return nil, fmt.Errorf("%s: %v", method, err)
+				}
+			}
+		}
+		for i, entry := range logs {
+			if err := budgets.deleteLog(ctx, entry); err != nil {
+				return nil, fmt.Errorf("%s: %v", method, err)
+			}
+			entry.Sequence = sequences[i]
+			entry.UserID = pseudonym
+			entry.QueryBody = EMPTY_STR
+			entry.Erased = true
+			if err := budgets.writeLog(ctx, entry); err != nil {
+				return nil, fmt.Errorf("%s: %v", method, err)
+			}
+			cert.ConsumptionLogsAnonymised++
+		}
+
+		if err := budgets.deleteBudget(ctx, budget, pseudonym); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		budget.UserID = pseudonym
+		if budget.Status != BUDGET_REVOKED {
+			if err := transitionBudget(budget, BUDGET_REVOKED, REASON_ERASURE, requestRef); err != nil {
+				return nil, fmt.Errorf("%s: %v", method, err)
+			}
+		}
+		budget.UpdatedAt = cert.ErasedAt
+		if err := budgets.putBudgetWithIndexes(ctx, budget); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+
+		cert.BudgetsAnonymised++
+		cert.DatasetIDs = append(cert.DatasetIDs, budget.DatasetID)
+		cert.EpsilonPreserved += budget.ConsumedBudget
+	}
+
+	// ---------- query logs ----------
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(QUERY_LOG_OBJECT_TYPE, []string{userID})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	var queries []*Query
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			iter.Close()
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		q, _, err := decodeQuery(kv.Value)
+		if err != nil {
+			iter.Close()
+			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+		}
+		queries = append(queries, q)
+	}
+	iter.Close()
+	for _, q := range queries {
+		if err := deleteQuery(ctx, userID, q); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+	}
+	cert.QueryLogsDeleted = len(queries)
+
+	// ---------- identity mapping and profile ----------
+	deleted, err := deleteAccount(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	cert.IdentityRecordsDeleted = deleted
+
+	deleted, err = deleteResearcher(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	cert.IdentityRecordsDeleted += deleted
+
+	// ---------- data use agreements ----------
+	if err := replaceAgreementParty(ctx, userID, pseudonym); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	// ---------- certificate ----------
+	key, err := erasureCertificateKey(ctx, cert.CertificateID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	data, err := json.Marshal(cert)
+	if err != nil {
+		return nil, fmt.Errorf("%s: marshal error: %v", method, err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return nil, fmt.Errorf("%s: put error: %v", method, err)
+	}
+
+	log.Printf("%s: erased request=%s budgets=%d logs=%d queries=%d identity=%d",
+		method, requestRef, cert.BudgetsAnonymised, cert.ConsumptionLogsAnonymised,
+		cert.QueryLogsDeleted, cert.IdentityRecordsDeleted)
+	return cert, nil
+}
+
+// assertManagesUser rejects callers whose MSP does not manage userID. The
+// researcher profile records the MSP that registered the user and the
+// identity account the MSP it belongs to; both must be the caller's, and at
+// least one must exist.
+func assertManagesUser(ctx TransactionContextInterface, userID string) error {
+	managed := false
+
+	key, err := researcherKey(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("assertManagesUser: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("assertManagesUser: ledger read error: %v", err)
+	}
+	if raw != nil {
+		researcher, _, err := decodeResearcher(raw)
+		if err != nil {
+			return fmt.Errorf("assertManagesUser: unmarshal error: %v", err)
+		}
+		if err := assertRegisteredBy(ctx, researcher); err != nil {
+			return err
+		}
+		managed = true
+	}
+
+	key, err = accountKey(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("assertManagesUser: key error: %v", err)
+	}
+	raw, err = ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("assertManagesUser: ledger read error: %v", err)
+	}
+	if raw != nil {
+		account, _, err := decodeAccount(raw)
+		if err != nil {
+			return fmt.Errorf("assertManagesUser: unmarshal error: %v", err)
+		}
+		if account.MspID != ctx.GetMspID() {
+			return codedErrorf(ERR_UNAUTHORIZED, "unauthorized: account %s belongs to %s", userID, account.MspID)
+		}
+		managed = true
+	}
+
+	if !managed {
+		return codedErrorf(ERR_NOT_FOUND, "assertManagesUser: user %s has no researcher profile or identity account", userID)
+	}
+	return nil
+}
+
+// GetErasureCertificate returns the certificate written by EraseUserRecords.
+// The certificate ID is the transaction ID of the erasure.
+func (s *ErasureContract) GetErasureCertificate(
+	ctx TransactionContextInterface,
+	certificateID string,
+) (*ErasureCertificate, error) {
+	method := "GetErasureCertificate"
+
+	key, err := erasureCertificateKey(ctx, certificateID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ledger read error: %v", method, err)
+	}
+	if raw == nil {
+		return nil, codedErrorf(ERR_NOT_FOUND, "%s: no erasure certificate %s", method, certificateID)
+	}
+
+	cert, _, err := decodeErasureCertificate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+	}
+	return cert, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// saltedDigest returns the hex SHA-256 of salt followed by each part.
+func saltedDigest(salt []byte, parts ...[]byte) string {
+	h := sha256.New()
+	h.Write(salt)
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// deleteAccount removes the identity account held under accountID together
+// with its enrollment index and certificate links. It returns the number of
+// records deleted (0 when no account exists).
+func deleteAccount(ctx TransactionContextInterface, accountID string) (int, error) {
+	key, err := accountKey(ctx, accountID)
+	if err != nil {
+		return 0, fmt.Errorf("deleteAccount: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("deleteAccount: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return 0, nil
+	}
+	account, _, err := decodeAccount(raw)
+	if err != nil {
+		return 0, fmt.Errorf("deleteAccount: unmarshal error: %v", err)
+	}
+
+	keys := []string{key}
+	idx, err := accountEnrollmentIndexKey(ctx, account.MspID, account.EnrollmentID, accountID)
+	if err != nil {
+		return 0, fmt.Errorf("deleteAccount: index key error: %v", err)
+	}
+	keys = append(keys, idx)
+	for _, certID := range account.LinkedIDs {
+		lk, err := identityLinkKey(ctx, certID)
+		if err != nil {
+			return 0, fmt.Errorf("deleteAccount: key error: %v", err)
+		}
+		keys = append(keys, lk)
+	}
+
+	for _, k := range keys {
+		if err := ctx.GetStub().DelState(k); err != nil {
+			return 0, fmt.Errorf("deleteAccount: delete error: %v", err)
+		}
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,119 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ============================================================================
+// Chaincode events – budget changes published to client applications
+// ============================================================================
+//
+// Contract functions queue typed events on the transaction context as they
+// change budgets. AfterTransaction, run by contractapi once the function has
+// succeeded, publishes them together under BUDGET_EVENT_NAME: Fabric keeps
+// only the last SetEvent of a transaction, and calling it once avoids
+// re-encoding the envelope on every change of a large batch.
+
+// AfterTransaction is the hook executed after every successful chaincode
+// function. It publishes the events the function queued, if any, as one
+// EventEnvelope.
+func AfterTransaction(ctx TransactionContextInterface) error {
+	method := "AfterTransaction"
+
+	events := ctx.GetEvents()
+	if len(events) == 0 {
+		return nil
+	}
+	// The envelope is part of the endorsed result, so every endorser has to
+	// produce the same timestamp: the transaction's, not the local clock.
+	at, err := txTime(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	envelope := &EventEnvelope{
+		SchemaVersion: EVENT_ENVELOPE_VERSION,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     at.UTC().Format(time.RFC3339),
+		MspID:         ctx.GetMspID(),
+		Events:        events,
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("%s: marshal error: %v", method, err)
+	}
+	if err := ctx.GetStub().SetEvent(BUDGET_EVENT_NAME, data); err != nil {
+		return fmt.Errorf("%s: set event error: %v", method, err)
+	}
+
+	log.Printf("%s: published %d events", method, len(events))
+	return nil
+}
+
+// emitEvent queues an event with the current payload version.
+func emitEvent(ctx TransactionContextInterface, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("emitEvent: marshal error: %v", err)
+	}
+	ctx.AddEvent(&ChaincodeEvent{Type: eventType, Version: EVENT_PAYLOAD_VERSION, Payload: data})
+	return nil
+}
+
+// emitBudgetChange queues the events for a budget write. before is the
+// stored budget (nil when it is being created), after the new one.
+// Consumption itself is reported by ConsumeBudget; only the exhaustion it
+// may cause is derived here.
+func emitBudgetChange(ctx TransactionContextInterface, before, after *PrivacyBudget) error {
+	payload := &BudgetEventPayload{
+		UserID:            after.UserID,
+		DatasetID:         after.DatasetID,
+		Status:            after.Status,
+		StatusReason:      after.StatusReason,
+		TotalBudget:       after.TotalBudget,
+		ConsumedBudget:    after.ConsumedBudget,
+		RemainingBudget:   after.RemainingBudget(),
+		AgreementID:       after.AgreementID,
+		WarningLevel:      after.WarningLevel,
+		SubjectCommitment: after.SubjectCommitment,
+	}
+
+	var types []string
+	if before == nil {
+		// Erasure re-creates budgets under a pseudonym, already Revoked.
+		if after.Status == BUDGET_REVOKED {
+			types = append(types, EVENT_BUDGET_REVOKED)
+		} else {
+			types = append(types, EVENT_BUDGET_INITIALIZED)
+		}
+	} else {
+		if after.TotalBudget != before.TotalBudget {
+			payload.PreviousTotalBudget = before.TotalBudget
+			types = append(types, EVENT_BUDGET_UPDATED)
+		} else if after.AgreementID != before.AgreementID {
+			types = append(types, EVENT_BUDGET_UPDATED)
+		}
+		if after.Status != before.Status {
+			payload.PreviousStatus = before.Status
+			switch {
+			case after.Status == BUDGET_REVOKED:
+				types = append(types, EVENT_BUDGET_REVOKED)
+			case after.Status == BUDGET_SUSPENDED:
+				types = append(types, EVENT_BUDGET_SUSPENDED)
+			case before.Status == BUDGET_SUSPENDED:
+				types = append(types, EVENT_BUDGET_RESUMED)
+			case after.Status == BUDGET_EXHAUSTED:
+				types = append(types, EVENT_BUDGET_EXHAUSTED)
+			}
+		}
+	}
+
+	for _, t := range types {
+		if err := emitEvent(ctx, t, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,475 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+)
+
+// ============================================================================
+// Identity Contract – keeps budgets attached to a person across certificates
+// ============================================================================
+
+// ---------------------------------------------------------------------------
+// Ledger key helpers
+// ---------------------------------------------------------------------------
+
+// accountKey returns the primary composite key for an IdentityAccount.
+func accountKey(ctx TransactionContextInterface, accountID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(IDENTITY_ACCOUNT_OBJECT_TYPE, []string{accountID})
+}
+
+// identityLinkKey returns the primary composite key for an IdentityLink.
+func identityLinkKey(ctx TransactionContextInterface, certID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(IDENTITY_LINK_OBJECT_TYPE, []string{certID})
+}
+
+// accountEnrollmentIndexKey creates the index key that resolves an
+// (MSP, enrollment ID) pair to its account.
+func accountEnrollmentIndexKey(ctx TransactionContextInterface, mspID, enrollmentID, accountID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(INDEX_ACCOUNT_BY_ENROLLMENT, []string{mspID, enrollmentID, accountID})
+}
+
+// ---------------------------------------------------------------------------
+// Write operations
+// ---------------------------------------------------------------------------
+
+// RegisterAccount creates a stable budget-holder account. Any certificate
+// issued by mspID that carries enrollmentID in its hf.EnrollmentID attribute
+// resolves to accountID from then on, so re-enrolment keeps budgets intact.
+//
+// Administrators of mspID may register accounts of their MSP, but not under
+// the ID of a user registered by another MSP or of a budget holder: every
+// certificate with the enrollment would then spend those budgets. Other
+// callers may only register their own enrollment: mspID and enrollmentID
+// must be those of the calling certificate and accountID the budget holder it
+// resolves to today, so nobody can attach their enrollment to another
+// person's budgets. That is how an existing budget holder keeps their budgets
+// across re-enrolment.
+//
+// Parameters:
+//   - accountID:    the userID budgets are held under; use the person's current
+//     X.509 ID to keep existing budgets reachable
+//   - mspID:        the organization that issued the person's certificates
+//   - enrollmentID: the Fabric CA enrollment ID of the person
+func (s *IdentityContract) RegisterAccount(
+	ctx TransactionContextInterface,
+	accountID string,
+	mspID string,
+	enrollmentID string,
+) (*IdentityAccount, error) {
+	method := "RegisterAccount"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if accountID == "" || mspID == "" || enrollmentID == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: accountID, mspID and enrollmentID are required", method)
+	}
+	if err := assertAdmin(ctx); err == nil {
+		if mspID != ctx.GetMspID() {
+			return nil, codedErrorf(ERR_UNAUTHORIZED, "%s: unauthorized: an administrator of %s cannot register accounts of %s", method, ctx.GetMspID(), mspID)
+		}
+		if err := assertUnclaimedAccountID(ctx, accountID); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+	} else if mspID != ctx.GetMspID() || enrollmentID != ctx.GetEnrollmentID() || accountID != ctx.GetUserID() {
+		return nil, codedErrorf(ERR_UNAUTHORIZED, "%s: unauthorized: only administrators may register an enrollment other than the caller's own", method)
+	}
+
+	key, err := accountKey(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ledger read error: %v", method, err)
+	}
+	if existing != nil {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: account %s already exists", method, accountID)
+	}
+
+	owner, err := accountByEnrollment(ctx, mspID, enrollmentID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if owner != "" {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: enrollment %s/%s already belongs to account %s", method, mspID, enrollmentID, owner)
+	}
+
+	now := ctx.GetTimestamp()
+	account := &IdentityAccount{
+		ObjectType:    IDENTITY_ACCOUNT_OBJECT_TYPE,
+		SchemaVersion: ACCOUNT_SCHEMA_VERSION,
+		AccountID:     accountID,
+		MspID:         mspID,
+		EnrollmentID:  enrollmentID,
+		LinkedIDs:     []string{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := putAccount(ctx, key, account); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	idx, err := accountEnrollmentIndexKey(ctx, mspID, enrollmentID, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: index key error: %v", method, err)
+	}
+	if err := ctx.GetStub().PutState(idx, []byte{0x00}); err != nil {
+		return nil, fmt.Errorf("%s: index put error: %v", method, err)
+	}
+
+	log.Printf("%s: registered account=%s msp=%s enrollment=%s", method, accountID, mspID, enrollmentID)
+	return account, nil
+}
+
+// LinkIdentity attaches an additional X.509 ID to an existing account. It is
+// the admin-approved path for certificates that cannot be matched on
+// enrollment ID (e.g. a reissued identity with a new enrollment ID).
+//
+// Only an administrator of the account's MSP may link, and only a
+// certificate issued by that MSP: mspID names the issuer of certID, and a
+// link is ignored when the certificate is presented under another MSP.
+// A certificate that already holds budgets of its own cannot be linked, as
+// those budgets would silently become unreachable.
+func (s *IdentityContract) LinkIdentity(
+	ctx TransactionContextInterface,
+	certID string,
+	mspID string,
+	accountID string,
+) (*IdentityAccount, error) {
+	method := "LinkIdentity"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertAdmin(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if certID == "" || certID == accountID {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: certID must be set and differ from the account ID", method)
+	}
+
+	account, key, err := readAccount(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if mspID != account.MspID {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: certificate MSP %s does not match account MSP %s", method, mspID, account.MspID)
+	}
+	if ctx.GetMspID() != account.MspID {
+		return nil, codedErrorf(ERR_UNAUTHORIZED, "%s: unauthorized: an administrator of %s cannot link identities of %s", method, ctx.GetMspID(), account.MspID)
+	}
+
+	link, linkKey, err := readIdentityLink(ctx, certID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if link != nil {
+		if link.AccountID == accountID {
+			return account, nil
+		}
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: certificate already linked to account %s", method, link.AccountID)
+	}
+
+	ownsBudgets, err := holdsBudgets(ctx, certID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if ownsBudgets {
+		return nil, fmt.Errorf("%s: certificate %s holds budgets of its own and cannot be linked", method, certID)
+	}
+
+	link = &IdentityLink{
+		ObjectType:    IDENTITY_LINK_OBJECT_TYPE,
+		SchemaVersion: LINK_SCHEMA_VERSION,
+		CertID:        certID,
+		AccountID:     accountID,
+		ApprovedBy:    ctx.GetMspID(),
+		LinkedAt:      ctx.GetTimestamp(),
+	}
+	data, err := json.Marshal(link)
+	if err != nil {
+		return nil, fmt.Errorf("%s: marshal error: %v", method, err)
+	}
+	if err := ctx.GetStub().PutState(linkKey, data); err != nil {
+		return nil, fmt.Errorf("%s: put error: %v", method, err)
+	}
+
+	account.LinkedIDs = append(account.LinkedIDs, certID)
+	account.UpdatedAt = link.LinkedAt
+	if err := putAccount(ctx, key, account); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: linked cert=%s to account=%s", method, certID, accountID)
+	return account, nil
+}
+
+// UnlinkIdentity removes an admin-approved link, e.g. when a certificate was
+// linked by mistake or has been compromised. Like LinkIdentity it requires an
+// administrator.
+func (s *IdentityContract) UnlinkIdentity(
+	ctx TransactionContextInterface,
+	certID string,
+) error {
+	method := "UnlinkIdentity"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertAdmin(ctx); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+
+	link, linkKey, err := readIdentityLink(ctx, certID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if link == nil {
+		return codedErrorf(ERR_NOT_FOUND, "%s: certificate %s is not linked", method, certID)
+	}
+	if err := ctx.GetStub().DelState(linkKey); err != nil {
+		return fmt.Errorf("%s: delete error: %v", method, err)
+	}
+
+	account, key, err := readAccount(ctx, link.AccountID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	account.LinkedIDs = slices.DeleteFunc(account.LinkedIDs, func(id string) bool { return id == certID })
+	account.UpdatedAt = ctx.GetTimestamp()
+	if err := putAccount(ctx, key, account); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: unlinked cert=%s from account=%s", method, certID, link.AccountID)
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Read / query operations
+// ---------------------------------------------------------------------------
+
+// GetAccount returns an IdentityAccount by its account ID.
+func (s *IdentityContract) GetAccount(
+	ctx TransactionContextInterface,
+	accountID string,
+) (*IdentityAccount, error) {
+	account, _, err := readAccount(ctx, accountID)
+	return account, err
+}
+
+// ResolveIdentity reports which account a certificate would resolve to.
+// It lets administrators check a link before or after approving it.
+func (s *IdentityContract) ResolveIdentity(
+	ctx TransactionContextInterface,
+	certID string,
+	mspID string,
+	enrollmentID string,
+) (*IdentityResolution, error) {
+	accountID, via, err := resolveAccountID(ctx, certID, mspID, enrollmentID)
+	if err != nil {
+		return nil, fmt.Errorf("ResolveIdentity: %v", err)
+	}
+	return &IdentityResolution{
+		CertID:       certID,
+		AccountID:    accountID,
+		MspID:        mspID,
+		EnrollmentID: enrollmentID,
+		ResolvedVia:  via,
+	}, nil
+}
+
+// GetMyIdentity returns how the caller's own certificate was resolved.
+func (s *IdentityContract) GetMyIdentity(
+	ctx TransactionContextInterface,
+) (*IdentityResolution, error) {
+	return &IdentityResolution{
+		CertID:       ctx.GetCertID(),
+		AccountID:    ctx.GetUserID(),
+		MspID:        ctx.GetMspID(),
+		EnrollmentID: ctx.GetEnrollmentID(),
+		ResolvedVia:  ctx.GetResolvedVia(),
+	}, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// resolveAccountID maps a certificate to its budget holder. An explicit
+// IdentityLink wins if the certificate comes from the account's MSP, then an
+// account registered for the (MSP, enrollment ID) pair; otherwise the
+// certificate's own X.509 ID is the budget holder.
+func resolveAccountID(
+	ctx TransactionContextInterface,
+	certID, mspID, enrollmentID string,
+) (string, string, error) {
+	link, _, err := readIdentityLink(ctx, certID)
+	if err != nil {
+		return "", "", err
+	}
+	if link != nil {
+		accountMSP, err := accountMspID(ctx, link.AccountID)
+		if err != nil {
+			return "", "", err
+		}
+		if accountMSP == mspID {
+			return link.AccountID, RESOLVED_VIA_LINK, nil
+		}
+	}
+
+	if enrollmentID != "" {
+		accountID, err := accountByEnrollment(ctx, mspID, enrollmentID)
+		if err != nil {
+			return "", "", err
+		}
+		if accountID != "" {
+			return accountID, RESOLVED_VIA_ENROLLMENT, nil
+		}
+	}
+
+	return certID, RESOLVED_VIA_CERTIFICATE, nil
+}
+
+// assertUnclaimedAccountID rejects an account ID that an administrator may
+// not register: that of a user registered by another MSP, or of a holder of
+// budgets.
+func assertUnclaimedAccountID(ctx TransactionContextInterface, accountID string) error {
+	key, err := researcherKey(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("assertUnclaimedAccountID: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("assertUnclaimedAccountID: ledger read error: %v", err)
+	}
+	if raw != nil {
+		researcher, _, err := decodeResearcher(raw)
+		if err != nil {
+			return fmt.Errorf("assertUnclaimedAccountID: unmarshal error: %v", err)
+		}
+		if researcher.RegisteredBy != ctx.GetMspID() {
+			return codedErrorf(ERR_UNAUTHORIZED, "unauthorized: user %s is registered by %s", accountID, researcher.RegisteredBy)
+		}
+	}
+	owns, err := holdsBudgets(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("assertUnclaimedAccountID: %v", err)
+	}
+	if owns {
+		return codedErrorf(ERR_UNAUTHORIZED, "unauthorized: %s holds budgets; only its holder may register it as an account", accountID)
+	}
+	return nil
+}
+
+// holdsBudgets reports whether any budget is held under userID.
+func holdsBudgets(ctx TransactionContextInterface, userID string) (bool, error) {
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(INDEX_BUDGET_BY_USER, []string{userID})
+	if err != nil {
+		return false, fmt.Errorf("holdsBudgets: %v", err)
+	}
+	defer iter.Close()
+	return iter.HasNext(), nil
+}
+
+// accountByEnrollment returns the account registered for an (MSP, enrollment
+// ID) pair, or "" if there is none.
+func accountByEnrollment(ctx TransactionContextInterface, mspID, enrollmentID string) (string, error) {
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(INDEX_ACCOUNT_BY_ENROLLMENT, []string{mspID, enrollmentID})
+	if err != nil {
+		return "", fmt.Errorf("accountByEnrollment: %v", err)
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return "", fmt.Errorf("accountByEnrollment: iterator error: %v", err)
+		}
+		_, parts, err := ctx.GetStub().SplitCompositeKey(kv.Key)
+		if err != nil || len(parts) < 3 {
+			continue
+		}
+		return parts[2], nil
+	}
+	return "", nil
+}
+
+// accountMspID returns the MSP of an account, or "" if it does not exist.
+func accountMspID(ctx TransactionContextInterface, accountID string) (string, error) {
+	key, err := accountKey(ctx, accountID)
+	if err != nil {
+		return "", fmt.Errorf("accountMspID: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", fmt.Errorf("accountMspID: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return "", nil
+	}
+	account, _, err := decodeAccount(raw)
+	if err != nil {
+		return "", fmt.Errorf("accountMspID: unmarshal error: %v", err)
+	}
+	return account.MspID, nil
+}
+
+// readAccount fetches and unmarshals an IdentityAccount from the ledger.
+func readAccount(ctx TransactionContextInterface, accountID string) (*IdentityAccount, string, error) {
+	key, err := accountKey(ctx, accountID)
+	if err != nil {
+		return nil, "", fmt.Errorf("readAccount: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("readAccount: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, "", codedErrorf(ERR_NOT_FOUND, "readAccount: no account found for %s", accountID)
+	}
+
+	account, _, err := decodeAccount(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("readAccount: unmarshal error: %v", err)
+	}
+	return account, key, nil
+}
+
+// readIdentityLink fetches the link for a certificate. It returns a nil link
+// (and no error) when the certificate is not linked.
+func readIdentityLink(ctx TransactionContextInterface, certID string) (*IdentityLink, string, error) {
+	key, err := identityLinkKey(ctx, certID)
+	if err != nil {
+		return nil, "", fmt.Errorf("readIdentityLink: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("readIdentityLink: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, key, nil
+	}
+
+	link, _, err := decodeIdentityLink(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("readIdentityLink: unmarshal error: %v", err)
+	}
+	return link, key, nil
+}
+
+// putAccount marshals and stores an IdentityAccount.
+func putAccount(ctx TransactionContextInterface, key string, account *IdentityAccount) error {
+	data, err := json.Marshal(account)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("put error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package dt4h
+
+import "slices"
+
+// ============================================================================
+// Budget lifecycle – the single place where status transitions are decided
+// ============================================================================
+
+// budgetTransitions lists, for every status, the statuses it may move to.
+// Revoked is terminal.
+var budgetTransitions = map[string][]string{
+	BUDGET_ACTIVE:    {BUDGET_EXHAUSTED, BUDGET_SUSPENDED, BUDGET_REVOKED},
+	BUDGET_EXHAUSTED: {BUDGET_ACTIVE, BUDGET_SUSPENDED, BUDGET_REVOKED},
+	BUDGET_SUSPENDED: {BUDGET_ACTIVE, BUDGET_EXHAUSTED, BUDGET_REVOKED},
+	BUDGET_REVOKED:   {},
+}
+
+// validateTransition rejects any status change not listed in budgetTransitions.
+func validateTransition(from, to string) error {
+	allowed, known := budgetTransitions[from]
+	if !known {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "unknown budget status %q", from)
+	}
+	if !slices.Contains(allowed, to) {
+		return codedErrorf(ERR_NOT_ACTIVE, "illegal status transition %s -> %s", from, to)
+	}
+	return nil
+}
+
+// transitionBudget validates and applies a status change, recording the
+// reason code and note that justify it.
+func transitionBudget(budget *PrivacyBudget, to, reasonCode, note string) error {
+	if err := validateTransition(budget.Status, to); err != nil {
+		return err
+	}
+	budget.Status = to
+	budget.StatusReason = reasonCode
+	budget.StatusNote = note
+	return nil
+}
+
+// settledStatus is the status a budget that is not suspended or revoked
+// should have given its remaining epsilon.
+func settledStatus(budget *PrivacyBudget) string {
+	if budget.RemainingBudget() <= 0 {
+		return BUDGET_EXHAUSTED
+	}
+	return BUDGET_ACTIVE
+}
+
+// validateReasonCode checks a reason code against the allowed set.
+func validateReasonCode(reasonCode string, allowed []string) error {
+	if !slices.Contains(allowed, reasonCode) {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "invalid reason code %q, expected one of %v", reasonCode, allowed)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package dt4h
+
+import (
+	"fmt"
+
+	"github.com/chaincode/dt4hCC/logchain"
+)
+
+// ============================================================================
+// Log hash chain – tamper evidence for consumption logs
+// ============================================================================
+//
+// ConsumeBudget chains every consumption log entry to the one before it and
+// records the head of the chain in the budget; see package logchain for the
+// hash and its checks. Off-chain tools import logchain to verify exported
+// logs without the chaincode shim.
+
+// ensureSubjectCommitment fixes a budget's subject commitment the first time
+// the budget is written. Erasure moves the budget with its commitment, so
+// entries logged before and after pseudonymisation hash the same value.
+func ensureSubjectCommitment(ctx TransactionContextInterface, budget *PrivacyBudget) {
+	if budget.SubjectCommitment == "" {
+		budget.SubjectCommitment = logchain.SubjectCommitment(ctx.GetStub().GetTxID(), budget.UserID, budget.DatasetID)
+	}
+}
+
+// VerifyConsumptionLogs checks the consumption log of a (user, dataset) pair
+// against the hash chain anchored in the budget. A broken chain is reported
+// in the result, not as an error.
+func (s *PrivacyBudgetContract) VerifyConsumptionLogs(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+) (*LogChainReport, error) {
+	method := "VerifyConsumptionLogs"
+
+	budget, _, err := s.readBudget(ctx, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	logs, err := s.GetConsumptionLogs(ctx, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	report := &LogChainReport{
+		UserID:    userID,
+		DatasetID: datasetID,
+		Entries:   len(logs),
+		HeadHash:  budget.LogHeadHash,
+		Valid:     true,
+	}
+	report.ChainedEntries, err = logchain.Verify(logs, budget.LogHeadHash, budget.SubjectCommitment)
+	if err != nil {
+		report.Valid, report.Failure = false, err.Error()
+	}
+	return report, nil
+}
@@ -0,0 +1,242 @@
+package dt4h
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// ============================================================================
+// Migration Contract – upgrades persisted records in place
+// ============================================================================
+
+// recordMigrator upgrades the record stored under key, writing it back when
+// its schema version is behind. It reports whether the record was rewritten.
+type recordMigrator func(ctx TransactionContextInterface, key string, raw []byte) (bool, error)
+
+// recordMigrators maps every primary object type to its migrator and the
+// schema version it upgrades to. Index entries carry no payload and are not
+// listed.
+var recordMigrators = map[string]struct {
+	version int
+	migrate recordMigrator
+}{
+	PRIVACY_BUDGET_OBJECT_TYPE:      {BUDGET_SCHEMA_VERSION, migrateBudget},
+	BUDGET_LOG_OBJECT_TYPE:          {LOG_SCHEMA_VERSION, migrateLog},
+	QUERY_LOG_OBJECT_TYPE:           {QUERY_SCHEMA_VERSION, migrateQuery},
+	IDENTITY_ACCOUNT_OBJECT_TYPE:    {ACCOUNT_SCHEMA_VERSION, rewriteWith(decodeAccount)},
+	IDENTITY_LINK_OBJECT_TYPE:       {LINK_SCHEMA_VERSION, rewriteWith(decodeIdentityLink)},
+	ERASURE_CERTIFICATE_OBJECT_TYPE: {ERASURE_SCHEMA_VERSION, rewriteWith(decodeErasureCertificate)},
+	DATASET_OBJECT_TYPE:             {DATASET_SCHEMA_VERSION, rewriteWith(decodeDataset)},
+	RESEARCHER_OBJECT_TYPE:          {RESEARCHER_SCHEMA_VERSION, rewriteWith(decodeResearcher)},
+	CONSENT_OBJECT_TYPE:             {CONSENT_SCHEMA_VERSION, rewriteWith(decodeConsent)},
+	PURPOSE_OBJECT_TYPE:             {PURPOSE_SCHEMA_VERSION, rewriteWith(decodePurpose)},
+	AGREEMENT_OBJECT_TYPE:           {AGREEMENT_SCHEMA_VERSION, rewriteWith(decodeAgreement)},
+	DERIVATION_OBJECT_TYPE:          {DERIVATION_SCHEMA_VERSION, rewriteWith(decodeDerivation)},
+	DATASET_BUDGET_OBJECT_TYPE:      {DATASET_BUDGET_SCHEMA_VERSION, rewriteWith(decodeDatasetBudget)},
+	DATASET_STATS_OBJECT_TYPE:       {DATASET_STATS_SCHEMA_VERSION, rewriteWith(decodeDatasetStats)},
+}
+
+// rewriteWith builds a migrator that decodes a record with the given
+// version-aware decoder and stores the upgraded form.
+func rewriteWith[T any](decode func([]byte) (*T, bool, error)) recordMigrator {
+	return func(ctx TransactionContextInterface, key string, raw []byte) (bool, error) {
+		record, upgraded, err := decode(raw)
+		if err != nil || !upgraded {
+			return false, err
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return false, fmt.Errorf("marshal error: %v", err)
+		}
+		if err := ctx.GetStub().PutState(key, data); err != nil {
+			return false, fmt.Errorf("put error: %v", err)
+		}
+		return true, nil
+	}
+}
+
+// migrateBudget upgrades a budget through loadBudget, which backfills the
+// query counters and log sequence of older budgets from their consumption
+// logs. The rewrite is a change like any other: it is stamped with the
+// submitting MSP, so the budget's history attributes it to the migration,
+// and fixes the subject commitment of budgets that have none.
+func migrateBudget(ctx TransactionContextInterface, key string, raw []byte) (bool, error) {
+	_, upgraded, err := decodeBudget(raw)
+	if err != nil || !upgraded {
+		return false, err
+	}
+	budget, err := new(PrivacyBudgetContract).loadBudget(ctx, raw)
+	if err != nil {
+		return false, err
+	}
+	budget.UpdatedBy = ctx.GetMspID()
+	ensureSubjectCommitment(ctx, budget)
+	data, err := json.Marshal(budget)
+	if err != nil {
+		return false, fmt.Errorf("marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return false, fmt.Errorf("put error: %v", err)
+	}
+	return true, nil
+}
+
+// migrateLog upgrades a consumption log through writeLog, which also writes
+// the index entries added since the record was stored. Entries logged before
+// v5 are numbered and moved, with their index entries, to their sequence key.
+// That includes entries already at the current version but still without a
+// sequence, as an erasure by an older chaincode left them.
+func migrateLog(ctx TransactionContextInterface, key string, raw []byte) (bool, error) {
+	entry, upgraded, err := decodeLog(raw)
+	if err != nil {
+		return false, err
+	}
+	if !upgraded && entry.Sequence != 0 {
+		return false, nil
+	}
+	budgets := new(PrivacyBudgetContract)
+	if entry.Sequence == 0 {
+		if err := budgets.deleteLog(ctx, entry); err != nil {
+			return false, err
+		}
+		if entry.Sequence, err = legacyLogSequence(ctx, entry); err != nil {
+			return false, err
+		}
+	}
+	if err := budgets.writeLog(ctx, entry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// legacyLogSequence numbers a consumption log written before v5 by its
+// position, in (timestamp, tx ID) order, among the entries of its budget.
+// Migrated entries keep both fields and entries logged since v5 are newer,
+// so every entry gets the same number whichever batch migrates it.
+func legacyLogSequence(ctx TransactionContextInterface, entry *BudgetConsumptionLog) (int, error) {
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(BUDGET_LOG_OBJECT_TYPE, []string{entry.UserID, entry.DatasetID})
+	if err != nil {
+		return 0, fmt.Errorf("legacyLogSequence: %v", err)
+	}
+	defer iter.Close()
+
+	seq := 1
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return 0, fmt.Errorf("legacyLogSequence: iterator error: %v", err)
+		}
+		other, _, err := decodeLog(kv.Value)
+		if err != nil {
+			return 0, fmt.Errorf("legacyLogSequence: unmarshal error: %v", err)
+		}
+		if other.Timestamp < entry.Timestamp || (other.Timestamp == entry.Timestamp && other.TxID < entry.TxID) {
+			seq++
+		}
+	}
+	return seq, nil
+}
+
+// migrateQuery upgrades a query log through putQuery, which also writes the
+// index entries added since the record was stored.
+func migrateQuery(ctx TransactionContextInterface, key string, raw []byte) (bool, error) {
+	q, upgraded, err := decodeQuery(raw)
+	if err != nil || !upgraded {
+		return false, err
+	}
+	_, parts, err := ctx.GetStub().SplitCompositeKey(key)
+	if err != nil || len(parts) < 2 {
+		return false, fmt.Errorf("malformed query log key")
+	}
+	if err := putQuery(ctx, parts[0], q); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MigrateRecords upgrades up to batchSize records of one object type to the
+// current schema version. Records are visited in key order; pass the
+// returned ResumeToken to the next call until the report says Done.
+//
+// Fabric does not allow paginated queries in update transactions, so each
+// call rescans from the start of the object type and skips keys up to the
+// resume token.
+//
+// Only administrators may run migrations.
+//
+// Parameters:
+//   - objectType:  one of the ledger object types (e.g. "privacyBudget")
+//   - batchSize:   records to visit in this call, 1..MAX_MIGRATION_BATCH
+//   - resumeToken: "" for the first call, then the previous ResumeToken
+func (s *MigrationContract) MigrateRecords(
+	ctx TransactionContextInterface,
+	objectType string,
+	batchSize int,
+	resumeToken string,
+) (*MigrationReport, error) {
+	method := "MigrateRecords"
+
+	if err := assertAdmin(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	migrator, ok := recordMigrators[objectType]
+	if !ok {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: unsupported object type %q, expected one of %v", method, objectType, migratableTypes())
+	}
+	if batchSize < 1 || batchSize > MAX_MIGRATION_BATCH {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: batchSize must be between 1 and %d, got %d", method, MAX_MIGRATION_BATCH, batchSize)
+	}
+	resumeAfter, err := base64.StdEncoding.DecodeString(resumeToken)
+	if err != nil {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: invalid resume token: %v", method, err)
+	}
+
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	report := &MigrationReport{
+		ObjectType:    objectType,
+		TargetVersion: migrator.version,
+		ResumeToken:   resumeToken,
+	}
+	for iter.HasNext() && report.Scanned < batchSize {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		if kv.Key <= string(resumeAfter) {
+			continue
+		}
+
+		migrated, err := migrator.migrate(ctx, kv.Key, kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: record %q: %v", method, kv.Key, err)
+		}
+		if migrated {
+			report.Migrated++
+		}
+		report.Scanned++
+		report.ResumeToken = base64.StdEncoding.EncodeToString([]byte(kv.Key))
+	}
+	report.Done = !iter.HasNext()
+
+	log.Printf("%s: type=%s scanned=%d migrated=%d done=%t",
+		method, objectType, report.Scanned, report.Migrated, report.Done)
+	return report, nil
+}
+
+// migratableTypes lists the object types MigrateRecords accepts.
+func migratableTypes() []string {
+	types := make([]string, 0, len(recordMigrators))
+	for t := range recordMigrators {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,332 @@
+package dt4h
+
+import (
+	"fmt"
+)
+
+// ============================================================================
+// Pagination – bookmark-based variants of the list queries
+// ============================================================================
+//
+// Every *Paginated function takes a pageSize (1..MAX_PAGE_SIZE) and the
+// bookmark returned by the previous page ("" for the first page). Fabric
+// only serves paginated queries to read-only transactions, so these
+// functions must be evaluated, not submitted.
+
+// paginate runs one page of a partial-composite-key query and hands every
+// entry to visit. It returns the bookmark of the next page and the number of
+// ledger entries fetched.
+func paginate(
+	ctx TransactionContextInterface,
+	objectType string,
+	attrs []string,
+	pageSize int32,
+	bookmark string,
+	visit func(key string, value []byte) error,
+) (string, int32, error) {
+	if pageSize < 1 || pageSize > MAX_PAGE_SIZE {
+		return "", 0, codedErrorf(ERR_INVALID_ARGUMENT, "pageSize must be between 1 and %d, got %d", MAX_PAGE_SIZE, pageSize)
+	}
+
+	iter, meta, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(objectType, attrs, pageSize, bookmark)
+	if err != nil {
+		return "", 0, err
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return "", 0, fmt.Errorf("iterator error: %v", err)
+		}
+		if err := visit(kv.Key, kv.Value); err != nil {
+			return "", 0, err
+		}
+	}
+	return meta.GetBookmark(), meta.GetFetchedRecordsCount(), nil
+}
+
+// ---------------------------------------------------------------------------
+// PrivacyBudgetContract
+// ---------------------------------------------------------------------------
+
+// GetBudgetsByUserPaginated returns one page of a user's budgets.
+func (s *PrivacyBudgetContract) GetBudgetsByUserPaginated(
+	ctx TransactionContextInterface,
+	userID string,
+	pageSize int32,
+	bookmark string,
+) (*BudgetPage, error) {
+	return s.budgetPageByIndex(ctx, "GetBudgetsByUserPaginated", INDEX_BUDGET_BY_USER, userID, pageSize, bookmark)
+}
+
+// GetBudgetsByDatasetPaginated returns one page of a dataset's budgets.
+func (s *PrivacyBudgetContract) GetBudgetsByDatasetPaginated(
+	ctx TransactionContextInterface,
+	datasetID string,
+	pageSize int32,
+	bookmark string,
+) (*BudgetPage, error) {
+	return s.budgetPageByIndex(ctx, "GetBudgetsByDatasetPaginated", INDEX_BUDGET_BY_DATASET, datasetID, pageSize, bookmark)
+}
+
+// GetConsumptionLogsPaginated returns one page of the consumption log of a
+// (user, dataset) pair.
+func (s *PrivacyBudgetContract) GetConsumptionLogsPaginated(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	pageSize int32,
+	bookmark string,
+) (*LogPage, error) {
+	method := "GetConsumptionLogsPaginated"
+
+	page := &LogPage{Results: []*BudgetConsumptionLog{}}
+	next, fetched, err := paginate(ctx, BUDGET_LOG_OBJECT_TYPE, []string{userID, datasetID}, pageSize, bookmark,
+		func(_ string, value []byte) error {
+			entry, _, err := decodeLog(value)
+			if err != nil {
+				return fmt.Errorf("unmarshal error: %v", err)
+			}
+			page.Results = append(page.Results, entry)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	page.Bookmark, page.FetchedCount = next, fetched
+	return page, nil
+}
+
+// GetConsumptionLogsByUserPaginated returns one page of a user's
+// consumption logs across datasets.
+func (s *PrivacyBudgetContract) GetConsumptionLogsByUserPaginated(
+	ctx TransactionContextInterface,
+	userID string,
+	pageSize int32,
+	bookmark string,
+) (*LogPage, error) {
+	return logPageByIndex(ctx, "GetConsumptionLogsByUserPaginated", INDEX_LOG_BY_USER, []string{userID}, pageSize, bookmark)
+}
+
+// GetConsumptionLogsByDatasetPaginated returns one page of a dataset's
+// consumption logs across users.
+func (s *PrivacyBudgetContract) GetConsumptionLogsByDatasetPaginated(
+	ctx TransactionContextInterface,
+	datasetID string,
+	pageSize int32,
+	bookmark string,
+) (*LogPage, error) {
+	return logPageByIndex(ctx, "GetConsumptionLogsByDatasetPaginated", INDEX_LOG_BY_DATASET, []string{datasetID}, pageSize, bookmark)
+}
+
+// GetConsumptionLogsByPurposePaginated returns one page of the consumption
+// logs under a purpose, optionally narrowed to one dataset (pass "" for all).
+func (s *PrivacyBudgetContract) GetConsumptionLogsByPurposePaginated(
+	ctx TransactionContextInterface,
+	purpose string,
+	datasetID string,
+	pageSize int32,
+	bookmark string,
+) (*LogPage, error) {
+	attrs := []string{purpose}
+	if datasetID != "" {
+		attrs = append(attrs, datasetID)
+	}
+	return logPageByIndex(ctx, "GetConsumptionLogsByPurposePaginated", INDEX_LOG_BY_PURPOSE, attrs, pageSize, bookmark)
+}
+
+// budgetPageByIndex pages through a budget index and resolves every entry.
+func (s *PrivacyBudgetContract) budgetPageByIndex(
+	ctx TransactionContextInterface,
+	method string,
+	indexName string,
+	leadingAttr string,
+	pageSize int32,
+	bookmark string,
+) (*BudgetPage, error) {
+	page := &BudgetPage{Results: []*PrivacyBudget{}}
+	next, fetched, err := paginate(ctx, indexName, []string{leadingAttr}, pageSize, bookmark,
+		func(key string, _ []byte) error {
+			if budget := s.budgetFromIndexKey(ctx, indexName, key); budget != nil {
+				page.Results = append(page.Results, budget)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	page.Bookmark, page.FetchedCount = next, fetched
+	return page, nil
+}
+
+// logPageByIndex pages through a consumption-log index and resolves every
+// entry.
+func logPageByIndex(
+	ctx TransactionContextInterface,
+	method string,
+	indexName string,
+	attrs []string,
+	pageSize int32,
+	bookmark string,
+) (*LogPage, error) {
+	page := &LogPage{Results: []*BudgetConsumptionLog{}}
+	next, fetched, err := paginate(ctx, indexName, attrs, pageSize, bookmark,
+		func(key string, _ []byte) error {
+			if entry := logFromIndexKey(ctx, indexName, key); entry != nil {
+				page.Results = append(page.Results, entry)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	page.Bookmark, page.FetchedCount = next, fetched
+	return page, nil
+}
+
+// ---------------------------------------------------------------------------
+// QueryContract
+// ---------------------------------------------------------------------------
+
+// GetUserHistoryPaginated returns one page of a user's query history.
+func (s *QueryContract) GetUserHistoryPaginated(
+	ctx TransactionContextInterface,
+	userID string,
+	pageSize int32,
+	bookmark string,
+) (*QueryPage, error) {
+	method := "GetUserHistoryPaginated"
+
+	page := &QueryPage{UserID: userID, Results: []Query{}}
+	next, fetched, err := paginate(ctx, QUERY_LOG_OBJECT_TYPE, []string{userID}, pageSize, bookmark,
+		func(_ string, value []byte) error {
+			q, _, err := decodeQuery(value)
+			if err != nil {
+				return fmt.Errorf("unmarshal error: %v", err)
+			}
+			page.Results = append(page.Results, *q)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	page.Bookmark, page.FetchedCount = next, fetched
+	return page, nil
+}
+
+// GetMyHistoryPaginated returns one page of the calling user's own query
+// history.
+func (s *QueryContract) GetMyHistoryPaginated(
+	ctx TransactionContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*QueryPage, error) {
+	return s.GetUserHistoryPaginated(ctx, ctx.GetUserID(), pageSize, bookmark)
+}
+
+// ---------------------------------------------------------------------------
+// DatasetContract
+// ---------------------------------------------------------------------------
+
+// ListDatasetsPaginated returns one page of the catalogue.
+func (s *DatasetContract) ListDatasetsPaginated(
+	ctx TransactionContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*DatasetPage, error) {
+	method := "ListDatasetsPaginated"
+
+	page := &DatasetPage{Results: []*Dataset{}}
+	next, fetched, err := paginate(ctx, DATASET_OBJECT_TYPE, []string{}, pageSize, bookmark,
+		func(_ string, value []byte) error {
+			dataset, _, err := decodeDataset(value)
+			if err != nil {
+				return fmt.Errorf("unmarshal error: %v", err)
+			}
+			page.Results = append(page.Results, dataset)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	page.Bookmark, page.FetchedCount = next, fetched
+	return page, nil
+}
+
+// GetDatasetsByOwnerPaginated returns one page of the datasets registered by
+// an MSP.
+func (s *DatasetContract) GetDatasetsByOwnerPaginated(
+	ctx TransactionContextInterface,
+	ownerMSP string,
+	pageSize int32,
+	bookmark string,
+) (*DatasetPage, error) {
+	method := "GetDatasetsByOwnerPaginated"
+
+	page := &DatasetPage{Results: []*Dataset{}}
+	next, fetched, err := paginate(ctx, INDEX_DATASET_BY_OWNER, []string{ownerMSP}, pageSize, bookmark,
+		func(key string, _ []byte) error {
+			_, parts, err := ctx.GetStub().SplitCompositeKey(key)
+			if err != nil || len(parts) < 2 {
+				return nil
+			}
+			if dataset, _, err := readDataset(ctx, parts[1]); err == nil {
+				page.Results = append(page.Results, dataset)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	page.Bookmark, page.FetchedCount = next, fetched
+	return page, nil
+}
+
+// ---------------------------------------------------------------------------
+// UserContract
+// ---------------------------------------------------------------------------
+
+// GetUsersByProjectPaginated returns one page of a project's members.
+func (s *UserContract) GetUsersByProjectPaginated(
+	ctx TransactionContextInterface,
+	projectID string,
+	pageSize int32,
+	bookmark string,
+) (*ResearcherPage, error) {
+	method := "GetUsersByProjectPaginated"
+
+	page := &ResearcherPage{Results: []*Researcher{}}
+	next, fetched, err := paginate(ctx, INDEX_RESEARCHER_BY_PROJECT, []string{projectID}, pageSize, bookmark,
+		func(key string, _ []byte) error {
+			_, parts, err := ctx.GetStub().SplitCompositeKey(key)
+			if err != nil || len(parts) < 2 {
+				return nil
+			}
+			if researcher, _, err := readResearcher(ctx, parts[1]); err == nil {
+				page.Results = append(page.Results, researcher)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	page.Bookmark, page.FetchedCount = next, fetched
+	return page, nil
+}
+
+// ---------------------------------------------------------------------------
+// AgreementContract
+// ---------------------------------------------------------------------------
+
+// GetAgreementBudgetsPaginated returns one page of the budgets granted under
+// an agreement.
+func (s *AgreementContract) GetAgreementBudgetsPaginated(
+	ctx TransactionContextInterface,
+	agreementID string,
+	pageSize int32,
+	bookmark string,
+) (*BudgetPage, error) {
+	return new(PrivacyBudgetContract).budgetPageByIndex(ctx, "GetAgreementBudgetsPaginated",
+		INDEX_BUDGET_BY_AGREEMENT, agreementID, pageSize, bookmark)
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
+	"time"
+
+	"github.com/chaincode/dt4hCC/logchain"
 )
 
 // ============================================================================
@@ -30,45 +34,87 @@ func budgetIndexKeys(ctx TransactionContextInterface, userID, datasetID string)
 	return
 }
 
-// logKey returns the composite key for a single consumption-log entry.
-func logKey(ctx TransactionContextInterface, userID, datasetID, txID string) (string, error) {
-	return ctx.GetStub().CreateCompositeKey(BUDGET_LOG_OBJECT_TYPE, []string{userID, datasetID, txID})
+// budgetAgreementIndexKey creates the index key used to find the budgets
+// granted under a data use agreement.
+func budgetAgreementIndexKey(ctx TransactionContextInterface, agreementID, userID, datasetID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(INDEX_BUDGET_BY_AGREEMENT, []string{agreementID, userID, datasetID})
+}
+
+// logKey returns the composite key for a single consumption-log entry. ref is
+// the entry's logRef.
+func logKey(ctx TransactionContextInterface, userID, datasetID, ref string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(BUDGET_LOG_OBJECT_TYPE, []string{userID, datasetID, ref})
+}
+
+// logRef returns the last key attribute of a consumption log and of its index
+// entries: the zero-padded sequence number, so that a budget's entries sort
+// in the order they were logged, or the tx ID for entries logged before v5
+// that MigrateRecords has not numbered yet.
+func logRef(entry *BudgetConsumptionLog) string {
+	if entry.Sequence == 0 {
+		return entry.TxID
+	}
+	return logSequenceAttr(entry.Sequence)
+}
+
+// logSequenceAttr formats a sequence number as a log key attribute.
+func logSequenceAttr(seq int) string {
+	return fmt.Sprintf("%019d", seq)
 }
 
 // logIndexKeys creates the secondary index keys for consumption logs.
-func logIndexKeys(ctx TransactionContextInterface, userID, datasetID, txID string) (byUser string, byDataset string, err error) {
-	byUser, err = ctx.GetStub().CreateCompositeKey(INDEX_LOG_BY_USER, []string{userID, datasetID, txID})
+func logIndexKeys(ctx TransactionContextInterface, userID, datasetID, ref string) (byUser string, byDataset string, err error) {
+	byUser, err = ctx.GetStub().CreateCompositeKey(INDEX_LOG_BY_USER, []string{userID, datasetID, ref})
 	if err != nil {
 		return
 	}
-	byDataset, err = ctx.GetStub().CreateCompositeKey(INDEX_LOG_BY_DATASET, []string{datasetID, userID, txID})
+	byDataset, err = ctx.GetStub().CreateCompositeKey(INDEX_LOG_BY_DATASET, []string{datasetID, userID, ref})
 	return
 }
 
+// logPurposeIndexKey creates the index key used to filter consumption logs by
+// purpose. Entries logged before purposes were recorded have none.
+func logPurposeIndexKey(ctx TransactionContextInterface, purpose, datasetID, userID, ref string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(INDEX_LOG_BY_PURPOSE, []string{purpose, datasetID, userID, ref})
+}
+
 // ---------------------------------------------------------------------------
 // Write operations
 // ---------------------------------------------------------------------------
 
 // InitializeBudget creates a new privacy budget for a (user, dataset) pair.
-// It fails if a budget already exists for that pair.
+// It fails if a budget already exists for that pair, or if the data use
+// agreement is not Active or does not cover the user and dataset.
 //
 // Parameters:
 //   - userID:       the identity of the user who will consume the budget
 //   - datasetID:    the identifier of the dataset
 //   - totalEpsilon: the maximum epsilon the user is allowed to spend
+//   - agreementID:  the data use agreement the budget is granted under
 func (s *PrivacyBudgetContract) InitializeBudget(
 	ctx TransactionContextInterface,
 	userID string,
 	datasetID string,
 	totalEpsilon float64,
+	agreementID string,
 ) (*PrivacyBudget, error) {
 	method := "InitializeBudget"
 
 	if err := assertAuthorizedMSP(ctx); err != nil {
 		return nil, fmt.Errorf("%s: %v", method, err)
 	}
-	if totalEpsilon <= 0 {
-		return nil, fmt.Errorf("%s: totalEpsilon must be > 0, got %f", method, totalEpsilon)
+	budget, err := newBudget(ctx, userID, datasetID, totalEpsilon, agreementID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertDatasetActive(ctx, datasetID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertUserActive(ctx, userID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertAgreementCovers(ctx, agreementID, userID, datasetID, ""); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
 	}
 
 	key, err := budgetKey(ctx, userID, datasetID)
@@ -82,39 +128,11 @@ func (s *PrivacyBudgetContract) InitializeBudget(
 		return nil, fmt.Errorf("%s: ledger read error: %v", method, err)
 	}
 	if existing != nil {
-		return nil, fmt.Errorf("%s: budget already exists for user=%s dataset=%s", method, userID, datasetID)
-	}
-
-	now := nowUTC()
-	budget := &PrivacyBudget{
-		ObjectType:     PRIVACY_BUDGET_OBJECT_TYPE,
-		UserID:         userID,
-		DatasetID:      datasetID,
-		TotalBudget:    totalEpsilon,
-		ConsumedBudget: 0,
-		Status:         BUDGET_ACTIVE,
-		CreatedAt:      now,
-		UpdatedAt:      now,
-	}
-
-	data, err := json.Marshal(budget)
-	if err != nil {
-		return nil, fmt.Errorf("%s: marshal error: %v", method, err)
-	}
-	if err := ctx.GetStub().PutState(key, data); err != nil {
-		return nil, fmt.Errorf("%s: put error: %v", method, err)
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: budget already exists for user=%s dataset=%s", method, userID, datasetID)
 	}
 
-	// Write index entries (value is empty – they just point to the primary key).
-	byUser, byDataset, err := budgetIndexKeys(ctx, userID, datasetID)
-	if err != nil {
-		return nil, fmt.Errorf("%s: index key error: %v", method, err)
-	}
-	if err := ctx.GetStub().PutState(byUser, []byte{0x00}); err != nil {
-		return nil, fmt.Errorf("%s: index put error: %v", method, err)
-	}
-	if err := ctx.GetStub().PutState(byDataset, []byte{0x00}); err != nil {
-		return nil, fmt.Errorf("%s: index put error: %v", method, err)
+	if err := s.putBudgetWithIndexes(ctx, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
 	}
 
 	log.Printf("%s: created budget user=%s dataset=%s epsilon=%f", method, userID, datasetID, totalEpsilon)
@@ -123,8 +141,15 @@ func (s *PrivacyBudgetContract) InitializeBudget(
 
 // ConsumeBudget deducts epsilon from an existing budget and writes an
 // immutable consumption-log entry. The transaction is rejected when:
-//   - the budget does not exist or is not Active
+//   - the purpose is not an Active vocabulary purpose
+//   - the dataset is not registered or has been retired
+//   - the user is not registered or is not Active
+//   - the dataset's consent does not cover the purpose
+//   - the budget does not exist, is not Active or excludes the purpose
+//   - the budget's data use agreement is not Active or excludes the purpose
 //   - the remaining budget is insufficient
+//   - the dataset-level budget of the dataset, or of any dataset it was
+//     derived from, is insufficient
 //
 // Returns the updated PrivacyBudget.
 func (s *PrivacyBudgetContract) ConsumeBudget(
@@ -133,68 +158,145 @@ func (s *PrivacyBudgetContract) ConsumeBudget(
 	datasetID string,
 	epsilonUsed float64,
 	queryBody string,
+	purpose string,
 ) (*PrivacyBudget, error) {
+	budget, _, err := s.consumeBudget(ctx, userID, datasetID, epsilonUsed, queryBody, purpose)
+	return budget, err
+}
+
+// consumeBudget implements ConsumeBudget and also returns the consumption
+// log entry it wrote.
+func (s *PrivacyBudgetContract) consumeBudget(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	epsilonUsed float64,
+	queryBody string,
+	purpose string,
+) (*PrivacyBudget, *BudgetConsumptionLog, error) {
 	method := "ConsumeBudget"
 
 	if epsilonUsed <= 0 {
-		return nil, fmt.Errorf("%s: epsilonUsed must be > 0, got %f", method, epsilonUsed)
+		return nil, nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: epsilonUsed must be > 0, got %f", method, epsilonUsed)
+	}
+	def, err := assertPurposeActive(ctx, purpose)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertDatasetActive(ctx, datasetID); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertUserActive(ctx, userID); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertConsentCovers(ctx, datasetID, def); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
 	}
 
 	// ---------- read current budget ----------
 	budget, key, err := s.readBudget(ctx, userID, datasetID)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %v", method, err)
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
 	}
 	if budget.Status != BUDGET_ACTIVE {
-		return nil, fmt.Errorf("%s: budget is %s for user=%s dataset=%s", method, budget.Status, userID, datasetID)
+		return nil, nil, codedErrorf(ERR_NOT_ACTIVE, "%s: budget is %s for user=%s dataset=%s", method, budget.Status, userID, datasetID)
+	}
+	if len(budget.AllowedPurposes) > 0 && !slices.Contains(budget.AllowedPurposes, purpose) {
+		return nil, nil, codedErrorf(ERR_PURPOSE_NOT_ALLOWED, "%s: budget for user=%s dataset=%s is restricted to purposes %v",
+			method, userID, datasetID, budget.AllowedPurposes)
+	}
+	if budget.AgreementID == "" {
+		return nil, nil, fmt.Errorf("%s: budget for user=%s dataset=%s has no data use agreement; assign one with AssignBudgetAgreement",
+			method, userID, datasetID)
+	}
+	if err := assertAgreementCovers(ctx, budget.AgreementID, userID, datasetID, purpose); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
 	}
 	if !budget.CanConsume(epsilonUsed) {
-		return nil, fmt.Errorf(
+		return nil, nil, codedErrorf(ERR_INSUFFICIENT_BUDGET,
 			"%s: insufficient budget for user=%s dataset=%s: requested=%f remaining=%f",
 			method, userID, datasetID, epsilonUsed, budget.RemainingBudget(),
 		)
 	}
+	if err := chargeLineageBudgets(ctx, datasetID, epsilonUsed); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
+	}
 
 	// ---------- update budget ----------
+	consumedBefore := budget.ConsumedBudget
 	budget.ConsumedBudget += epsilonUsed
-	budget.UpdatedAt = nowUTC()
+	budget.UpdatedAt = ctx.GetTimestamp()
+	budget.QueryCount++
+	budget.LastQueryAt = budget.UpdatedAt
+	budget.MaxEpsilon = max(budget.MaxEpsilon, epsilonUsed)
+	budget.LogSequence++
 	if budget.RemainingBudget() <= 0 {
-		budget.Status = BUDGET_EXHAUSTED
-	}
-
-	data, err := json.Marshal(budget)
-	if err != nil {
-		return nil, fmt.Errorf("%s: marshal error: %v", method, err)
-	}
-	if err := ctx.GetStub().PutState(key, data); err != nil {
-		return nil, fmt.Errorf("%s: put error: %v", method, err)
+		if err := transitionBudget(budget, BUDGET_EXHAUSTED, "", ""); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", method, err)
+		}
 	}
 
-	// ---------- write consumption log ----------
-	txID := ctx.GetStub().GetTxID()
+	// ---------- chain consumption log ----------
+	ensureSubjectCommitment(ctx, budget)
 	logEntry := &BudgetConsumptionLog{
 		ObjectType:        BUDGET_LOG_OBJECT_TYPE,
+		SchemaVersion:     LOG_SCHEMA_VERSION,
 		UserID:            userID,
 		DatasetID:         datasetID,
 		QueryBody:         queryBody,
+		Purpose:           purpose,
 		EpsilonUsed:       epsilonUsed,
 		CumulativeEpsilon: budget.ConsumedBudget,
 		RemainingEpsilon:  budget.RemainingBudget(),
-		TxID:              txID,
+		TxID:              ctx.GetStub().GetTxID(),
 		Timestamp:         budget.UpdatedAt,
+		Sequence:          budget.LogSequence,
+		MspID:             ctx.GetMspID(),
+		QueryDigest:       logchain.QueryDigest(queryBody),
+		PrevHash:          budget.LogHeadHash,
+		SubjectCommitment: budget.SubjectCommitment,
+	}
+	if logEntry.Hash, err = logchain.Hash(logEntry); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
+	}
+	budget.LogHeadHash = logEntry.Hash
+	if err := emitEvent(ctx, EVENT_BUDGET_CONSUMED, &BudgetConsumedPayload{
+		UserID:            userID,
+		DatasetID:         datasetID,
+		Purpose:           purpose,
+		EpsilonUsed:       epsilonUsed,
+		ConsumedBudget:    budget.ConsumedBudget,
+		RemainingBudget:   budget.RemainingBudget(),
+		Sequence:          logEntry.Sequence,
+		LogHash:           logEntry.Hash,
+		SubjectCommitment: budget.SubjectCommitment,
+	}); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := raiseWarnings(ctx, budget, consumedBefore); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	if err := s.putBudget(ctx, key, budget); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
 	}
 
+	// ---------- write consumption log ----------
 	if err := s.writeLog(ctx, logEntry); err != nil {
-		return nil, fmt.Errorf("%s: %v", method, err)
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := trackConsumption(ctx, logEntry); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", method, err)
 	}
 
 	log.Printf("%s: consumed ε=%f  user=%s dataset=%s  remaining=%f",
 		method, epsilonUsed, userID, datasetID, budget.RemainingBudget())
-	return budget, nil
+	return budget, logEntry, nil
 }
 
 // UpdateBudget changes the total epsilon for an existing budget.
 // Only increases are allowed (you cannot reduce below what was already consumed).
+// A Suspended budget keeps its status; a Revoked budget cannot be updated.
 func (s *PrivacyBudgetContract) UpdateBudget(
 	ctx TransactionContextInterface,
 	userID string,
@@ -212,25 +314,15 @@ func (s *PrivacyBudgetContract) UpdateBudget(
 		return nil, fmt.Errorf("%s: %v", method, err)
 	}
 
-	if newTotalEpsilon < budget.ConsumedBudget {
-		return nil, fmt.Errorf(
-			"%s: new total %f is less than already consumed %f",
-			method, newTotalEpsilon, budget.ConsumedBudget,
-		)
+	if err := applyBudgetUpdate(ctx, budget, newTotalEpsilon); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
 	}
-
-	budget.TotalBudget = newTotalEpsilon
-	budget.UpdatedAt = nowUTC()
-	if budget.Status == BUDGET_EXHAUSTED && budget.RemainingBudget() > 0 {
-		budget.Status = BUDGET_ACTIVE
+	if err := refreshWarningLevel(ctx, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
 	}
 
-	data, err := json.Marshal(budget)
-	if err != nil {
-		return nil, fmt.Errorf("%s: marshal error: %v", method, err)
-	}
-	if err := ctx.GetStub().PutState(key, data); err != nil {
-		return nil, fmt.Errorf("%s: put error: %v", method, err)
+	if err := s.putBudget(ctx, key, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
 	}
 
 	log.Printf("%s: updated budget user=%s dataset=%s newTotal=%f", method, userID, datasetID, newTotalEpsilon)
@@ -238,6 +330,7 @@ func (s *PrivacyBudgetContract) UpdateBudget(
 }
 
 // RevokeBudget marks a budget as Revoked so no further queries can consume it.
+// Revocation is terminal; use SuspendBudget for a reversible stop.
 func (s *PrivacyBudgetContract) RevokeBudget(
 	ctx TransactionContextInterface,
 	userID string,
@@ -254,21 +347,183 @@ func (s *PrivacyBudgetContract) RevokeBudget(
 		return fmt.Errorf("%s: %v", method, err)
 	}
 
-	budget.Status = BUDGET_REVOKED
-	budget.UpdatedAt = nowUTC()
-
-	data, err := json.Marshal(budget)
-	if err != nil {
-		return fmt.Errorf("%s: marshal error: %v", method, err)
+	if err := transitionBudget(budget, BUDGET_REVOKED, "", ""); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
 	}
-	if err := ctx.GetStub().PutState(key, data); err != nil {
-		return fmt.Errorf("%s: put error: %v", method, err)
+	budget.UpdatedAt = ctx.GetTimestamp()
+
+	if err := s.putBudget(ctx, key, budget); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
 	}
 
 	log.Printf("%s: revoked budget user=%s dataset=%s", method, userID, datasetID)
 	return nil
 }
 
+// SuspendBudget temporarily stops consumption on a budget, e.g. while an
+// investigation is under way. The budget keeps its epsilon and can be
+// reinstated with ResumeBudget.
+//
+// Parameters:
+//   - reasonCode: one of SUSPEND_REASON_CODES
+//   - note:       free-text justification recorded on the budget
+func (s *PrivacyBudgetContract) SuspendBudget(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	reasonCode string,
+	note string,
+) (*PrivacyBudget, error) {
+	method := "SuspendBudget"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := validateReasonCode(reasonCode, SUSPEND_REASON_CODES); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	budget, key, err := s.readBudget(ctx, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := transitionBudget(budget, BUDGET_SUSPENDED, reasonCode, note); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	budget.UpdatedAt = ctx.GetTimestamp()
+
+	if err := s.putBudget(ctx, key, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: suspended budget user=%s dataset=%s reason=%s", method, userID, datasetID, reasonCode)
+	return budget, nil
+}
+
+// ResumeBudget lifts a suspension. The budget returns to Active, or to
+// Exhausted if no epsilon remains.
+//
+// Parameters:
+//   - reasonCode: one of RESUME_REASON_CODES
+//   - note:       free-text justification recorded on the budget
+func (s *PrivacyBudgetContract) ResumeBudget(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	reasonCode string,
+	note string,
+) (*PrivacyBudget, error) {
+	method := "ResumeBudget"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := validateReasonCode(reasonCode, RESUME_REASON_CODES); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	budget, key, err := s.readBudget(ctx, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if budget.Status != BUDGET_SUSPENDED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: budget is %s, not %s", method, budget.Status, BUDGET_SUSPENDED)
+	}
+	if err := transitionBudget(budget, settledStatus(budget), reasonCode, note); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	budget.UpdatedAt = ctx.GetTimestamp()
+
+	if err := s.putBudget(ctx, key, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: resumed budget user=%s dataset=%s status=%s reason=%s",
+		method, userID, datasetID, budget.Status, reasonCode)
+	return budget, nil
+}
+
+// AssignBudgetAgreement places a budget created before data use agreements
+// were introduced under an agreement. Such budgets carry no AgreementID and
+// cannot be consumed until they are assigned one. The agreement must be
+// Active and cover the user and dataset; a budget that already names an
+// agreement keeps it.
+func (s *PrivacyBudgetContract) AssignBudgetAgreement(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	agreementID string,
+) (*PrivacyBudget, error) {
+	method := "AssignBudgetAgreement"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	budget, _, err := s.readBudget(ctx, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if budget.Status == BUDGET_REVOKED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: budget is %s", method, BUDGET_REVOKED)
+	}
+	if budget.AgreementID != "" {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: budget for user=%s dataset=%s is already granted under agreement %s",
+			method, userID, datasetID, budget.AgreementID)
+	}
+	if err := assertAgreementCovers(ctx, agreementID, userID, datasetID, ""); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	budget.AgreementID = agreementID
+	budget.UpdatedAt = ctx.GetTimestamp()
+
+	// putBudgetWithIndexes also adds the budget to the agreement's index, so
+	// ending the agreement suspends it.
+	if err := s.putBudgetWithIndexes(ctx, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: user=%s dataset=%s agreement=%s", method, userID, datasetID, agreementID)
+	return budget, nil
+}
+
+// SetBudgetPurposes restricts a budget to the given purposes of processing.
+// purposesJSON is a JSON array of vocabulary purposes; "[]" lifts the
+// restriction. Rejected for Revoked budgets.
+func (s *PrivacyBudgetContract) SetBudgetPurposes(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	purposesJSON string,
+) (*PrivacyBudget, error) {
+	method := "SetBudgetPurposes"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	purposes, err := parsePurposeList(ctx, purposesJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	budget, key, err := s.readBudget(ctx, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if budget.Status == BUDGET_REVOKED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: budget is %s", method, BUDGET_REVOKED)
+	}
+	budget.AllowedPurposes = purposes
+	budget.UpdatedAt = ctx.GetTimestamp()
+
+	if err := s.putBudget(ctx, key, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: user=%s dataset=%s purposes=%v", method, userID, datasetID, purposes)
+	return budget, nil
+}
+
 // ---------------------------------------------------------------------------
 // Read / query operations
 // ---------------------------------------------------------------------------
@@ -313,12 +568,15 @@ func (s *PrivacyBudgetContract) GetBudgetsByDataset(
 }
 
 // GetBudgetHistory returns the full modification history of a budget from
-// the ledger's block history.
+// the ledger's block history, oldest first. Each entry carries the
+// transaction ID and timestamp of the change and the MSP that submitted it.
+// Deletions, e.g. when EraseUserRecords moves a budget to a pseudonym, are
+// included with IsDelete set.
 func (s *PrivacyBudgetContract) GetBudgetHistory(
 	ctx TransactionContextInterface,
 	userID string,
 	datasetID string,
-) ([]*PrivacyBudget, error) {
+) ([]*BudgetHistoryEntry, error) {
 	method := "GetBudgetHistory"
 
 	key, err := budgetKey(ctx, userID, datasetID)
@@ -332,26 +590,80 @@ func (s *PrivacyBudgetContract) GetBudgetHistory(
 	}
 	defer iter.Close()
 
-	var history []*PrivacyBudget
+	history := []*BudgetHistoryEntry{}
 	for iter.HasNext() {
 		mod, err := iter.Next()
 		if err != nil {
 			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
 		}
-		if mod.IsDelete {
-			continue
+		entry := &BudgetHistoryEntry{
+			TxID:      mod.GetTxId(),
+			Timestamp: mod.GetTimestamp().AsTime().UTC().Format(time.RFC3339),
+			IsDelete:  mod.GetIsDelete(),
 		}
-		var b PrivacyBudget
-		if err := json.Unmarshal(mod.Value, &b); err != nil {
-			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+		if !entry.IsDelete {
+			if entry.Budget, _, err = decodeBudget(mod.GetValue()); err != nil {
+				return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+			}
+			entry.Actor = entry.Budget.UpdatedBy
 		}
-		history = append(history, &b)
+		history = append(history, entry)
 	}
+
+	// Since Fabric v2.0 the history is returned newest first, by block and
+	// transaction height. Timestamps are set by the submitting client and
+	// need not follow that order, so they cannot be used to sort it.
+	slices.Reverse(history)
 	return history, nil
 }
 
+// GetBudgetAsOf reconstructs a budget as it stood at a past instant from the
+// ledger's history, for dispute resolution. It returns the latest change, in
+// ledger order, whose timestamp is at or before asOf, with the transaction
+// that made it, and fails if the budget did not exist at that time. Fields
+// added to budgets after that change have their zero value.
+//
+// Parameters:
+//   - asOf: RFC 3339 instant, e.g. "2025-03-14T09:00:00Z"
+func (s *PrivacyBudgetContract) GetBudgetAsOf(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	asOf string,
+) (*BudgetHistoryEntry, error) {
+	method := "GetBudgetAsOf"
+
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: invalid asOf: %v", method, err)
+	}
+	cutoff := at.UTC().Format(time.RFC3339)
+
+	history, err := s.GetBudgetHistory(ctx, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	// Client timestamps are not ordered by ledger height, so a change
+	// stamped after the cutoff may precede one stamped before it.
+	var state *BudgetHistoryEntry
+	for _, entry := range history {
+		if entry.Timestamp <= cutoff {
+			state = entry
+		}
+	}
+	if state == nil {
+		return nil, codedErrorf(ERR_NOT_FOUND, "%s: no budget for user=%s dataset=%s at %s", method, userID, datasetID, cutoff)
+	}
+	if state.IsDelete {
+		return nil, codedErrorf(ERR_NOT_FOUND, "%s: budget for user=%s dataset=%s was deleted by tx %s at %s",
+			method, userID, datasetID, state.TxID, state.Timestamp)
+	}
+	return state, nil
+}
+
 // GetConsumptionLogs returns all consumption log entries for a (user, dataset)
-// pair, ordered by transaction history.
+// pair in the order they were logged. Entries logged before v5 that have not
+// been numbered yet come first, ordered by timestamp.
 func (s *PrivacyBudgetContract) GetConsumptionLogs(
 	ctx TransactionContextInterface,
 	userID string,
@@ -367,17 +679,71 @@ func (s *PrivacyBudgetContract) GetConsumptionLogs(
 	}
 	defer iter.Close()
 
-	var logs []*BudgetConsumptionLog
+	logs := []*BudgetConsumptionLog{}
 	for iter.HasNext() {
 		kv, err := iter.Next()
 		if err != nil {
 			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
 		}
-		var entry BudgetConsumptionLog
-		if err := json.Unmarshal(kv.Value, &entry); err != nil {
+		entry, _, err := decodeLog(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+		}
+		logs = append(logs, entry)
+	}
+	logchain.SortBySequence(logs)
+	return logs, nil
+}
+
+// GetConsumptionLogsSince returns up to limit consumption log entries of a
+// (user, dataset) pair with a sequence number above afterSequence, in
+// sequence order. Pass 0 to start from the first entry, then the sequence of
+// the last entry received. A sequence number that is skipped in the result
+// was never written or has been removed.
+//
+// Parameters:
+//   - afterSequence: the last sequence number the caller has seen
+//   - limit:         entries to return, 1..MAX_PAGE_SIZE
+func (s *PrivacyBudgetContract) GetConsumptionLogsSince(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	afterSequence int,
+	limit int,
+) ([]*BudgetConsumptionLog, error) {
+	method := "GetConsumptionLogsSince"
+
+	if afterSequence < 0 {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: afterSequence must be >= 0, got %d", method, afterSequence)
+	}
+	if limit < 1 || limit > MAX_PAGE_SIZE {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: limit must be between 1 and %d, got %d", method, MAX_PAGE_SIZE, limit)
+	}
+	budget, _, err := s.readBudget(ctx, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	// Entries are keyed by sequence number, so each one is a point read and
+	// the cost does not depend on how long the log already is.
+	logs := []*BudgetConsumptionLog{}
+	for seq := afterSequence + 1; seq <= budget.LogSequence && len(logs) < limit; seq++ {
+		lk, err := logKey(ctx, userID, datasetID, logSequenceAttr(seq))
+		if err != nil {
+			return nil, fmt.Errorf("%s: key error: %v", method, err)
+		}
+		raw, err := ctx.GetStub().GetState(lk)
+		if err != nil {
+			return nil, fmt.Errorf("%s: ledger read error: %v", method, err)
+		}
+		if raw == nil {
+			continue
+		}
+		entry, _, err := decodeLog(raw)
+		if err != nil {
 			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
 		}
-		logs = append(logs, &entry)
+		logs = append(logs, entry)
 	}
 	return logs, nil
 }
@@ -398,32 +764,15 @@ func (s *PrivacyBudgetContract) GetConsumptionLogsByUser(
 	}
 	defer iter.Close()
 
-	var logs []*BudgetConsumptionLog
+	logs := []*BudgetConsumptionLog{}
 	for iter.HasNext() {
 		kv, err := iter.Next()
 		if err != nil {
 			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
 		}
-		// Index entries store only a pointer byte; extract the attributes
-		// from the composite key and fetch the actual log.
-		_, parts, err := ctx.GetStub().SplitCompositeKey(kv.Key)
-		if err != nil || len(parts) < 3 {
-			continue
-		}
-		entryUserID, entryDatasetID, entryTxID := parts[0], parts[1], parts[2]
-		lk, err := logKey(ctx, entryUserID, entryDatasetID, entryTxID)
-		if err != nil {
-			continue
-		}
-		raw, err := ctx.GetStub().GetState(lk)
-		if err != nil || raw == nil {
-			continue
-		}
-		var entry BudgetConsumptionLog
-		if err := json.Unmarshal(raw, &entry); err != nil {
-			continue
+		if entry := logFromIndexKey(ctx, INDEX_LOG_BY_USER, kv.Key); entry != nil {
+			logs = append(logs, entry)
 		}
-		logs = append(logs, &entry)
 	}
 	return logs, nil
 }
@@ -444,35 +793,54 @@ func (s *PrivacyBudgetContract) GetConsumptionLogsByDataset(
 	}
 	defer iter.Close()
 
-	var logs []*BudgetConsumptionLog
+	logs := []*BudgetConsumptionLog{}
 	for iter.HasNext() {
 		kv, err := iter.Next()
 		if err != nil {
 			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
 		}
-		_, parts, err := ctx.GetStub().SplitCompositeKey(kv.Key)
-		if err != nil || len(parts) < 3 {
-			continue
+		if entry := logFromIndexKey(ctx, INDEX_LOG_BY_DATASET, kv.Key); entry != nil {
+			logs = append(logs, entry)
 		}
-		entryDatasetID, entryUserID, entryTxID := parts[0], parts[1], parts[2]
-		lk, err := logKey(ctx, entryUserID, entryDatasetID, entryTxID)
+	}
+	return logs, nil
+}
+
+// GetConsumptionLogsByPurpose returns the consumption entries logged under a
+// purpose of processing, optionally narrowed to one dataset (pass "" for all
+// datasets). Entries logged before purposes were recorded are not included.
+func (s *PrivacyBudgetContract) GetConsumptionLogsByPurpose(
+	ctx TransactionContextInterface,
+	purpose string,
+	datasetID string,
+) ([]*BudgetConsumptionLog, error) {
+	method := "GetConsumptionLogsByPurpose"
+
+	attrs := []string{purpose}
+	if datasetID != "" {
+		attrs = append(attrs, datasetID)
+	}
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(INDEX_LOG_BY_PURPOSE, attrs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	logs := []*BudgetConsumptionLog{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
 		if err != nil {
-			continue
-		}
-		raw, err := ctx.GetStub().GetState(lk)
-		if err != nil || raw == nil {
-			continue
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
 		}
-		var entry BudgetConsumptionLog
-		if err := json.Unmarshal(raw, &entry); err != nil {
-			continue
+		if entry := logFromIndexKey(ctx, INDEX_LOG_BY_PURPOSE, kv.Key); entry != nil {
+			logs = append(logs, entry)
 		}
-		logs = append(logs, &entry)
 	}
 	return logs, nil
 }
 
-// GetBudgetSummary returns a high-level summary including query count.
+// GetBudgetSummary returns a high-level summary including the query
+// counters and warning level maintained by ConsumeBudget.
 func (s *PrivacyBudgetContract) GetBudgetSummary(
 	ctx TransactionContextInterface,
 	userID string,
@@ -485,19 +853,18 @@ func (s *PrivacyBudgetContract) GetBudgetSummary(
 		return nil, fmt.Errorf("%s: %v", method, err)
 	}
 
-	logs, err := s.GetConsumptionLogs(ctx, userID, datasetID)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %v", method, err)
-	}
-
 	return &BudgetSummary{
-		UserID:          userID,
-		DatasetID:       datasetID,
-		TotalBudget:     budget.TotalBudget,
-		ConsumedBudget:  budget.ConsumedBudget,
-		RemainingBudget: budget.RemainingBudget(),
-		Status:          budget.Status,
-		QueryCount:      len(logs),
+		UserID:           userID,
+		DatasetID:        datasetID,
+		TotalBudget:      budget.TotalBudget,
+		ConsumedBudget:   budget.ConsumedBudget,
+		RemainingBudget:  budget.RemainingBudget(),
+		Status:           budget.Status,
+		QueryCount:       budget.QueryCount,
+		LastQueryAt:      budget.LastQueryAt,
+		MaxEpsilon:       budget.MaxEpsilon,
+		WarningLevel:     budget.WarningLevel,
+		WarningReachedAt: budget.WarningReachedAt,
 	}, nil
 }
 
@@ -505,6 +872,51 @@ func (s *PrivacyBudgetContract) GetBudgetSummary(
 // Internal helpers
 // ---------------------------------------------------------------------------
 
+// newBudget validates the parameters of a new budget and builds it.
+func newBudget(ctx TransactionContextInterface, userID, datasetID string, totalEpsilon float64, agreementID string) (*PrivacyBudget, error) {
+	if userID == "" || datasetID == "" || agreementID == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "userID, datasetID and agreementID are required")
+	}
+	if totalEpsilon <= 0 {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "totalEpsilon must be > 0, got %f", totalEpsilon)
+	}
+
+	now := ctx.GetTimestamp()
+	return &PrivacyBudget{
+		ObjectType:      PRIVACY_BUDGET_OBJECT_TYPE,
+		SchemaVersion:   BUDGET_SCHEMA_VERSION,
+		UserID:          userID,
+		DatasetID:       datasetID,
+		TotalBudget:     totalEpsilon,
+		ConsumedBudget:  0,
+		Status:          BUDGET_ACTIVE,
+		AllowedPurposes: []string{},
+		AgreementID:     agreementID,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}, nil
+}
+
+// applyBudgetUpdate sets a new total epsilon on a budget in memory, settling
+// its status between Active and Exhausted unless it is Suspended.
+func applyBudgetUpdate(ctx TransactionContextInterface, budget *PrivacyBudget, newTotalEpsilon float64) error {
+	if budget.Status == BUDGET_REVOKED {
+		return codedErrorf(ERR_NOT_ACTIVE, "budget is %s for user=%s dataset=%s", budget.Status, budget.UserID, budget.DatasetID)
+	}
+	if newTotalEpsilon < budget.ConsumedBudget {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "new total %f is less than already consumed %f", newTotalEpsilon, budget.ConsumedBudget)
+	}
+
+	budget.TotalBudget = newTotalEpsilon
+	budget.UpdatedAt = ctx.GetTimestamp()
+	if budget.Status != BUDGET_SUSPENDED {
+		if next := settledStatus(budget); next != budget.Status {
+			return transitionBudget(budget, next, "", "")
+		}
+	}
+	return nil
+}
+
 // readBudget fetches and unmarshals a PrivacyBudget from the ledger.
 func (s *PrivacyBudgetContract) readBudget(
 	ctx TransactionContextInterface,
@@ -520,14 +932,54 @@ func (s *PrivacyBudgetContract) readBudget(
 		return nil, "", fmt.Errorf("readBudget: ledger read error: %v", err)
 	}
 	if raw == nil {
-		return nil, "", fmt.Errorf("readBudget: no budget found for user=%s dataset=%s", userID, datasetID)
+		return nil, "", codedErrorf(ERR_NOT_FOUND, "readBudget: no budget found for user=%s dataset=%s", userID, datasetID)
+	}
+
+	budget, err := s.loadBudget(ctx, raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("readBudget: %v", err)
+	}
+	return budget, key, nil
+}
+
+// loadBudget decodes a stored budget. Budgets written before schema v4 lack
+// query counters and those written before v5 lack the log sequence, so they
+// are recomputed from the budget's consumption logs until MigrateRecords
+// persists them.
+func (s *PrivacyBudgetContract) loadBudget(
+	ctx TransactionContextInterface,
+	raw []byte,
+) (*PrivacyBudget, error) {
+	budget, _, err := decodeBudget(raw)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal error: %v", err)
+	}
+	version, err := storedSchemaVersion(raw)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal error: %v", err)
+	}
+	if version >= 5 {
+		return budget, nil
 	}
 
-	var budget PrivacyBudget
-	if err := json.Unmarshal(raw, &budget); err != nil {
-		return nil, "", fmt.Errorf("readBudget: unmarshal error: %v", err)
+	logs, err := s.GetConsumptionLogs(ctx, budget.UserID, budget.DatasetID)
+	if err != nil {
+		return nil, fmt.Errorf("counter backfill error: %v", err)
+	}
+	// Until the budget is v5 every entry predates sequence numbers, so the
+	// MigrateRecords numbering of the logs ends at len(logs).
+	budget.LogSequence = len(logs)
+	if version >= 4 {
+		return budget, nil
+	}
+	for _, entry := range logs {
+		budget.QueryCount++
+		budget.MaxEpsilon = max(budget.MaxEpsilon, entry.EpsilonUsed)
+		if entry.Timestamp > budget.LastQueryAt {
+			budget.LastQueryAt = entry.Timestamp
+		}
 	}
-	return &budget, key, nil
+	return budget, nil
 }
 
 // writeLog persists a BudgetConsumptionLog entry and its index keys.
@@ -535,7 +987,7 @@ func (s *PrivacyBudgetContract) writeLog(
 	ctx TransactionContextInterface,
 	entry *BudgetConsumptionLog,
 ) error {
-	lk, err := logKey(ctx, entry.UserID, entry.DatasetID, entry.TxID)
+	lk, err := logKey(ctx, entry.UserID, entry.DatasetID, logRef(entry))
 	if err != nil {
 		return fmt.Errorf("writeLog: key error: %v", err)
 	}
@@ -548,7 +1000,7 @@ func (s *PrivacyBudgetContract) writeLog(
 		return fmt.Errorf("writeLog: put error: %v", err)
 	}
 
-	byUser, byDataset, err := logIndexKeys(ctx, entry.UserID, entry.DatasetID, entry.TxID)
+	byUser, byDataset, err := logIndexKeys(ctx, entry.UserID, entry.DatasetID, logRef(entry))
 	if err != nil {
 		return fmt.Errorf("writeLog: index key error: %v", err)
 	}
@@ -558,6 +1010,190 @@ func (s *PrivacyBudgetContract) writeLog(
 	if err := ctx.GetStub().PutState(byDataset, []byte{0x00}); err != nil {
 		return fmt.Errorf("writeLog: index put error: %v", err)
 	}
+	if entry.Purpose != "" {
+		byPurpose, err := logPurposeIndexKey(ctx, entry.Purpose, entry.DatasetID, entry.UserID, logRef(entry))
+		if err != nil {
+			return fmt.Errorf("writeLog: index key error: %v", err)
+		}
+		if err := ctx.GetStub().PutState(byPurpose, []byte{0x00}); err != nil {
+			return fmt.Errorf("writeLog: index put error: %v", err)
+		}
+	}
+	byDayDataset, byDayUser, err := logDayIndexKeys(ctx, entry)
+	if err != nil {
+		return fmt.Errorf("writeLog: index key error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(byDayDataset, []byte{0x00}); err != nil {
+		return fmt.Errorf("writeLog: index put error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(byDayUser, []byte{0x00}); err != nil {
+		return fmt.Errorf("writeLog: index put error: %v", err)
+	}
+	return nil
+}
+
+// putBudget marshals and stores a PrivacyBudget under its primary key,
+// stamped with the submitting MSP, updates the dataset's aggregates and
+// queues the events for the change.
+func (s *PrivacyBudgetContract) putBudget(
+	ctx TransactionContextInterface,
+	key string,
+	budget *PrivacyBudget,
+) error {
+	before, err := readStagedBudget(ctx, key)
+	if err != nil {
+		return err
+	}
+	budget.UpdatedBy = ctx.GetMspID()
+	ensureSubjectCommitment(ctx, budget)
+	data, err := json.Marshal(budget)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("put error: %v", err)
+	}
+	ctx.StageState(key, data)
+	if err := trackBudgetChange(ctx, before, budget); err != nil {
+		return err
+	}
+	return emitBudgetChange(ctx, before, budget)
+}
+
+// putBudgetWithIndexes persists a PrivacyBudget that is new or has gained an
+// agreement, stamped with the
+// submitting MSP, together with its secondary index entries, updates the
+// dataset's aggregates and queues the events for the change.
+func (s *PrivacyBudgetContract) putBudgetWithIndexes(
+	ctx TransactionContextInterface,
+	budget *PrivacyBudget,
+) error {
+	key, err := budgetKey(ctx, budget.UserID, budget.DatasetID)
+	if err != nil {
+		return fmt.Errorf("putBudgetWithIndexes: key error: %v", err)
+	}
+	before, err := readStagedBudget(ctx, key)
+	if err != nil {
+		return fmt.Errorf("putBudgetWithIndexes: %v", err)
+	}
+	budget.UpdatedBy = ctx.GetMspID()
+	ensureSubjectCommitment(ctx, budget)
+	data, err := json.Marshal(budget)
+	if err != nil {
+		return fmt.Errorf("putBudgetWithIndexes: marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("putBudgetWithIndexes: put error: %v", err)
+	}
+	ctx.StageState(key, data)
+	if err := trackBudgetChange(ctx, before, budget); err != nil {
+		return fmt.Errorf("putBudgetWithIndexes: %v", err)
+	}
+	if err := emitBudgetChange(ctx, before, budget); err != nil {
+		return fmt.Errorf("putBudgetWithIndexes: %v", err)
+	}
+
+	// Write index entries (value is empty – they just point to the primary key).
+	byUser, byDataset, err := budgetIndexKeys(ctx, budget.UserID, budget.DatasetID)
+	if err != nil {
+		return fmt.Errorf("putBudgetWithIndexes: index key error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(byUser, []byte{0x00}); err != nil {
+		return fmt.Errorf("putBudgetWithIndexes: index put error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(byDataset, []byte{0x00}); err != nil {
+		return fmt.Errorf("putBudgetWithIndexes: index put error: %v", err)
+	}
+	if budget.AgreementID != "" {
+		byAgreement, err := budgetAgreementIndexKey(ctx, budget.AgreementID, budget.UserID, budget.DatasetID)
+		if err != nil {
+			return fmt.Errorf("putBudgetWithIndexes: index key error: %v", err)
+		}
+		if err := ctx.GetStub().PutState(byAgreement, []byte{0x00}); err != nil {
+			return fmt.Errorf("putBudgetWithIndexes: index put error: %v", err)
+		}
+	}
+	return nil
+}
+
+// deleteBudget removes a PrivacyBudget and its secondary index entries,
+// updates the dataset's aggregates and queues a BudgetErased event naming
+// the pseudonym the budget moves to.
+func (s *PrivacyBudgetContract) deleteBudget(
+	ctx TransactionContextInterface,
+	budget *PrivacyBudget,
+	pseudonym string,
+) error {
+	key, err := budgetKey(ctx, budget.UserID, budget.DatasetID)
+	if err != nil {
+		return fmt.Errorf("deleteBudget: key error: %v", err)
+	}
+	before, err := readStagedBudget(ctx, key)
+	if err != nil {
+		return fmt.Errorf("deleteBudget: %v", err)
+	}
+	byUser, byDataset, err := budgetIndexKeys(ctx, budget.UserID, budget.DatasetID)
+	if err != nil {
+		return fmt.Errorf("deleteBudget: index key error: %v", err)
+	}
+	keys := []string{key, byUser, byDataset}
+	if budget.AgreementID != "" {
+		byAgreement, err := budgetAgreementIndexKey(ctx, budget.AgreementID, budget.UserID, budget.DatasetID)
+		if err != nil {
+			return fmt.Errorf("deleteBudget: index key error: %v", err)
+		}
+		keys = append(keys, byAgreement)
+	}
+	for _, k := range keys {
+		if err := ctx.GetStub().DelState(k); err != nil {
+			return fmt.Errorf("deleteBudget: delete error: %v", err)
+		}
+	}
+	ctx.StageState(key, nil)
+	if err := trackBudgetChange(ctx, before, nil); err != nil {
+		return fmt.Errorf("deleteBudget: %v", err)
+	}
+	if err := emitEvent(ctx, EVENT_BUDGET_ERASED, &BudgetErasedPayload{
+		DatasetID:         budget.DatasetID,
+		SubjectCommitment: budget.SubjectCommitment,
+		Pseudonym:         pseudonym,
+	}); err != nil {
+		return fmt.Errorf("deleteBudget: %v", err)
+	}
+	return nil
+}
+
+// deleteLog removes a BudgetConsumptionLog entry and its index keys.
+func (s *PrivacyBudgetContract) deleteLog(
+	ctx TransactionContextInterface,
+	entry *BudgetConsumptionLog,
+) error {
+	lk, err := logKey(ctx, entry.UserID, entry.DatasetID, logRef(entry))
+	if err != nil {
+		return fmt.Errorf("deleteLog: key error: %v", err)
+	}
+	byUser, byDataset, err := logIndexKeys(ctx, entry.UserID, entry.DatasetID, logRef(entry))
+	if err != nil {
+		return fmt.Errorf("deleteLog: index key error: %v", err)
+	}
+	keys := []string{lk, byUser, byDataset}
+	if entry.Purpose != "" {
+		byPurpose, err := logPurposeIndexKey(ctx, entry.Purpose, entry.DatasetID, entry.UserID, logRef(entry))
+		if err != nil {
+			return fmt.Errorf("deleteLog: index key error: %v", err)
+		}
+		keys = append(keys, byPurpose)
+	}
+	byDayDataset, byDayUser, err := logDayIndexKeys(ctx, entry)
+	if err != nil {
+		return fmt.Errorf("deleteLog: index key error: %v", err)
+	}
+	keys = append(keys, byDayDataset, byDayUser)
+	for _, k := range keys {
+		if err := ctx.GetStub().DelState(k); err != nil {
+			return fmt.Errorf("deleteLog: delete error: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -575,31 +1211,91 @@ func (s *PrivacyBudgetContract) queryBudgetsByIndex(
 	}
 	defer iter.Close()
 
-	var results []*PrivacyBudget
+	results := []*PrivacyBudget{}
 	for iter.HasNext() {
 		kv, err := iter.Next()
 		if err != nil {
 			return nil, fmt.Errorf("queryBudgetsByIndex: iterator error: %v", err)
 		}
-
-		_, parts, err := ctx.GetStub().SplitCompositeKey(kv.Key)
-		if err != nil || len(parts) < 2 {
-			continue
+		if budget := s.budgetFromIndexKey(ctx, indexName, kv.Key); budget != nil {
+			results = append(results, budget)
 		}
+	}
+	return results, nil
+}
 
-		// Determine userID / datasetID from the index shape.
-		var uid, did string
-		if indexName == INDEX_BUDGET_BY_USER {
-			uid, did = parts[0], parts[1]
-		} else {
-			did, uid = parts[0], parts[1]
+// budgetFromIndexKey resolves a budget index entry to the budget it points
+// at. It returns nil when the key is malformed or the budget is gone.
+func (s *PrivacyBudgetContract) budgetFromIndexKey(
+	ctx TransactionContextInterface,
+	indexName string,
+	key string,
+) *PrivacyBudget {
+	_, parts, err := ctx.GetStub().SplitCompositeKey(key)
+	if err != nil || len(parts) < 2 {
+		return nil
+	}
+
+	// Determine userID / datasetID from the index shape.
+	var uid, did string
+	switch indexName {
+	case INDEX_BUDGET_BY_USER:
+		uid, did = parts[0], parts[1]
+	case INDEX_BUDGET_BY_AGREEMENT:
+		if len(parts) < 3 {
+			return nil
+		}
+		uid, did = parts[1], parts[2]
+	case INDEX_BUDGET_BY_CONSUMED:
+		if len(parts) < 3 {
+			return nil
 		}
+		did, uid = parts[0], parts[2]
+	default:
+		did, uid = parts[0], parts[1]
+	}
 
-		budget, _, err := s.readBudget(ctx, uid, did)
-		if err != nil {
-			continue
+	budget, _, err := s.readBudget(ctx, uid, did)
+	if err != nil {
+		return nil
+	}
+	return budget
+}
+
+// logFromIndexKey resolves a consumption-log index entry to the log it
+// points at. Index entries store only a pointer byte, so the attributes are
+// taken from the composite key. It returns nil when the key is malformed or
+// the log is gone.
+func logFromIndexKey(ctx TransactionContextInterface, indexName, key string) *BudgetConsumptionLog {
+	_, parts, err := ctx.GetStub().SplitCompositeKey(key)
+	if err != nil || len(parts) < 3 {
+		return nil
+	}
+
+	var uid, did, ref string
+	switch indexName {
+	case INDEX_LOG_BY_USER:
+		uid, did, ref = parts[0], parts[1], parts[2]
+	case INDEX_LOG_BY_PURPOSE:
+		if len(parts) < 4 {
+			return nil
 		}
-		results = append(results, budget)
+		did, uid, ref = parts[1], parts[2], parts[3]
+	default:
+		did, uid, ref = parts[0], parts[1], parts[2]
 	}
-	return results, nil
+
+	lk, err := logKey(ctx, uid, did, ref)
+	if err != nil {
+		return nil
+	}
+	raw, err := ctx.GetStub().GetState(lk)
+	if err != nil || raw == nil {
+		return nil
+	}
+	entry, _, err := decodeLog(raw)
+	if err != nil {
+		return nil
+	}
+	return entry
 }
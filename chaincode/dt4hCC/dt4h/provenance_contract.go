@@ -0,0 +1,381 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+)
+
+// ============================================================================
+// Provenance Contract – derivations between datasets
+// ============================================================================
+
+// derivationKey returns the primary composite key for a Derivation. Keying by
+// child first lets a partial-key query list a dataset's parents.
+func derivationKey(ctx TransactionContextInterface, childID, parentID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(DERIVATION_OBJECT_TYPE, []string{childID, parentID})
+}
+
+// derivationParentIndexKey creates the index key used to list the datasets
+// derived from a parent.
+func derivationParentIndexKey(ctx TransactionContextInterface, parentID, childID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(INDEX_DERIVATION_BY_PARENT, []string{parentID, childID})
+}
+
+// ---------------------------------------------------------------------------
+// Write operations
+// ---------------------------------------------------------------------------
+
+// RecordDerivation links a derived dataset to a dataset it was produced
+// from. Only the MSP owning the derived dataset may record its lineage.
+// Queries on the child are charged to the parent's dataset-level budget, so
+// a derivation from another MSP's dataset stays Proposed until that MSP
+// approves it with ApproveDerivation; one from the caller's own dataset is
+// Active at once. Derivations are permanent and may not form a cycle.
+//
+// Parameters:
+//   - childID:     the derived dataset, registered and Active
+//   - parentID:    the registered dataset it was derived from
+//   - description: how the child was produced (e.g. "curated, 3 columns added")
+func (s *ProvenanceContract) RecordDerivation(
+	ctx TransactionContextInterface,
+	childID string,
+	parentID string,
+	description string,
+) (*Derivation, error) {
+	method := "RecordDerivation"
+
+	if childID == parentID {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: a dataset cannot be derived from itself", method)
+	}
+	child, _, err := readOwnedDataset(ctx, childID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if child.Status != DATASET_ACTIVE {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: dataset %s is %s", method, childID, child.Status)
+	}
+	parent, _, err := readDataset(ctx, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	key, err := derivationKey(ctx, childID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ledger read error: %v", method, err)
+	}
+	if existing != nil {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: %s is already recorded as derived from %s", method, childID, parentID)
+	}
+	ancestors, err := ancestorIDs(ctx, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if slices.Contains(ancestors, childID) {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: %s is an ancestor of %s, the derivation would form a cycle", method, childID, parentID)
+	}
+
+	now := ctx.GetTimestamp()
+	derivation := &Derivation{
+		ObjectType:    DERIVATION_OBJECT_TYPE,
+		SchemaVersion: DERIVATION_SCHEMA_VERSION,
+		ChildID:       childID,
+		ParentID:      parentID,
+		Description:   description,
+		RecordedBy:    ctx.GetMspID(),
+		Status:        DERIVATION_PROPOSED,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if parent.OwnerMSP == ctx.GetMspID() {
+		derivation.Status = DERIVATION_ACTIVE
+		derivation.ApprovedBy = ctx.GetMspID()
+	}
+	if err := putDerivation(ctx, key, derivation); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	idx, err := derivationParentIndexKey(ctx, parentID, childID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: index key error: %v", method, err)
+	}
+	if err := ctx.GetStub().PutState(idx, []byte{0x00}); err != nil {
+		return nil, fmt.Errorf("%s: index put error: %v", method, err)
+	}
+
+	log.Printf("%s: dataset=%s derivedFrom=%s status=%s", method, childID, parentID, derivation.Status)
+	return derivation, nil
+}
+
+// ApproveDerivation puts a Proposed derivation in force. Only the MSP owning
+// the parent dataset may approve it, since queries on the child are then
+// charged to the parent's dataset-level budget.
+//
+// Parameters:
+//   - childID:  the derived dataset
+//   - parentID: the caller's dataset it was derived from
+func (s *ProvenanceContract) ApproveDerivation(
+	ctx TransactionContextInterface,
+	childID string,
+	parentID string,
+) (*Derivation, error) {
+	method := "ApproveDerivation"
+
+	if _, _, err := readOwnedDataset(ctx, parentID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	derivation, err := readDerivation(ctx, childID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if derivation.Status != DERIVATION_PROPOSED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: derivation of %s from %s is already %s", method, childID, parentID, derivation.Status)
+	}
+	// Derivations approved since this one was recorded may close a cycle.
+	ancestors, err := ancestorIDs(ctx, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if slices.Contains(ancestors, childID) {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: %s is an ancestor of %s, the derivation would form a cycle", method, childID, parentID)
+	}
+
+	derivation.Status = DERIVATION_ACTIVE
+	derivation.ApprovedBy = ctx.GetMspID()
+	derivation.UpdatedAt = ctx.GetTimestamp()
+	key, err := derivationKey(ctx, childID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	if err := putDerivation(ctx, key, derivation); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: dataset=%s derivedFrom=%s approvedBy=%s", method, childID, parentID, derivation.ApprovedBy)
+	return derivation, nil
+}
+
+// ---------------------------------------------------------------------------
+// Read / query operations
+// ---------------------------------------------------------------------------
+
+// GetParents returns the derivations a dataset was directly produced by.
+func (s *ProvenanceContract) GetParents(
+	ctx TransactionContextInterface,
+	datasetID string,
+) ([]*Derivation, error) {
+	method := "GetParents"
+
+	parents, err := readParentDerivations(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	return parents, nil
+}
+
+// GetChildren returns the derivations directly produced from a dataset.
+func (s *ProvenanceContract) GetChildren(
+	ctx TransactionContextInterface,
+	datasetID string,
+) ([]*Derivation, error) {
+	method := "GetChildren"
+
+	childIDs, err := readChildIDs(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	children := []*Derivation{}
+	for _, childID := range childIDs {
+		derivation, err := readDerivation(ctx, childID, datasetID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		children = append(children, derivation)
+	}
+	return children, nil
+}
+
+// GetLineage walks the Active derivations in both directions from a dataset
+// and returns every derivation reached, nearest first. A dataset reachable
+// along several paths is expanded once, at its smallest depth.
+func (s *ProvenanceContract) GetLineage(
+	ctx TransactionContextInterface,
+	datasetID string,
+) (*Lineage, error) {
+	method := "GetLineage"
+
+	if _, _, err := readDataset(ctx, datasetID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	lineage := &Lineage{DatasetID: datasetID, Ancestors: []*LineageEdge{}, Descendants: []*LineageEdge{}}
+
+	// ---------- ancestors ----------
+	visited := map[string]bool{datasetID: true}
+	frontier := []string{datasetID}
+	for depth := 1; len(frontier) > 0; depth++ {
+		var next []string
+		for _, id := range frontier {
+			parents, err := readParentDerivations(ctx, id)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", method, err)
+			}
+			for _, d := range parents {
+				if d.Status != DERIVATION_ACTIVE {
+					continue
+				}
+				lineage.Ancestors = append(lineage.Ancestors, &LineageEdge{ChildID: id, ParentID: d.ParentID, Depth: depth})
+				if !visited[d.ParentID] {
+					visited[d.ParentID] = true
+					next = append(next, d.ParentID)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	// ---------- descendants ----------
+	visited = map[string]bool{datasetID: true}
+	frontier = []string{datasetID}
+	for depth := 1; len(frontier) > 0; depth++ {
+		var next []string
+		for _, id := range frontier {
+			childIDs, err := readChildIDs(ctx, id)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", method, err)
+			}
+			for _, childID := range childIDs {
+				d, err := readDerivation(ctx, childID, id)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", method, err)
+				}
+				if d.Status != DERIVATION_ACTIVE {
+					continue
+				}
+				lineage.Descendants = append(lineage.Descendants, &LineageEdge{ChildID: childID, ParentID: id, Depth: depth})
+				if !visited[childID] {
+					visited[childID] = true
+					next = append(next, childID)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	return lineage, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// ancestorIDs returns every dataset a dataset was derived from, directly or
+// transitively, through Active derivations, each listed once.
+func ancestorIDs(ctx TransactionContextInterface, datasetID string) ([]string, error) {
+	ancestors := []string{}
+	frontier := []string{datasetID}
+	for len(frontier) > 0 {
+		var next []string
+		for _, id := range frontier {
+			parents, err := readParentDerivations(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range parents {
+				if d.Status != DERIVATION_ACTIVE {
+					continue
+				}
+				if d.ParentID == datasetID || slices.Contains(ancestors, d.ParentID) {
+					continue
+				}
+				ancestors = append(ancestors, d.ParentID)
+				next = append(next, d.ParentID)
+			}
+		}
+		frontier = next
+	}
+	return ancestors, nil
+}
+
+// readParentDerivations returns the derivations recorded for a child dataset.
+func readParentDerivations(ctx TransactionContextInterface, childID string) ([]*Derivation, error) {
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(DERIVATION_OBJECT_TYPE, []string{childID})
+	if err != nil {
+		return nil, fmt.Errorf("readParentDerivations: %v", err)
+	}
+	defer iter.Close()
+
+	derivations := []*Derivation{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("readParentDerivations: iterator error: %v", err)
+		}
+		derivation, _, err := decodeDerivation(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("readParentDerivations: unmarshal error: %v", err)
+		}
+		derivations = append(derivations, derivation)
+	}
+	return derivations, nil
+}
+
+// readChildIDs returns the IDs of the datasets derived directly from a parent.
+func readChildIDs(ctx TransactionContextInterface, parentID string) ([]string, error) {
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(INDEX_DERIVATION_BY_PARENT, []string{parentID})
+	if err != nil {
+		return nil, fmt.Errorf("readChildIDs: %v", err)
+	}
+	defer iter.Close()
+
+	childIDs := []string{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("readChildIDs: iterator error: %v", err)
+		}
+		_, parts, err := ctx.GetStub().SplitCompositeKey(kv.Key)
+		if err != nil || len(parts) < 2 {
+			continue
+		}
+		childIDs = append(childIDs, parts[1])
+	}
+	return childIDs, nil
+}
+
+// putDerivation marshals and stores a Derivation under its primary key.
+func putDerivation(ctx TransactionContextInterface, key string, derivation *Derivation) error {
+	data, err := json.Marshal(derivation)
+	if err != nil {
+		return fmt.Errorf("putDerivation: marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("putDerivation: put error: %v", err)
+	}
+	return nil
+}
+
+// readDerivation fetches and unmarshals a single Derivation.
+func readDerivation(ctx TransactionContextInterface, childID, parentID string) (*Derivation, error) {
+	key, err := derivationKey(ctx, childID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("readDerivation: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("readDerivation: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, codedErrorf(ERR_NOT_FOUND, "readDerivation: %s is not recorded as derived from %s", childID, parentID)
+	}
+
+	derivation, _, err := decodeDerivation(raw)
+	if err != nil {
+		return nil, fmt.Errorf("readDerivation: unmarshal error: %v", err)
+	}
+	return derivation, nil
+}
@@ -0,0 +1,218 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// ============================================================================
+// Purpose Contract – controlled vocabulary of purposes of processing
+// ============================================================================
+
+// purposeKey returns the primary composite key for a Purpose.
+func purposeKey(ctx TransactionContextInterface, purposeID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(PURPOSE_OBJECT_TYPE, []string{purposeID})
+}
+
+// ---------------------------------------------------------------------------
+// Write operations
+// ---------------------------------------------------------------------------
+
+// DefinePurpose adds a purpose of processing to the vocabulary.
+//
+// Parameters:
+//   - purposeID:    short identifier declared on queries (e.g. "clinical-research")
+//   - description:  what processing under this purpose covers
+//   - secondaryUse: whether the purpose is further processing beyond the
+//     reason the data was collected
+func (s *PurposeContract) DefinePurpose(
+	ctx TransactionContextInterface,
+	purposeID string,
+	description string,
+	secondaryUse bool,
+) (*Purpose, error) {
+	method := "DefinePurpose"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if purposeID == "" || description == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: purposeID and description are required", method)
+	}
+
+	key, err := purposeKey(ctx, purposeID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ledger read error: %v", method, err)
+	}
+	if existing != nil {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: purpose %s already exists", method, purposeID)
+	}
+
+	now := ctx.GetTimestamp()
+	purpose := &Purpose{
+		ObjectType:    PURPOSE_OBJECT_TYPE,
+		SchemaVersion: PURPOSE_SCHEMA_VERSION,
+		PurposeID:     purposeID,
+		Description:   description,
+		SecondaryUse:  secondaryUse,
+		Status:        PURPOSE_ACTIVE,
+		DefinedBy:     ctx.GetMspID(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := putPurpose(ctx, key, purpose); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: defined purpose=%s secondaryUse=%t", method, purposeID, secondaryUse)
+	return purpose, nil
+}
+
+// DeprecatePurpose withdraws a purpose from the vocabulary. Records that
+// already carry it are unchanged, but it can no longer be declared on
+// queries or used in new consents and budget restrictions.
+func (s *PurposeContract) DeprecatePurpose(
+	ctx TransactionContextInterface,
+	purposeID string,
+) (*Purpose, error) {
+	method := "DeprecatePurpose"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	purpose, err := readPurpose(ctx, purposeID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if purpose.Status == PURPOSE_DEPRECATED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: purpose %s is already %s", method, purposeID, PURPOSE_DEPRECATED)
+	}
+
+	purpose.Status = PURPOSE_DEPRECATED
+	purpose.UpdatedAt = ctx.GetTimestamp()
+	key, err := purposeKey(ctx, purposeID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	if err := putPurpose(ctx, key, purpose); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: deprecated purpose=%s", method, purposeID)
+	return purpose, nil
+}
+
+// ---------------------------------------------------------------------------
+// Read / query operations
+// ---------------------------------------------------------------------------
+
+// GetPurpose returns a vocabulary entry.
+func (s *PurposeContract) GetPurpose(
+	ctx TransactionContextInterface,
+	purposeID string,
+) (*Purpose, error) {
+	return readPurpose(ctx, purposeID)
+}
+
+// ListPurposes returns the whole vocabulary, including deprecated entries.
+func (s *PurposeContract) ListPurposes(
+	ctx TransactionContextInterface,
+) ([]*Purpose, error) {
+	method := "ListPurposes"
+
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(PURPOSE_OBJECT_TYPE, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	purposes := []*Purpose{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		purpose, _, err := decodePurpose(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+		}
+		purposes = append(purposes, purpose)
+	}
+	return purposes, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// assertPurposeActive returns the vocabulary entry of a purpose, rejecting
+// unknown and deprecated purposes.
+func assertPurposeActive(ctx TransactionContextInterface, purposeID string) (*Purpose, error) {
+	if purposeID == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "a purpose of processing is required")
+	}
+	purpose, err := readPurpose(ctx, purposeID)
+	if err != nil {
+		return nil, err
+	}
+	if purpose.Status != PURPOSE_ACTIVE {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "purpose %s is %s", purposeID, purpose.Status)
+	}
+	return purpose, nil
+}
+
+// parsePurposeList decodes a JSON array of purpose IDs and checks that every
+// entry is an active vocabulary purpose.
+func parsePurposeList(ctx TransactionContextInterface, purposesJSON string) ([]string, error) {
+	var purposes []string
+	if err := json.Unmarshal([]byte(purposesJSON), &purposes); err != nil {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "invalid purposes JSON: %v", err)
+	}
+	if purposes == nil {
+		purposes = []string{}
+	}
+	for _, id := range purposes {
+		if _, err := assertPurposeActive(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return purposes, nil
+}
+
+// readPurpose fetches and unmarshals a Purpose from the ledger.
+func readPurpose(ctx TransactionContextInterface, purposeID string) (*Purpose, error) {
+	key, err := purposeKey(ctx, purposeID)
+	if err != nil {
+		return nil, fmt.Errorf("readPurpose: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("readPurpose: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, codedErrorf(ERR_NOT_FOUND, "readPurpose: purpose %s is not in the vocabulary", purposeID)
+	}
+
+	purpose, _, err := decodePurpose(raw)
+	if err != nil {
+		return nil, fmt.Errorf("readPurpose: unmarshal error: %v", err)
+	}
+	return purpose, nil
+}
+
+// putPurpose marshals and stores a Purpose.
+func putPurpose(ctx TransactionContextInterface, key string, purpose *Purpose) error {
+	data, err := json.Marshal(purpose)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("put error: %v", err)
+	}
+	return nil
+}
@@ -12,69 +12,66 @@ import (
 
 // LogQuery records a query on the ledger, deducting the given epsilon from the
 // caller's privacy budget for the specified dataset. The transaction is
-// rejected if the remaining budget is insufficient.
+// rejected if the remaining budget is insufficient, or if the declared purpose
+// is not in the vocabulary, not allowed by the budget or not covered by the
+// dataset's current consent.
 //
 // Parameters:
 //   - datasetID:   the dataset being queried
 //   - queryBody:   the query text / description (for auditing)
 //   - epsilonUsed: the differential-privacy cost of this query
+//   - purpose:     the vocabulary purpose of processing the query serves
 func (s *QueryContract) LogQuery(
 	ctx TransactionContextInterface,
 	datasetID string,
 	queryBody string,
 	epsilonUsed float64,
+	purpose string,
 ) (*BudgetConsumptionLog, error) {
 	method := "LogQuery"
 
 	userID := ctx.GetUserID()
 	if userID == "" {
-		return nil, fmt.Errorf("%s: caller identity not set", method)
+		return nil, codedErrorf(ERR_UNAUTHORIZED, "%s: caller identity not set", method)
 	}
 
 	// ---------- consume budget ----------
 	budgetContract := new(PrivacyBudgetContract)
-	budget, err := budgetContract.ConsumeBudget(ctx, userID, datasetID, epsilonUsed, queryBody)
+	budget, logEntry, err := budgetContract.consumeBudget(ctx, userID, datasetID, epsilonUsed, queryBody, purpose)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %v", method, err)
 	}
 
 	// ---------- also write a per-user query log for GetUserHistory ----------
-	txID := ctx.GetStub().GetTxID()
 	q := Query{
-		QueryBody:   queryBody,
-		DatasetID:   datasetID,
-		EpsilonUsed: epsilonUsed,
-		Timestamp:   nowUTC(),
-		TxID:        txID,
+		ObjectType:    QUERY_LOG_OBJECT_TYPE,
+		SchemaVersion: QUERY_SCHEMA_VERSION,
+		QueryBody:     queryBody,
+		DatasetID:     datasetID,
+		Purpose:       purpose,
+		EpsilonUsed:   epsilonUsed,
+		Timestamp:     logEntry.Timestamp,
+		TxID:          logEntry.TxID,
 	}
-	qBytes, err := json.Marshal(q)
-	if err != nil {
-		return nil, fmt.Errorf("%s: marshal error: %v", method, err)
-	}
-
-	queryKey, err := ctx.GetStub().CreateCompositeKey(QUERY_LOG_OBJECT_TYPE, []string{userID, txID})
-	if err != nil {
-		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	if err := putQuery(ctx, userID, &q); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
 	}
-	if err := ctx.GetStub().PutState(queryKey, qBytes); err != nil {
-		return nil, fmt.Errorf("%s: put error: %v", method, err)
+	if err := emitEvent(ctx, EVENT_QUERY_LOGGED, &QueryLoggedPayload{
+		UserID:      userID,
+		DatasetID:   datasetID,
+		Purpose:     purpose,
+		EpsilonUsed: epsilonUsed,
+		QueryDigest: logEntry.QueryDigest,
+		Sequence:    logEntry.Sequence,
+	}); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
 	}
 
 	log.Printf("%s: logged query user=%s dataset=%s ε=%f remaining=%f",
 		method, userID, datasetID, epsilonUsed, budget.RemainingBudget())
 
 	// Return the consumption log entry so the caller sees the result.
-	return &BudgetConsumptionLog{
-		ObjectType:        BUDGET_LOG_OBJECT_TYPE,
-		UserID:            userID,
-		DatasetID:         datasetID,
-		QueryBody:         queryBody,
-		EpsilonUsed:       epsilonUsed,
-		CumulativeEpsilon: budget.ConsumedBudget,
-		RemainingEpsilon:  budget.RemainingBudget(),
-		TxID:              txID,
-		Timestamp:         q.Timestamp,
-	}, nil
+	return logEntry, nil
 }
 
 // GetUserHistory returns all queries logged by the given user across all
@@ -91,17 +88,17 @@ func (s *QueryContract) GetUserHistory(
 	}
 	defer iter.Close()
 
-	var queries []Query
+	queries := []Query{}
 	for iter.HasNext() {
 		kv, err := iter.Next()
 		if err != nil {
 			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
 		}
-		var q Query
-		if err := json.Unmarshal(kv.Value, &q); err != nil {
+		q, _, err := decodeQuery(kv.Value)
+		if err != nil {
 			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
 		}
-		queries = append(queries, q)
+		queries = append(queries, *q)
 	}
 
 	return &UserHistory{UserID: userID, Queries: queries}, nil
@@ -114,3 +111,57 @@ func (s *QueryContract) GetMyHistory(
 ) (*UserHistory, error) {
 	return s.GetUserHistory(ctx, ctx.GetUserID())
 }
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// queryKey returns the primary composite key for a user's query log entry.
+func queryKey(ctx TransactionContextInterface, userID, txID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(QUERY_LOG_OBJECT_TYPE, []string{userID, txID})
+}
+
+// putQuery persists a query log entry together with its index keys.
+func putQuery(ctx TransactionContextInterface, userID string, q *Query) error {
+	key, err := queryKey(ctx, userID, q.TxID)
+	if err != nil {
+		return fmt.Errorf("putQuery: key error: %v", err)
+	}
+	data, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Errorf("putQuery: marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("putQuery: put error: %v", err)
+	}
+
+	byDayDataset, byDayUser, err := queryDayIndexKeys(ctx, userID, q)
+	if err != nil {
+		return fmt.Errorf("putQuery: index key error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(byDayDataset, []byte{0x00}); err != nil {
+		return fmt.Errorf("putQuery: index put error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(byDayUser, []byte{0x00}); err != nil {
+		return fmt.Errorf("putQuery: index put error: %v", err)
+	}
+	return nil
+}
+
+// deleteQuery removes a query log entry and its index keys.
+func deleteQuery(ctx TransactionContextInterface, userID string, q *Query) error {
+	key, err := queryKey(ctx, userID, q.TxID)
+	if err != nil {
+		return fmt.Errorf("deleteQuery: key error: %v", err)
+	}
+	byDayDataset, byDayUser, err := queryDayIndexKeys(ctx, userID, q)
+	if err != nil {
+		return fmt.Errorf("deleteQuery: index key error: %v", err)
+	}
+	for _, k := range []string{key, byDayDataset, byDayUser} {
+		if err := ctx.GetStub().DelState(k); err != nil {
+			return fmt.Errorf("deleteQuery: delete error: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Rich queries – status and ε-threshold filters
+// ============================================================================
+//
+// On CouchDB these functions run selector queries backed by the indexes in
+// META-INF/statedb/couchdb/indexes. On LevelDB, which has no query engine,
+// they fall back to scanning the composite keys and filtering in memory.
+// Records must carry their current "type" field to be found by CouchDB, so
+// run MigrateRecords on legacy data first.
+
+// Design documents and index names shipped under META-INF.
+const (
+	couchIndexBudgetStatus      = "indexBudgetStatus"
+	couchIndexLogEpsilon        = "indexLogEpsilon"
+	couchIndexLogDatasetEpsilon = "indexLogDatasetEpsilon"
+)
+
+// levelDBQueryUnsupported is part of the error a peer with a LevelDB state
+// database returns for every rich query.
+const levelDBQueryUnsupported = "not supported for leveldb"
+
+// GetBudgetsByStatus returns every budget with the given status.
+func (s *PrivacyBudgetContract) GetBudgetsByStatus(
+	ctx TransactionContextInterface,
+	status string,
+) ([]*PrivacyBudget, error) {
+	method := "GetBudgetsByStatus"
+
+	if _, known := budgetTransitions[status]; !known {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: unknown budget status %q", method, status)
+	}
+
+	budgets := []*PrivacyBudget{}
+	keep := func(value []byte) error {
+		budget, _, err := decodeBudget(value)
+		if err != nil {
+			return fmt.Errorf("unmarshal error: %v", err)
+		}
+		if budget.Status == status {
+			budgets = append(budgets, budget)
+		}
+		return nil
+	}
+
+	selector := map[string]any{"type": PRIVACY_BUDGET_OBJECT_TYPE, "status": status}
+	served, err := richQuery(ctx, selector, couchIndexBudgetStatus, keep)
+	if err == nil && !served {
+		err = scanValues(ctx, PRIVACY_BUDGET_OBJECT_TYPE, keep)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	return budgets, nil
+}
+
+// GetConsumptionLogsAboveEpsilon returns the consumption entries that spent
+// more than threshold ε in a single query, oldest first, optionally narrowed
+// to one dataset (pass "" for all datasets).
+func (s *PrivacyBudgetContract) GetConsumptionLogsAboveEpsilon(
+	ctx TransactionContextInterface,
+	threshold float64,
+	datasetID string,
+) ([]*BudgetConsumptionLog, error) {
+	method := "GetConsumptionLogsAboveEpsilon"
+
+	if threshold < 0 {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: threshold must be >= 0, got %f", method, threshold)
+	}
+
+	selector := map[string]any{
+		"type":        BUDGET_LOG_OBJECT_TYPE,
+		"epsilonUsed": map[string]any{"$gt": threshold},
+	}
+	index := couchIndexLogEpsilon
+	if datasetID != "" {
+		selector["datasetId"] = datasetID
+		index = couchIndexLogDatasetEpsilon
+	}
+	logs, err := s.filterLogs(ctx, selector, index, datasetID, func(entry *BudgetConsumptionLog) bool {
+		return entry.EpsilonUsed > threshold
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	return logs, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// filterLogs runs a consumption-log selector on CouchDB, or on LevelDB scans
+// the dataset's log index (or every log when datasetID is ""), and returns
+// the entries match accepts, oldest first.
+func (s *PrivacyBudgetContract) filterLogs(
+	ctx TransactionContextInterface,
+	selector map[string]any,
+	index string,
+	datasetID string,
+	match func(entry *BudgetConsumptionLog) bool,
+) ([]*BudgetConsumptionLog, error) {
+	logs := []*BudgetConsumptionLog{}
+	keep := func(value []byte) error {
+		entry, _, err := decodeLog(value)
+		if err != nil {
+			return fmt.Errorf("unmarshal error: %v", err)
+		}
+		if match(entry) && (datasetID == "" || entry.DatasetID == datasetID) {
+			logs = append(logs, entry)
+		}
+		return nil
+	}
+
+	served, err := richQuery(ctx, selector, index, keep)
+	if err != nil {
+		return nil, err
+	}
+	if !served {
+		if datasetID == "" {
+			err = scanValues(ctx, BUDGET_LOG_OBJECT_TYPE, keep)
+		} else {
+			var all []*BudgetConsumptionLog
+			all, err = s.GetConsumptionLogsByDataset(ctx, datasetID)
+			for _, entry := range all {
+				if match(entry) {
+					logs = append(logs, entry)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Timestamp < logs[j].Timestamp })
+	return logs, nil
+}
+
+// richQuery runs a CouchDB selector query using the named shipped index and
+// hands every result to visit. It reports served=false, without error, only
+// when the state database is LevelDB, so the caller can fall back to a key
+// scan; any other failure, such as a CouchDB error, is returned.
+func richQuery(
+	ctx TransactionContextInterface,
+	selector map[string]any,
+	index string,
+	visit func(value []byte) error,
+) (bool, error) {
+	query, err := json.Marshal(map[string]any{
+		"selector":  selector,
+		"use_index": []string{"_design/" + index + "Doc", index},
+	})
+	if err != nil {
+		return false, fmt.Errorf("query marshal error: %v", err)
+	}
+
+	iter, err := ctx.GetStub().GetQueryResult(string(query))
+	if err != nil {
+		if strings.Contains(err.Error(), levelDBQueryUnsupported) {
+			log.Printf("richQuery: rich queries unavailable, falling back to key scan: %v", err)
+			return false, nil
+		}
+		return false, fmt.Errorf("rich query error: %v", err)
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return true, fmt.Errorf("iterator error: %v", err)
+		}
+		if err := visit(kv.Value); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// scanValues hands the value of every primary record of an object type to
+// visit.
+func scanValues(ctx TransactionContextInterface, objectType string, visit func(value []byte) error) error {
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return fmt.Errorf("iterator error: %v", err)
+		}
+		if err := visit(kv.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseDateRange validates an RFC 3339 range and returns both bounds in the
+// UTC form timestamps are stored in, so they compare correctly as strings.
+func parseDateRange(from, to string) (string, string, error) {
+	lower, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return "", "", codedErrorf(ERR_INVALID_ARGUMENT, "invalid from: %v", err)
+	}
+	upper, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		return "", "", codedErrorf(ERR_INVALID_ARGUMENT, "invalid to: %v", err)
+	}
+	if !lower.Before(upper) {
+		return "", "", codedErrorf(ERR_INVALID_ARGUMENT, "from %s must be before to %s", from, to)
+	}
+	return lower.UTC().Format(time.RFC3339), upper.UTC().Format(time.RFC3339), nil
+}
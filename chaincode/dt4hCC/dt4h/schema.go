@@ -0,0 +1,409 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ============================================================================
+// Schema versioning – version-aware decoding of persisted objects
+// ============================================================================
+//
+// Every decoder unmarshals a record, rejects versions newer than this
+// chaincode understands and upgrades older ones in memory, one version step
+// at a time. Readers therefore always see the current shape; MigrateRecords
+// persists the upgrade. Records written before versioning have version 0.
+
+// checkSchemaVersion rejects records written by a newer chaincode version.
+func checkSchemaVersion(objectType string, version, current int) error {
+	if version > current {
+		return fmt.Errorf("%s record has schema version %d, this chaincode supports up to %d",
+			objectType, version, current)
+	}
+	return nil
+}
+
+// storedSchemaVersion returns the schema version a record was written with,
+// before any in-memory upgrade.
+func storedSchemaVersion(raw []byte) (int, error) {
+	var stored struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return 0, err
+	}
+	return stored.SchemaVersion, nil
+}
+
+// decodeBudget unmarshals a PrivacyBudget and upgrades it to
+// BUDGET_SCHEMA_VERSION. The bool reports whether an upgrade was applied.
+func decodeBudget(raw []byte) (*PrivacyBudget, bool, error) {
+	var b PrivacyBudget
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(PRIVACY_BUDGET_OBJECT_TYPE, b.SchemaVersion, BUDGET_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := b.SchemaVersion
+	if b.SchemaVersion < 1 {
+		b.ObjectType = PRIVACY_BUDGET_OBJECT_TYPE
+		b.SchemaVersion = 1
+	}
+	if b.SchemaVersion < 2 {
+		// v2: budgets may be restricted to purposes; older ones are not.
+		b.SchemaVersion = 2
+	}
+	if b.SchemaVersion < 3 {
+		// v3: budgets name their data use agreement; older ones have none
+		// and cannot be consumed until AssignBudgetAgreement sets one.
+		b.SchemaVersion = 3
+	}
+	if b.SchemaVersion < 4 {
+		// v4: budgets carry query counters. They cannot be derived here;
+		// loadBudget recomputes them from the logs and MigrateRecords
+		// persists them.
+		b.SchemaVersion = 4
+	}
+	if b.SchemaVersion < 5 {
+		// v5: budgets number their consumption logs. loadBudget derives
+		// logSequence from the logs and MigrateRecords persists it.
+		b.SchemaVersion = 5
+	}
+	if b.SchemaVersion < 6 {
+		// v6: budgets hold the head of their log hash chain; it stays empty
+		// until the first consumption since the upgrade.
+		b.SchemaVersion = 6
+	}
+	if b.SchemaVersion < 7 {
+		// v7: budgets record the MSP of their latest change; older budgets
+		// keep it empty until they are next written.
+		b.SchemaVersion = 7
+	}
+	if b.SchemaVersion < 8 {
+		// v8: budgets may define warning thresholds and record the level
+		// reached. Older budgets use their dataset's thresholds; the level
+		// is set on their next consumption.
+		b.SchemaVersion = 8
+	}
+	if b.SchemaVersion < 9 {
+		// v9: budgets carry a subject commitment that their log entries
+		// hash; it is set the next time the budget is written or migrated.
+		b.SchemaVersion = 9
+	}
+	if b.AllowedPurposes == nil {
+		b.AllowedPurposes = []string{}
+	}
+	return &b, b.SchemaVersion != from, nil
+}
+
+// decodeLog unmarshals a BudgetConsumptionLog and upgrades it to
+// LOG_SCHEMA_VERSION.
+func decodeLog(raw []byte) (*BudgetConsumptionLog, bool, error) {
+	var l BudgetConsumptionLog
+	if err := json.Unmarshal(raw, &l); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(BUDGET_LOG_OBJECT_TYPE, l.SchemaVersion, LOG_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := l.SchemaVersion
+	if l.SchemaVersion < 1 {
+		l.ObjectType = BUDGET_LOG_OBJECT_TYPE
+		l.SchemaVersion = 1
+	}
+	if l.SchemaVersion < 2 {
+		// v2: entries record a purpose; older entries keep it empty.
+		l.SchemaVersion = 2
+	}
+	if l.SchemaVersion < 3 {
+		// v3: entries are listed in the day-bucketed time indexes;
+		// MigrateRecords writes the missing index entries.
+		l.SchemaVersion = 3
+	}
+	if l.SchemaVersion < 4 {
+		// v4: entries record the submitting MSP; older entries keep it empty.
+		l.SchemaVersion = 4
+	}
+	if l.SchemaVersion < 5 {
+		// v5: entries carry a per-budget sequence number in their key and
+		// payload. MigrateRecords numbers older entries in timestamp order
+		// and rekeys them.
+		l.SchemaVersion = 5
+	}
+	if l.SchemaVersion < 6 {
+		// v6: entries are hash-chained. Older entries stay unchained:
+		// hashing them now would not show they were never modified.
+		l.SchemaVersion = 6
+	}
+	if l.SchemaVersion < 7 {
+		// v7: entries hash their budget's subject commitment. Older entries
+		// keep it empty and their hashes stay valid.
+		l.SchemaVersion = 7
+	}
+	return &l, l.SchemaVersion != from, nil
+}
+
+// decodeQuery unmarshals a Query and upgrades it to QUERY_SCHEMA_VERSION.
+func decodeQuery(raw []byte) (*Query, bool, error) {
+	var q Query
+	if err := json.Unmarshal(raw, &q); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(QUERY_LOG_OBJECT_TYPE, q.SchemaVersion, QUERY_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := q.SchemaVersion
+	if q.SchemaVersion < 1 {
+		// v1: query logs gained the type discriminator.
+		q.ObjectType = QUERY_LOG_OBJECT_TYPE
+		q.SchemaVersion = 1
+	}
+	if q.SchemaVersion < 2 {
+		// v2: queries record a purpose; older entries keep it empty.
+		q.SchemaVersion = 2
+	}
+	if q.SchemaVersion < 3 {
+		// v3: entries are listed in the day-bucketed time indexes;
+		// MigrateRecords writes the missing index entries.
+		q.SchemaVersion = 3
+	}
+	return &q, q.SchemaVersion != from, nil
+}
+
+// decodeAccount unmarshals an IdentityAccount and upgrades it to
+// ACCOUNT_SCHEMA_VERSION.
+func decodeAccount(raw []byte) (*IdentityAccount, bool, error) {
+	var a IdentityAccount
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(IDENTITY_ACCOUNT_OBJECT_TYPE, a.SchemaVersion, ACCOUNT_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := a.SchemaVersion
+	if a.SchemaVersion < 1 {
+		a.ObjectType = IDENTITY_ACCOUNT_OBJECT_TYPE
+		a.SchemaVersion = 1
+	}
+	if a.LinkedIDs == nil {
+		a.LinkedIDs = []string{}
+	}
+	return &a, a.SchemaVersion != from, nil
+}
+
+// decodeIdentityLink unmarshals an IdentityLink and upgrades it to
+// LINK_SCHEMA_VERSION.
+func decodeIdentityLink(raw []byte) (*IdentityLink, bool, error) {
+	var l IdentityLink
+	if err := json.Unmarshal(raw, &l); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(IDENTITY_LINK_OBJECT_TYPE, l.SchemaVersion, LINK_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := l.SchemaVersion
+	if l.SchemaVersion < 1 {
+		l.ObjectType = IDENTITY_LINK_OBJECT_TYPE
+		l.SchemaVersion = 1
+	}
+	return &l, l.SchemaVersion != from, nil
+}
+
+// decodeErasureCertificate unmarshals an ErasureCertificate and upgrades it
+// to ERASURE_SCHEMA_VERSION.
+func decodeErasureCertificate(raw []byte) (*ErasureCertificate, bool, error) {
+	var c ErasureCertificate
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(ERASURE_CERTIFICATE_OBJECT_TYPE, c.SchemaVersion, ERASURE_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := c.SchemaVersion
+	if c.SchemaVersion < 1 {
+		c.ObjectType = ERASURE_CERTIFICATE_OBJECT_TYPE
+		c.SchemaVersion = 1
+	}
+	if c.DatasetIDs == nil {
+		c.DatasetIDs = []string{}
+	}
+	return &c, c.SchemaVersion != from, nil
+}
+
+// decodeDataset unmarshals a Dataset and upgrades it to
+// DATASET_SCHEMA_VERSION.
+func decodeDataset(raw []byte) (*Dataset, bool, error) {
+	var d Dataset
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(DATASET_OBJECT_TYPE, d.SchemaVersion, DATASET_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := d.SchemaVersion
+	if d.SchemaVersion < 1 {
+		d.ObjectType = DATASET_OBJECT_TYPE
+		d.SchemaVersion = 1
+	}
+	if d.SchemaVersion < 2 {
+		// v2: datasets may define default warning thresholds; older ones
+		// have none.
+		d.SchemaVersion = 2
+	}
+	return &d, d.SchemaVersion != from, nil
+}
+
+// decodeResearcher unmarshals a Researcher and upgrades it to
+// RESEARCHER_SCHEMA_VERSION.
+func decodeResearcher(raw []byte) (*Researcher, bool, error) {
+	var r Researcher
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(RESEARCHER_OBJECT_TYPE, r.SchemaVersion, RESEARCHER_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := r.SchemaVersion
+	if r.SchemaVersion < 1 {
+		r.ObjectType = RESEARCHER_OBJECT_TYPE
+		r.SchemaVersion = 1
+	}
+	if r.Projects == nil {
+		r.Projects = []string{}
+	}
+	return &r, r.SchemaVersion != from, nil
+}
+
+// decodeConsent unmarshals a Consent and upgrades it to
+// CONSENT_SCHEMA_VERSION.
+func decodeConsent(raw []byte) (*Consent, bool, error) {
+	var c Consent
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(CONSENT_OBJECT_TYPE, c.SchemaVersion, CONSENT_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := c.SchemaVersion
+	if c.SchemaVersion < 1 {
+		c.ObjectType = CONSENT_OBJECT_TYPE
+		c.SchemaVersion = 1
+	}
+	if c.AllowedPurposes == nil {
+		c.AllowedPurposes = []string{}
+	}
+	return &c, c.SchemaVersion != from, nil
+}
+
+// decodePurpose unmarshals a Purpose and upgrades it to
+// PURPOSE_SCHEMA_VERSION.
+func decodePurpose(raw []byte) (*Purpose, bool, error) {
+	var p Purpose
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(PURPOSE_OBJECT_TYPE, p.SchemaVersion, PURPOSE_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := p.SchemaVersion
+	if p.SchemaVersion < 1 {
+		p.ObjectType = PURPOSE_OBJECT_TYPE
+		p.SchemaVersion = 1
+	}
+	return &p, p.SchemaVersion != from, nil
+}
+
+// decodeDerivation unmarshals a Derivation and upgrades it to
+// DERIVATION_SCHEMA_VERSION.
+func decodeDerivation(raw []byte) (*Derivation, bool, error) {
+	var d Derivation
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(DERIVATION_OBJECT_TYPE, d.SchemaVersion, DERIVATION_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := d.SchemaVersion
+	if d.SchemaVersion < 1 {
+		d.ObjectType = DERIVATION_OBJECT_TYPE
+		d.SchemaVersion = 1
+	}
+	if d.SchemaVersion < 2 {
+		// v2 added approval by the parent's owner; earlier derivations
+		// took effect when recorded and stay in force.
+		d.Status = DERIVATION_ACTIVE
+		d.UpdatedAt = d.CreatedAt
+		d.SchemaVersion = 2
+	}
+	return &d, d.SchemaVersion != from, nil
+}
+
+// decodeDatasetBudget unmarshals a DatasetBudget and upgrades it to
+// DATASET_BUDGET_SCHEMA_VERSION.
+func decodeDatasetBudget(raw []byte) (*DatasetBudget, bool, error) {
+	var b DatasetBudget
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(DATASET_BUDGET_OBJECT_TYPE, b.SchemaVersion, DATASET_BUDGET_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := b.SchemaVersion
+	if b.SchemaVersion < 1 {
+		b.ObjectType = DATASET_BUDGET_OBJECT_TYPE
+		b.SchemaVersion = 1
+	}
+	return &b, b.SchemaVersion != from, nil
+}
+
+// decodeDatasetStats unmarshals a DatasetStats and upgrades it to
+// DATASET_STATS_SCHEMA_VERSION.
+func decodeDatasetStats(raw []byte) (*DatasetStats, bool, error) {
+	var s DatasetStats
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(DATASET_STATS_OBJECT_TYPE, s.SchemaVersion, DATASET_STATS_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := s.SchemaVersion
+	if s.SchemaVersion < 1 {
+		s.ObjectType = DATASET_STATS_OBJECT_TYPE
+		s.SchemaVersion = 1
+	}
+	if s.SchemaVersion < 2 {
+		// v2: stats are sharded per budget holder. A v1 record aggregates
+		// the whole dataset and has no UserID; GetDatasetStats skips it and
+		// RebuildDatasetStats deletes it.
+		s.SchemaVersion = 2
+	}
+	if s.ByMSP == nil {
+		s.ByMSP = []*MSPUsage{}
+	}
+	if s.EpsilonHistogram == nil {
+		s.EpsilonHistogram = newEpsilonHistogram()
+	}
+	return &s, s.SchemaVersion != from, nil
+}
+
+// decodeAgreement unmarshals a DataUseAgreement and upgrades it to
+// AGREEMENT_SCHEMA_VERSION.
+func decodeAgreement(raw []byte) (*DataUseAgreement, bool, error) {
+	var a DataUseAgreement
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, false, err
+	}
+	if err := checkSchemaVersion(AGREEMENT_OBJECT_TYPE, a.SchemaVersion, AGREEMENT_SCHEMA_VERSION); err != nil {
+		return nil, false, err
+	}
+	from := a.SchemaVersion
+	if a.SchemaVersion < 1 {
+		a.ObjectType = AGREEMENT_OBJECT_TYPE
+		a.SchemaVersion = 1
+	}
+	if a.ApprovedBy == nil {
+		a.ApprovedBy = []string{}
+	}
+	return &a, a.SchemaVersion != from, nil
+}
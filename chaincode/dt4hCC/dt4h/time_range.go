@@ -0,0 +1,251 @@
+package dt4h
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ============================================================================
+// Time-range queries – day-bucketed indexes over logs and query history
+// ============================================================================
+//
+// Composite keys cannot be range-scanned, so every consumption log and query
+// log entry is also indexed under the UTC day it was written. A range query
+// walks the day buckets between its bounds with one partial-key lookup per
+// day and filters on the exact timestamp, so it only touches the entries of
+// the requested days. Entries written before schema version 3 are added to
+// the indexes by MigrateRecords.
+
+// dayBucketLayout formats the day component of the time indexes.
+const dayBucketLayout = "2006-01-02"
+
+// GetConsumptionLogsByTimeRange returns the consumption entries logged in
+// [from, to), oldest first. Both bounds are RFC 3339 and may span at most
+// MAX_TIME_RANGE_DAYS days.
+//
+// Parameters:
+//   - from, to:  the time range, e.g. "2025-03-01T00:00:00Z"
+//   - userID:    narrows the result to one user; "" for all users
+//   - datasetID: narrows the result to one dataset; "" for all datasets
+func (s *PrivacyBudgetContract) GetConsumptionLogsByTimeRange(
+	ctx TransactionContextInterface,
+	from string,
+	to string,
+	userID string,
+	datasetID string,
+) ([]*BudgetConsumptionLog, error) {
+	method := "GetConsumptionLogsByTimeRange"
+
+	lower, upper, days, err := parseTimeRange(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	logs := []*BudgetConsumptionLog{}
+	err = scanDayIndex(ctx, INDEX_LOG_BY_DAY_DATASET, INDEX_LOG_BY_DAY_USER, days, userID, datasetID,
+		func(uid, did, ref string) error {
+			lk, err := logKey(ctx, uid, did, ref)
+			if err != nil {
+				return fmt.Errorf("key error: %v", err)
+			}
+			raw, err := ctx.GetStub().GetState(lk)
+			if err != nil {
+				return fmt.Errorf("ledger read error: %v", err)
+			}
+			if raw == nil {
+				return nil
+			}
+			entry, _, err := decodeLog(raw)
+			if err != nil {
+				return fmt.Errorf("unmarshal error: %v", err)
+			}
+			if entry.Timestamp >= lower && entry.Timestamp < upper {
+				logs = append(logs, entry)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Timestamp < logs[j].Timestamp })
+	return logs, nil
+}
+
+// GetQueryHistoryByTimeRange returns the queries logged in [from, to),
+// oldest first, each with the user who ran it. Both bounds are RFC 3339 and
+// may span at most MAX_TIME_RANGE_DAYS days.
+//
+// Parameters:
+//   - from, to:  the time range, e.g. "2025-03-01T00:00:00Z"
+//   - userID:    narrows the result to one user; "" for all users
+//   - datasetID: narrows the result to one dataset; "" for all datasets
+func (s *QueryContract) GetQueryHistoryByTimeRange(
+	ctx TransactionContextInterface,
+	from string,
+	to string,
+	userID string,
+	datasetID string,
+) ([]*UserQuery, error) {
+	method := "GetQueryHistoryByTimeRange"
+
+	lower, upper, days, err := parseTimeRange(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	queries := []*UserQuery{}
+	err = scanDayIndex(ctx, INDEX_QUERY_BY_DAY_DATASET, INDEX_QUERY_BY_DAY_USER, days, userID, datasetID,
+		func(uid, _, txID string) error {
+			key, err := queryKey(ctx, uid, txID)
+			if err != nil {
+				return fmt.Errorf("key error: %v", err)
+			}
+			raw, err := ctx.GetStub().GetState(key)
+			if err != nil {
+				return fmt.Errorf("ledger read error: %v", err)
+			}
+			if raw == nil {
+				return nil
+			}
+			q, _, err := decodeQuery(raw)
+			if err != nil {
+				return fmt.Errorf("unmarshal error: %v", err)
+			}
+			if q.Timestamp >= lower && q.Timestamp < upper {
+				queries = append(queries, &UserQuery{UserID: uid, Query: *q})
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	sort.SliceStable(queries, func(i, j int) bool { return queries[i].Query.Timestamp < queries[j].Query.Timestamp })
+	return queries, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// logDayIndexKeys creates the day-bucketed index keys for a consumption log.
+// The day is that of the entry's Timestamp, the transaction timestamp, so
+// every endorser writes the same keys even around midnight.
+func logDayIndexKeys(ctx TransactionContextInterface, entry *BudgetConsumptionLog) (byDataset string, byUser string, err error) {
+	day, err := dayBucket(entry.Timestamp)
+	if err != nil {
+		return
+	}
+	byDataset, err = ctx.GetStub().CreateCompositeKey(INDEX_LOG_BY_DAY_DATASET, []string{day, entry.DatasetID, entry.UserID, logRef(entry)})
+	if err != nil {
+		return
+	}
+	byUser, err = ctx.GetStub().CreateCompositeKey(INDEX_LOG_BY_DAY_USER, []string{day, entry.UserID, entry.DatasetID, logRef(entry)})
+	return
+}
+
+// queryDayIndexKeys creates the day-bucketed index keys for a user's query
+// log entry, on the day of its Timestamp like logDayIndexKeys.
+func queryDayIndexKeys(ctx TransactionContextInterface, userID string, q *Query) (byDataset string, byUser string, err error) {
+	day, err := dayBucket(q.Timestamp)
+	if err != nil {
+		return
+	}
+	byDataset, err = ctx.GetStub().CreateCompositeKey(INDEX_QUERY_BY_DAY_DATASET, []string{day, q.DatasetID, userID, q.TxID})
+	if err != nil {
+		return
+	}
+	byUser, err = ctx.GetStub().CreateCompositeKey(INDEX_QUERY_BY_DAY_USER, []string{day, userID, q.DatasetID, q.TxID})
+	return
+}
+
+// dayBucket returns the UTC day an RFC 3339 timestamp falls on.
+func dayBucket(timestamp string) (string, error) {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return "", fmt.Errorf("invalid timestamp %q: %v", timestamp, err)
+	}
+	return t.UTC().Format(dayBucketLayout), nil
+}
+
+// parseTimeRange validates an RFC 3339 range like parseDateRange and also
+// returns the day buckets it covers, capped at MAX_TIME_RANGE_DAYS.
+func parseTimeRange(from, to string) (string, string, []string, error) {
+	lower, upper, err := parseDateRange(from, to)
+	if err != nil {
+		return "", "", nil, err
+	}
+	start, _ := time.Parse(time.RFC3339, lower)
+	end, _ := time.Parse(time.RFC3339, upper)
+
+	// Timestamps have whole-second precision, so the last second before the
+	// exclusive upper bound is the latest one that can match.
+	last := end.Add(-time.Second).Format(dayBucketLayout)
+	var days []string
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	for day := first; ; day = day.AddDate(0, 0, 1) {
+		bucket := day.Format(dayBucketLayout)
+		days = append(days, bucket)
+		if bucket >= last {
+			break
+		}
+		if len(days) == MAX_TIME_RANGE_DAYS {
+			return "", "", nil, codedErrorf(ERR_INVALID_ARGUMENT, "range %s to %s spans more than %d days", from, to, MAX_TIME_RANGE_DAYS)
+		}
+	}
+	return lower, upper, days, nil
+}
+
+// scanDayIndex walks the entries of a pair of day-bucketed indexes for the
+// given days and hands the user, dataset and last key attribute (the tx ID
+// of a query, the logRef of a consumption log) of each to visit. The dataset-led index serves dataset-filtered and unfiltered
+// queries, the user-led one queries filtered by user alone.
+func scanDayIndex(
+	ctx TransactionContextInterface,
+	byDatasetIndex string,
+	byUserIndex string,
+	days []string,
+	userID string,
+	datasetID string,
+	visit func(userID, datasetID, ref string) error,
+) error {
+	index, filter := byDatasetIndex, []string{}
+	switch {
+	case datasetID != "" && userID != "":
+		filter = []string{datasetID, userID}
+	case datasetID != "":
+		filter = []string{datasetID}
+	case userID != "":
+		index, filter = byUserIndex, []string{userID}
+	}
+
+	for _, day := range days {
+		iter, err := ctx.GetStub().GetStateByPartialCompositeKey(index, append([]string{day}, filter...))
+		if err != nil {
+			return err
+		}
+		for iter.HasNext() {
+			kv, err := iter.Next()
+			if err != nil {
+				iter.Close()
+				return fmt.Errorf("iterator error: %v", err)
+			}
+			_, parts, err := ctx.GetStub().SplitCompositeKey(kv.Key)
+			if err != nil || len(parts) < 4 {
+				continue
+			}
+			uid, did := parts[2], parts[1]
+			if index == byUserIndex {
+				uid, did = parts[1], parts[2]
+			}
+			if err := visit(uid, did, parts[3]); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+		iter.Close()
+	}
+	return nil
+}
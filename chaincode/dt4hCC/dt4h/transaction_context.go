@@ -9,23 +9,88 @@ import (
 type TransactionContextInterface interface {
 	contractapi.TransactionContextInterface
 
-	// GetUserID returns the X.509 subject identifier of the caller.
+	// GetUserID returns the budget-holder ID of the caller. This is the
+	// account the caller's certificate resolves to, or the raw X.509 ID when
+	// no account is registered.
 	GetUserID() string
 	SetUserID(string)
 
+	// GetCertID returns the X.509 identifier of the certificate that signed
+	// the transaction, before account resolution.
+	GetCertID() string
+	SetCertID(string)
+
+	// GetEnrollmentID returns the Fabric CA enrollment ID embedded in the
+	// caller's certificate, or "" if the attribute is absent.
+	GetEnrollmentID() string
+	SetEnrollmentID(string)
+
+	// GetResolvedVia reports how GetUserID was derived (see RESOLVED_VIA_*).
+	GetResolvedVia() string
+	SetResolvedVia(string)
+
 	// GetMspID returns the MSP identifier of the caller's organization.
 	GetMspID() string
 	SetMspID(string)
+
+	// GetTimestamp returns the timestamp of the transaction proposal as
+	// RFC3339 in UTC. Every endorser sees the same value, so it is the one
+	// stored on records and hashed into the consumption log, never the
+	// endorser's own clock.
+	GetTimestamp() string
+	SetTimestamp(string)
+
+	// GetStagedState returns the value last recorded with StageState for
+	// key. Fabric's GetState does not see a transaction's own writes, so
+	// records updated several times in one transaction are read back through
+	// this. ok is false if the key was not staged; a nil value means the
+	// key was deleted.
+	GetStagedState(key string) (value []byte, ok bool)
+	StageState(key string, value []byte)
+
+	// GetEvents returns the events queued with AddEvent, in order.
+	// AfterTransaction publishes them as one EventEnvelope.
+	GetEvents() []*ChaincodeEvent
+	AddEvent(event *ChaincodeEvent)
 }
 
 // TransactionContext is the concrete implementation wired into every contract.
 type TransactionContext struct {
 	contractapi.TransactionContext
-	userID string
-	mspID  string
+	userID       string
+	certID       string
+	enrollmentID string
+	resolvedVia  string
+	mspID        string
+	timestamp    string
+	staged       map[string][]byte
+	events       []*ChaincodeEvent
+}
+
+func (tc *TransactionContext) GetUserID() string         { return tc.userID }
+func (tc *TransactionContext) SetUserID(id string)       { tc.userID = id }
+func (tc *TransactionContext) GetCertID() string         { return tc.certID }
+func (tc *TransactionContext) SetCertID(id string)       { tc.certID = id }
+func (tc *TransactionContext) GetEnrollmentID() string   { return tc.enrollmentID }
+func (tc *TransactionContext) SetEnrollmentID(id string) { tc.enrollmentID = id }
+func (tc *TransactionContext) GetResolvedVia() string    { return tc.resolvedVia }
+func (tc *TransactionContext) SetResolvedVia(v string)   { tc.resolvedVia = v }
+func (tc *TransactionContext) GetMspID() string          { return tc.mspID }
+func (tc *TransactionContext) SetMspID(id string)        { tc.mspID = id }
+func (tc *TransactionContext) GetTimestamp() string      { return tc.timestamp }
+func (tc *TransactionContext) SetTimestamp(ts string)    { tc.timestamp = ts }
+
+func (tc *TransactionContext) GetStagedState(key string) ([]byte, bool) {
+	value, ok := tc.staged[key]
+	return value, ok
+}
+
+func (tc *TransactionContext) StageState(key string, value []byte) {
+	if tc.staged == nil {
+		tc.staged = make(map[string][]byte)
+	}
+	tc.staged[key] = value
 }
 
-func (tc *TransactionContext) GetUserID() string  { return tc.userID }
-func (tc *TransactionContext) SetUserID(id string) { tc.userID = id }
-func (tc *TransactionContext) GetMspID() string    { return tc.mspID }
-func (tc *TransactionContext) SetMspID(id string)  { tc.mspID = id }
+func (tc *TransactionContext) GetEvents() []*ChaincodeEvent   { return tc.events }
+func (tc *TransactionContext) AddEvent(event *ChaincodeEvent) { tc.events = append(tc.events, event) }
@@ -2,8 +2,8 @@ package dt4h
 
 import (
 	"fmt"
-	"time"
 
+	"github.com/chaincode/dt4hCC/model"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -18,25 +18,188 @@ const (
 	PRIVACY_BUDGET_OBJECT_TYPE = "privacyBudget"
 	BUDGET_LOG_OBJECT_TYPE     = "budgetLog"
 	QUERY_LOG_OBJECT_TYPE      = "queryLog"
+
+	IDENTITY_ACCOUNT_OBJECT_TYPE = "identityAccount"
+	IDENTITY_LINK_OBJECT_TYPE    = "identityLink"
+
+	ERASURE_CERTIFICATE_OBJECT_TYPE = "erasureCertificate"
+	DATASET_OBJECT_TYPE             = "dataset"
+	RESEARCHER_OBJECT_TYPE          = "researcher"
+	CONSENT_OBJECT_TYPE             = "consent"
+	PURPOSE_OBJECT_TYPE             = "purpose"
+	AGREEMENT_OBJECT_TYPE           = "dataUseAgreement"
+	DERIVATION_OBJECT_TYPE          = "derivation"
+	DATASET_BUDGET_OBJECT_TYPE      = "datasetBudget"
+	DATASET_STATS_OBJECT_TYPE       = "datasetStats"
+)
+
+// Current schema version of each persisted object type. Bump the constant and
+// add a step to the matching upgrade function in schema.go when fields change.
+const (
+	BUDGET_SCHEMA_VERSION         = 9
+	LOG_SCHEMA_VERSION            = 7
+	QUERY_SCHEMA_VERSION          = 3
+	ACCOUNT_SCHEMA_VERSION        = 1
+	LINK_SCHEMA_VERSION           = 1
+	ERASURE_SCHEMA_VERSION        = 1
+	DATASET_SCHEMA_VERSION        = 2
+	RESEARCHER_SCHEMA_VERSION     = 1
+	CONSENT_SCHEMA_VERSION        = 1
+	PURPOSE_SCHEMA_VERSION        = 1
+	AGREEMENT_SCHEMA_VERSION      = 1
+	DERIVATION_SCHEMA_VERSION     = 2
+	DATASET_BUDGET_SCHEMA_VERSION = 1
+	DATASET_STATS_SCHEMA_VERSION  = 2
+)
+
+// MAX_MIGRATION_BATCH caps the records MigrateRecords touches in one call so
+// a single transaction stays within peer limits.
+const MAX_MIGRATION_BATCH = 500
+
+// MAX_BATCH_SIZE caps the entries accepted by the *Batch budget functions.
+const MAX_BATCH_SIZE = 500
+
+// MAX_PAGE_SIZE caps the pageSize accepted by the *Paginated functions.
+const MAX_PAGE_SIZE = 500
+
+// MAX_WARNING_THRESHOLDS caps the warning thresholds a budget or dataset
+// may define.
+const MAX_WARNING_THRESHOLDS = 10
+
+// MAX_TIME_RANGE_DAYS caps the number of day buckets a *ByTimeRange query
+// walks.
+const MAX_TIME_RANGE_DAYS = 366
+
+// Composite-key index names for range queries. The log~ indexes end in the
+// entry's logRef, which is a sequence number since v5 despite the names.
+const (
+	INDEX_BUDGET_BY_USER      = "budget~user~dataset"
+	INDEX_BUDGET_BY_DATASET   = "budget~dataset~user"
+	INDEX_BUDGET_BY_AGREEMENT = "budget~agreement~user~dataset"
+	INDEX_BUDGET_BY_CONSUMED  = "budget~dataset~consumed~user"
+	INDEX_LOG_BY_USER         = "log~user~dataset~txid"
+	INDEX_LOG_BY_DATASET      = "log~dataset~user~txid"
+	INDEX_LOG_BY_PURPOSE      = "log~purpose~dataset~user~txid"
+	INDEX_LOG_BY_DAY_DATASET  = "log~day~dataset~user~txid"
+	INDEX_LOG_BY_DAY_USER     = "log~day~user~dataset~txid"
+
+	INDEX_QUERY_BY_DAY_DATASET = "query~day~dataset~user~txid"
+	INDEX_QUERY_BY_DAY_USER    = "query~day~user~dataset~txid"
+
+	INDEX_ACCOUNT_BY_ENROLLMENT = "account~msp~enrollment"
+	INDEX_DATASET_BY_OWNER      = "dataset~owner~id"
+	INDEX_RESEARCHER_BY_PROJECT = "researcher~project~user"
+	INDEX_DERIVATION_BY_PARENT  = "derivation~parent~child"
 )
 
-// Composite-key index names for range queries.
+// ENROLLMENT_ID_ATTRIBUTE is the certificate attribute Fabric CA embeds in
+// every enrollment certificate. It survives re-enrolment, unlike the X.509 ID.
+const ENROLLMENT_ID_ATTRIBUTE = "hf.EnrollmentID"
+
+// Administrators of an MSP are recognised by the hf.Type attribute, which
+// Fabric CA sets to "admin" for identities registered with --id.type admin,
+// or, on networks with NodeOUs enabled, by the admin organizational unit.
 const (
-	INDEX_BUDGET_BY_USER    = "budget~user~dataset"
-	INDEX_BUDGET_BY_DATASET = "budget~dataset~user"
-	INDEX_LOG_BY_USER       = "log~user~dataset~txid"
-	INDEX_LOG_BY_DATASET    = "log~dataset~user~txid"
+	ADMIN_TYPE_ATTRIBUTE = "hf.Type"
+	ADMIN_TYPE           = "admin"
+	ADMIN_OU             = "admin"
 )
 
-// Budget status values.
+// ---------------------------------------------------------------------------
+// Shared values – defined in the shim-free model package
+// ---------------------------------------------------------------------------
+
 const (
-	BUDGET_ACTIVE    = "Active"
-	BUDGET_EXHAUSTED = "Exhausted"
-	BUDGET_REVOKED   = "Revoked"
+	RESOLVED_VIA_LINK        = model.RESOLVED_VIA_LINK
+	RESOLVED_VIA_ENROLLMENT  = model.RESOLVED_VIA_ENROLLMENT
+	RESOLVED_VIA_CERTIFICATE = model.RESOLVED_VIA_CERTIFICATE
+
+	BUDGET_ACTIVE    = model.BUDGET_ACTIVE
+	BUDGET_EXHAUSTED = model.BUDGET_EXHAUSTED
+	BUDGET_SUSPENDED = model.BUDGET_SUSPENDED
+	BUDGET_REVOKED   = model.BUDGET_REVOKED
+
+	REASON_INVESTIGATION        = model.REASON_INVESTIGATION
+	REASON_POLICY_VIOLATION     = model.REASON_POLICY_VIOLATION
+	REASON_DATA_OWNER_REQUEST   = model.REASON_DATA_OWNER_REQUEST
+	REASON_ADMINISTRATIVE       = model.REASON_ADMINISTRATIVE
+	REASON_INVESTIGATION_CLOSED = model.REASON_INVESTIGATION_CLOSED
+	REASON_ISSUE_RESOLVED       = model.REASON_ISSUE_RESOLVED
+	REASON_ERASURE              = model.REASON_ERASURE
+	REASON_AGREEMENT_ENDED      = model.REASON_AGREEMENT_ENDED
+
+	DATASET_ACTIVE  = model.DATASET_ACTIVE
+	DATASET_RETIRED = model.DATASET_RETIRED
+
+	USER_ACTIVE      = model.USER_ACTIVE
+	USER_SUSPENDED   = model.USER_SUSPENDED
+	USER_DEACTIVATED = model.USER_DEACTIVATED
+
+	CONSENT_ACTIVE    = model.CONSENT_ACTIVE
+	CONSENT_WITHDRAWN = model.CONSENT_WITHDRAWN
+
+	PURPOSE_ACTIVE     = model.PURPOSE_ACTIVE
+	PURPOSE_DEPRECATED = model.PURPOSE_DEPRECATED
+
+	AGREEMENT_PROPOSED   = model.AGREEMENT_PROPOSED
+	AGREEMENT_ACTIVE     = model.AGREEMENT_ACTIVE
+	AGREEMENT_EXPIRED    = model.AGREEMENT_EXPIRED
+	AGREEMENT_TERMINATED = model.AGREEMENT_TERMINATED
+
+	DERIVATION_PROPOSED = model.DERIVATION_PROPOSED
+	DERIVATION_ACTIVE   = model.DERIVATION_ACTIVE
+
+	REPORT_SCOPE_DATASET      = model.REPORT_SCOPE_DATASET
+	REPORT_SCOPE_ORGANISATION = model.REPORT_SCOPE_ORGANISATION
+
+	ACTION_BUDGET_INITIALIZED = model.ACTION_BUDGET_INITIALIZED
+	ACTION_BUDGET_UPDATED     = model.ACTION_BUDGET_UPDATED
+	ACTION_BUDGET_SUSPENDED   = model.ACTION_BUDGET_SUSPENDED
+	ACTION_BUDGET_RESUMED     = model.ACTION_BUDGET_RESUMED
+	ACTION_BUDGET_REVOKED     = model.ACTION_BUDGET_REVOKED
+	ACTION_BUDGET_ERASED      = model.ACTION_BUDGET_ERASED
+
+	EVENT_ENVELOPE_VERSION   = model.EVENT_ENVELOPE_VERSION
+	EVENT_PAYLOAD_VERSION    = model.EVENT_PAYLOAD_VERSION
+	EVENT_BUDGET_INITIALIZED = model.EVENT_BUDGET_INITIALIZED
+	EVENT_BUDGET_CONSUMED    = model.EVENT_BUDGET_CONSUMED
+	EVENT_BUDGET_EXHAUSTED   = model.EVENT_BUDGET_EXHAUSTED
+	EVENT_BUDGET_UPDATED     = model.EVENT_BUDGET_UPDATED
+	EVENT_BUDGET_SUSPENDED   = model.EVENT_BUDGET_SUSPENDED
+	EVENT_BUDGET_RESUMED     = model.EVENT_BUDGET_RESUMED
+	EVENT_BUDGET_REVOKED     = model.EVENT_BUDGET_REVOKED
+	EVENT_BUDGET_ERASED      = model.EVENT_BUDGET_ERASED
+	EVENT_THRESHOLD_CROSSED  = model.EVENT_THRESHOLD_CROSSED
+	EVENT_QUERY_LOGGED       = model.EVENT_QUERY_LOGGED
+	BUDGET_EVENT_NAME        = model.BUDGET_EVENT_NAME
+
+	ERR_NOT_FOUND           = model.ERR_NOT_FOUND
+	ERR_ALREADY_EXISTS      = model.ERR_ALREADY_EXISTS
+	ERR_INSUFFICIENT_BUDGET = model.ERR_INSUFFICIENT_BUDGET
+	ERR_NOT_ACTIVE          = model.ERR_NOT_ACTIVE
+	ERR_PURPOSE_NOT_ALLOWED = model.ERR_PURPOSE_NOT_ALLOWED
+	ERR_UNAUTHORIZED        = model.ERR_UNAUTHORIZED
+	ERR_INVALID_ARGUMENT    = model.ERR_INVALID_ARGUMENT
+)
+
+var (
+	SUSPEND_REASON_CODES     = model.SUSPEND_REASON_CODES
+	RESUME_REASON_CODES      = model.RESUME_REASON_CODES
+	SENSITIVITY_LEVELS       = model.SENSITIVITY_LEVELS
+	RESEARCHER_ROLES         = model.RESEARCHER_ROLES
+	EPSILON_HISTOGRAM_BOUNDS = model.EPSILON_HISTOGRAM_BOUNDS
 )
 
 var AUTHORIZED_MSPS = []string{"UbMSP", "AthenapeersMSP", "BscMSP"}
 
+// ERASURE_SALT_TRANSIENT_KEY is the transient-map key carrying the secret salt
+// for EraseUserRecords. Passing it as transient data keeps it off the ledger
+// while every endorser still derives the same pseudonym.
+const ERASURE_SALT_TRANSIENT_KEY = "erasureSalt"
+
+// ERASURE_MIN_SALT_BYTES is the minimum accepted length of the erasure salt.
+const ERASURE_MIN_SALT_BYTES = 16
+
 // ---------------------------------------------------------------------------
 // Contract types
 // ---------------------------------------------------------------------------
@@ -52,77 +215,107 @@ type PrivacyBudgetContract struct {
 	contractapi.Contract
 }
 
-// ---------------------------------------------------------------------------
-// Domain types – Query tracking
-// ---------------------------------------------------------------------------
+// IdentityContract links a person's successive certificates to one stable
+// budget-holder account.
+type IdentityContract struct {
+	contractapi.Contract
+}
 
-// Query represents a single logged query with its epsilon cost.
-type Query struct {
-	QueryBody   string  `json:"queryBody"`
-	DatasetID   string  `json:"datasetId"`
-	EpsilonUsed float64 `json:"epsilonUsed"`
-	Timestamp   string  `json:"timestamp"`
-	TxID        string  `json:"txId"`
+// ErasureContract implements the GDPR right to erasure for a budget holder.
+type ErasureContract struct {
+	contractapi.Contract
 }
 
-// UserHistory is the full query history for a given user.
-type UserHistory struct {
-	UserID  string  `json:"userId"`
-	Queries []Query `json:"queries"`
+// MigrationContract upgrades persisted records to the current schema version.
+type MigrationContract struct {
+	contractapi.Contract
 }
 
-// ---------------------------------------------------------------------------
-// Domain types – Privacy Budget
-// ---------------------------------------------------------------------------
+// DatasetContract is the catalogue of datasets that budgets may refer to.
+type DatasetContract struct {
+	contractapi.Contract
+}
 
-// PrivacyBudget tracks the total and consumed epsilon for a (user, dataset) pair.
-type PrivacyBudget struct {
-	ObjectType     string  `json:"type"`
-	UserID         string  `json:"userId"`
-	DatasetID      string  `json:"datasetId"`
-	TotalBudget    float64 `json:"totalBudget"`    // maximum epsilon allowed
-	ConsumedBudget float64 `json:"consumedBudget"` // epsilon spent so far
-	Status         string  `json:"status"`         // Active | Exhausted | Revoked
-	CreatedAt      string  `json:"createdAt"`
-	UpdatedAt      string  `json:"updatedAt"`
+// UserContract is the registry of researchers who may hold budgets.
+type UserContract struct {
+	contractapi.Contract
 }
 
-// RemainingBudget returns the epsilon still available.
-func (pb *PrivacyBudget) RemainingBudget() float64 {
-	return pb.TotalBudget - pb.ConsumedBudget
+// ConsentContract records the data subjects' consent scope for each dataset.
+type ConsentContract struct {
+	contractapi.Contract
 }
 
-// CanConsume checks whether the budget has enough epsilon left.
-func (pb *PrivacyBudget) CanConsume(epsilon float64) bool {
-	return pb.Status == BUDGET_ACTIVE && pb.RemainingBudget() >= epsilon
+// PurposeContract maintains the controlled vocabulary of purposes of
+// processing.
+type PurposeContract struct {
+	contractapi.Contract
 }
 
-// BudgetConsumptionLog is an immutable audit-trail entry written every time
-// epsilon is deducted from a budget.
-type BudgetConsumptionLog struct {
-	ObjectType  string  `json:"type"`
-	UserID      string  `json:"userId"`
-	DatasetID   string  `json:"datasetId"`
-	QueryBody   string  `json:"queryBody"`
-	EpsilonUsed float64 `json:"epsilonUsed"`
-	// Cumulative consumed budget *after* this deduction.
-	CumulativeEpsilon float64 `json:"cumulativeEpsilon"`
-	RemainingEpsilon  float64 `json:"remainingEpsilon"`
-	TxID              string  `json:"txId"`
-	Timestamp         string  `json:"timestamp"`
+// AgreementContract manages the data use agreements budgets are granted
+// under.
+type AgreementContract struct {
+	contractapi.Contract
 }
 
-// BudgetSummary is a convenience view returned by query functions.
-type BudgetSummary struct {
-	UserID          string  `json:"userId"`
-	DatasetID       string  `json:"datasetId"`
-	TotalBudget     float64 `json:"totalBudget"`
-	ConsumedBudget  float64 `json:"consumedBudget"`
-	RemainingBudget float64 `json:"remainingBudget"`
-	Status          string  `json:"status"`
-	QueryCount      int     `json:"queryCount"`
+// ProvenanceContract records which datasets were derived from which.
+type ProvenanceContract struct {
+	contractapi.Contract
 }
 
+// ---------------------------------------------------------------------------
+// Domain types – defined in the shim-free model package
+// ---------------------------------------------------------------------------
+
+type (
+	Query                   = model.Query
+	UserQuery               = model.UserQuery
+	UserHistory             = model.UserHistory
+	PrivacyBudget           = model.PrivacyBudget
+	BudgetHistoryEntry      = model.BudgetHistoryEntry
+	BudgetConsumptionLog    = model.BudgetConsumptionLog
+	BudgetRequest           = model.BudgetRequest
+	BudgetBatchResult       = model.BudgetBatchResult
+	BudgetPage              = model.BudgetPage
+	LogPage                 = model.LogPage
+	QueryPage               = model.QueryPage
+	DatasetPage             = model.DatasetPage
+	ResearcherPage          = model.ResearcherPage
+	BudgetSummary           = model.BudgetSummary
+	LogChainReport          = model.LogChainReport
+	Dataset                 = model.Dataset
+	Consent                 = model.Consent
+	Purpose                 = model.Purpose
+	ConsentCheck            = model.ConsentCheck
+	DataUseAgreement        = model.DataUseAgreement
+	AgreementSweepReport    = model.AgreementSweepReport
+	Derivation              = model.Derivation
+	LineageEdge             = model.LineageEdge
+	Lineage                 = model.Lineage
+	DatasetBudget           = model.DatasetBudget
+	DatasetStats            = model.DatasetStats
+	MSPUsage                = model.MSPUsage
+	EpsilonBucket           = model.EpsilonBucket
+	AuditReport             = model.AuditReport
+	AuditTotals             = model.AuditTotals
+	AuditBudgetLine         = model.AuditBudgetLine
+	PurposeUsage            = model.PurposeUsage
+	AdminAction             = model.AdminAction
+	EventEnvelope           = model.EventEnvelope
+	ChaincodeEvent          = model.ChaincodeEvent
+	BudgetEventPayload      = model.BudgetEventPayload
+	BudgetConsumedPayload   = model.BudgetConsumedPayload
+	ThresholdCrossedPayload = model.ThresholdCrossedPayload
+	QueryLoggedPayload      = model.QueryLoggedPayload
+	BudgetErasedPayload     = model.BudgetErasedPayload
+	Researcher              = model.Researcher
+	IdentityAccount         = model.IdentityAccount
+	IdentityLink            = model.IdentityLink
+	IdentityResolution      = model.IdentityResolution
+	ErasureCertificate      = model.ErasureCertificate
+	MigrationReport         = model.MigrationReport
+)
+
 // ---------------------------------------------------------------------------
 // Error helper
 // ---------------------------------------------------------------------------
@@ -136,12 +329,3 @@ type Error struct {
 func (e *Error) Error() string {
 	return fmt.Sprintf("Error code: %d: %s", e.Code, e.Err)
 }
-
-// ---------------------------------------------------------------------------
-// Time helper
-// ---------------------------------------------------------------------------
-
-// nowUTC returns the current UTC time formatted as RFC3339.
-func nowUTC() string {
-	return time.Now().UTC().Format(time.RFC3339)
-}
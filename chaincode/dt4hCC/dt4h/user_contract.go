@@ -0,0 +1,533 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+)
+
+// ============================================================================
+// User Contract – registry of researchers who may hold budgets
+// ============================================================================
+
+// researcherTransitions lists, for every researcher status, the statuses it
+// may move to. Deactivated is terminal.
+var researcherTransitions = map[string][]string{
+	USER_ACTIVE:      {USER_SUSPENDED, USER_DEACTIVATED},
+	USER_SUSPENDED:   {USER_ACTIVE, USER_DEACTIVATED},
+	USER_DEACTIVATED: {},
+}
+
+// ---------------------------------------------------------------------------
+// Ledger key helpers
+// ---------------------------------------------------------------------------
+
+// researcherKey returns the primary composite key for a Researcher.
+func researcherKey(ctx TransactionContextInterface, userID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(RESEARCHER_OBJECT_TYPE, []string{userID})
+}
+
+// researcherProjectIndexKey creates the index key used to list the members
+// of a project.
+func researcherProjectIndexKey(ctx TransactionContextInterface, projectID, userID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(INDEX_RESEARCHER_BY_PROJECT, []string{projectID, userID})
+}
+
+// ---------------------------------------------------------------------------
+// Write operations
+// ---------------------------------------------------------------------------
+
+// RegisterUser creates the profile of a researcher. userID is the
+// budget-holder ID the researcher's budgets are keyed by – the account ID
+// when an IdentityAccount exists, otherwise the X.509 ID.
+//
+// Parameters:
+//   - userID:      budget-holder ID
+//   - affiliation: institution the researcher belongs to
+//   - role:        one of RESEARCHER_ROLES
+func (s *UserContract) RegisterUser(
+	ctx TransactionContextInterface,
+	userID string,
+	affiliation string,
+	role string,
+) (*Researcher, error) {
+	method := "RegisterUser"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if userID == "" || affiliation == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: userID and affiliation are required", method)
+	}
+	if err := validateRole(role); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	key, err := researcherKey(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key error: %v", method, err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ledger read error: %v", method, err)
+	}
+	if existing != nil {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: user %s is already registered", method, userID)
+	}
+	if err := assertAccountOfCaller(ctx, userID); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	now := ctx.GetTimestamp()
+	researcher := &Researcher{
+		ObjectType:    RESEARCHER_OBJECT_TYPE,
+		SchemaVersion: RESEARCHER_SCHEMA_VERSION,
+		UserID:        userID,
+		Affiliation:   affiliation,
+		Role:          role,
+		Projects:      []string{},
+		Status:        USER_ACTIVE,
+		RegisteredBy:  ctx.GetMspID(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := putResearcher(ctx, key, researcher); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: registered user=%s role=%s", method, userID, role)
+	return researcher, nil
+}
+
+// UpdateUserProfile changes a researcher's affiliation and role. Rejected for
+// deactivated researchers.
+func (s *UserContract) UpdateUserProfile(
+	ctx TransactionContextInterface,
+	userID string,
+	affiliation string,
+	role string,
+) (*Researcher, error) {
+	method := "UpdateUserProfile"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if affiliation == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: affiliation is required", method)
+	}
+	if err := validateRole(role); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	researcher, key, err := readResearcher(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertRegisteredBy(ctx, researcher); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if researcher.Status == USER_DEACTIVATED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: user %s is %s", method, userID, USER_DEACTIVATED)
+	}
+
+	researcher.Affiliation = affiliation
+	researcher.Role = role
+	researcher.UpdatedAt = ctx.GetTimestamp()
+	if err := putResearcher(ctx, key, researcher); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: updated user=%s", method, userID)
+	return researcher, nil
+}
+
+// AddProjectMembership adds a researcher to a project.
+func (s *UserContract) AddProjectMembership(
+	ctx TransactionContextInterface,
+	userID string,
+	projectID string,
+) (*Researcher, error) {
+	method := "AddProjectMembership"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if projectID == "" {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "%s: projectID is required", method)
+	}
+
+	researcher, key, err := readResearcher(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertRegisteredBy(ctx, researcher); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if researcher.Status == USER_DEACTIVATED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: user %s is %s", method, userID, USER_DEACTIVATED)
+	}
+	if slices.Contains(researcher.Projects, projectID) {
+		return nil, codedErrorf(ERR_ALREADY_EXISTS, "%s: user %s is already a member of project %s", method, userID, projectID)
+	}
+
+	researcher.Projects = append(researcher.Projects, projectID)
+	researcher.UpdatedAt = ctx.GetTimestamp()
+	if err := putResearcher(ctx, key, researcher); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	idx, err := researcherProjectIndexKey(ctx, projectID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: index key error: %v", method, err)
+	}
+	if err := ctx.GetStub().PutState(idx, []byte{0x00}); err != nil {
+		return nil, fmt.Errorf("%s: index put error: %v", method, err)
+	}
+
+	log.Printf("%s: user=%s project=%s", method, userID, projectID)
+	return researcher, nil
+}
+
+// RemoveProjectMembership removes a researcher from a project.
+func (s *UserContract) RemoveProjectMembership(
+	ctx TransactionContextInterface,
+	userID string,
+	projectID string,
+) (*Researcher, error) {
+	method := "RemoveProjectMembership"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	researcher, key, err := readResearcher(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertRegisteredBy(ctx, researcher); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	i := slices.Index(researcher.Projects, projectID)
+	if i < 0 {
+		return nil, codedErrorf(ERR_NOT_FOUND, "%s: user %s is not a member of project %s", method, userID, projectID)
+	}
+
+	researcher.Projects = slices.Delete(researcher.Projects, i, i+1)
+	researcher.UpdatedAt = ctx.GetTimestamp()
+	if err := putResearcher(ctx, key, researcher); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	idx, err := researcherProjectIndexKey(ctx, projectID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: index key error: %v", method, err)
+	}
+	if err := ctx.GetStub().DelState(idx); err != nil {
+		return nil, fmt.Errorf("%s: index delete error: %v", method, err)
+	}
+
+	log.Printf("%s: user=%s project=%s", method, userID, projectID)
+	return researcher, nil
+}
+
+// SuspendUser blocks a researcher from consuming any budget, on every
+// dataset, until ReactivateUser is called. The budgets themselves are left
+// untouched. reasonCode must be one of SUSPEND_REASON_CODES.
+func (s *UserContract) SuspendUser(
+	ctx TransactionContextInterface,
+	userID string,
+	reasonCode string,
+	note string,
+) (*Researcher, error) {
+	method := "SuspendUser"
+
+	if err := validateReasonCode(reasonCode, SUSPEND_REASON_CODES); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	return s.changeStatus(ctx, method, userID, USER_SUSPENDED, reasonCode, note)
+}
+
+// ReactivateUser lifts a suspension. reasonCode must be one of
+// RESUME_REASON_CODES.
+func (s *UserContract) ReactivateUser(
+	ctx TransactionContextInterface,
+	userID string,
+	reasonCode string,
+	note string,
+) (*Researcher, error) {
+	method := "ReactivateUser"
+
+	if err := validateReasonCode(reasonCode, RESUME_REASON_CODES); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	return s.changeStatus(ctx, method, userID, USER_ACTIVE, reasonCode, note)
+}
+
+// DeactivateUser permanently closes a researcher's registration, e.g. when
+// they leave the consortium. reasonCode must be one of SUSPEND_REASON_CODES.
+func (s *UserContract) DeactivateUser(
+	ctx TransactionContextInterface,
+	userID string,
+	reasonCode string,
+	note string,
+) (*Researcher, error) {
+	method := "DeactivateUser"
+
+	if err := validateReasonCode(reasonCode, SUSPEND_REASON_CODES); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	return s.changeStatus(ctx, method, userID, USER_DEACTIVATED, reasonCode, note)
+}
+
+// ---------------------------------------------------------------------------
+// Read / query operations
+// ---------------------------------------------------------------------------
+
+// GetUser returns a researcher's profile.
+func (s *UserContract) GetUser(
+	ctx TransactionContextInterface,
+	userID string,
+) (*Researcher, error) {
+	researcher, _, err := readResearcher(ctx, userID)
+	return researcher, err
+}
+
+// GetMyProfile returns the calling user's own profile.
+func (s *UserContract) GetMyProfile(
+	ctx TransactionContextInterface,
+) (*Researcher, error) {
+	return s.GetUser(ctx, ctx.GetUserID())
+}
+
+// GetUsersByProject returns every member of a project.
+func (s *UserContract) GetUsersByProject(
+	ctx TransactionContextInterface,
+	projectID string,
+) ([]*Researcher, error) {
+	method := "GetUsersByProject"
+
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(INDEX_RESEARCHER_BY_PROJECT, []string{projectID})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	researchers := []*Researcher{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		_, parts, err := ctx.GetStub().SplitCompositeKey(kv.Key)
+		if err != nil || len(parts) < 2 {
+			continue
+		}
+		researcher, _, err := readResearcher(ctx, parts[1])
+		if err != nil {
+			continue
+		}
+		researchers = append(researchers, researcher)
+	}
+	return researchers, nil
+}
+
+// SearchUsers filters the registry. Every filter is optional; pass "" to
+// ignore it.
+func (s *UserContract) SearchUsers(
+	ctx TransactionContextInterface,
+	affiliation string,
+	role string,
+	status string,
+	projectID string,
+) ([]*Researcher, error) {
+	method := "SearchUsers"
+
+	iter, err := ctx.GetStub().GetStateByPartialCompositeKey(RESEARCHER_OBJECT_TYPE, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	defer iter.Close()
+
+	researchers := []*Researcher{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: iterator error: %v", method, err)
+		}
+		researcher, _, err := decodeResearcher(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unmarshal error: %v", method, err)
+		}
+		if (affiliation != "" && researcher.Affiliation != affiliation) ||
+			(role != "" && researcher.Role != role) ||
+			(status != "" && researcher.Status != status) ||
+			(projectID != "" && !slices.Contains(researcher.Projects, projectID)) {
+			continue
+		}
+		researchers = append(researchers, researcher)
+	}
+	return researchers, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// changeStatus applies a researcher status transition.
+func (s *UserContract) changeStatus(
+	ctx TransactionContextInterface,
+	method string,
+	userID string,
+	to string,
+	reasonCode string,
+	note string,
+) (*Researcher, error) {
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	researcher, key, err := readResearcher(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if err := assertRegisteredBy(ctx, researcher); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if !slices.Contains(researcherTransitions[researcher.Status], to) {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: illegal user status transition %s -> %s", method, researcher.Status, to)
+	}
+
+	researcher.Status = to
+	researcher.StatusReason = reasonCode
+	researcher.StatusNote = note
+	researcher.UpdatedAt = ctx.GetTimestamp()
+	if err := putResearcher(ctx, key, researcher); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: user=%s status=%s reason=%s", method, userID, to, reasonCode)
+	return researcher, nil
+}
+
+// assertRegisteredBy rejects callers whose MSP is not the one that
+// registered the researcher. Only that MSP manages the researcher's profile,
+// memberships and status.
+func assertRegisteredBy(ctx TransactionContextInterface, researcher *Researcher) error {
+	if researcher.RegisteredBy != ctx.GetMspID() {
+		return codedErrorf(ERR_UNAUTHORIZED, "unauthorized: user %s is registered by %s", researcher.UserID, researcher.RegisteredBy)
+	}
+	return nil
+}
+
+// assertAccountOfCaller rejects a user ID whose identity account belongs to
+// another MSP, so no MSP can register, and then manage, another's user.
+func assertAccountOfCaller(ctx TransactionContextInterface, userID string) error {
+	key, err := accountKey(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("assertAccountOfCaller: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("assertAccountOfCaller: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil
+	}
+	account, _, err := decodeAccount(raw)
+	if err != nil {
+		return fmt.Errorf("assertAccountOfCaller: unmarshal error: %v", err)
+	}
+	if account.MspID != ctx.GetMspID() {
+		return codedErrorf(ERR_UNAUTHORIZED, "unauthorized: account %s belongs to %s", userID, account.MspID)
+	}
+	return nil
+}
+
+// assertUserActive rejects budget holders that are not registered or whose
+// registration is suspended or deactivated.
+func assertUserActive(ctx TransactionContextInterface, userID string) error {
+	researcher, _, err := readResearcher(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if researcher.Status != USER_ACTIVE {
+		return codedErrorf(ERR_NOT_ACTIVE, "user %s is %s", userID, researcher.Status)
+	}
+	return nil
+}
+
+// validateRole checks a role against RESEARCHER_ROLES.
+func validateRole(role string) error {
+	if !slices.Contains(RESEARCHER_ROLES, role) {
+		return codedErrorf(ERR_INVALID_ARGUMENT, "invalid role %q, expected one of %v", role, RESEARCHER_ROLES)
+	}
+	return nil
+}
+
+// readResearcher fetches and unmarshals a Researcher from the ledger.
+func readResearcher(ctx TransactionContextInterface, userID string) (*Researcher, string, error) {
+	key, err := researcherKey(ctx, userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("readResearcher: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("readResearcher: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, "", codedErrorf(ERR_NOT_FOUND, "readResearcher: user %s is not registered", userID)
+	}
+
+	researcher, _, err := decodeResearcher(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("readResearcher: unmarshal error: %v", err)
+	}
+	return researcher, key, nil
+}
+
+// putResearcher marshals and stores a Researcher.
+func putResearcher(ctx TransactionContextInterface, key string, researcher *Researcher) error {
+	data, err := json.Marshal(researcher)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, data); err != nil {
+		return fmt.Errorf("put error: %v", err)
+	}
+	return nil
+}
+
+// deleteResearcher removes a researcher's profile and project index entries.
+// It returns the number of records deleted (0 when no profile exists).
+func deleteResearcher(ctx TransactionContextInterface, userID string) (int, error) {
+	key, err := researcherKey(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("deleteResearcher: key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("deleteResearcher: ledger read error: %v", err)
+	}
+	if raw == nil {
+		return 0, nil
+	}
+	researcher, _, err := decodeResearcher(raw)
+	if err != nil {
+		return 0, fmt.Errorf("deleteResearcher: unmarshal error: %v", err)
+	}
+
+	keys := []string{key}
+	for _, projectID := range researcher.Projects {
+		idx, err := researcherProjectIndexKey(ctx, projectID, userID)
+		if err != nil {
+			return 0, fmt.Errorf("deleteResearcher: index key error: %v", err)
+		}
+		keys = append(keys, idx)
+	}
+
+	for _, k := range keys {
+		if err := ctx.GetStub().DelState(k); err != nil {
+			return 0, fmt.Errorf("deleteResearcher: delete error: %v", err)
+		}
+	}
+	return len(keys), nil
+}
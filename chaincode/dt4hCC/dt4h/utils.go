@@ -4,15 +4,17 @@ import (
 	"fmt"
 	"log"
 	"slices"
+	"time"
 )
 
 // BeforeTransaction is the hook executed before every chaincode function.
-// It extracts the caller's identity from the client certificate and stores
-// it in the transaction context so that contract methods can access it.
+// It extracts the caller's identity from the client certificate, resolves it
+// to the stable budget-holder account (see IdentityContract) and stores both
+// in the transaction context so that contract methods can access them.
 func BeforeTransaction(ctx TransactionContextInterface) error {
 	method := "BeforeTransaction"
 
-	userID, err := ctx.GetClientIdentity().GetID()
+	certID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return fmt.Errorf("%s: failed to get user ID: %v", method, err)
 	}
@@ -22,10 +24,29 @@ func BeforeTransaction(ctx TransactionContextInterface) error {
 		return fmt.Errorf("%s: failed to get MSP ID: %v", method, err)
 	}
 
+	enrollmentID, _, err := ctx.GetClientIdentity().GetAttributeValue(ENROLLMENT_ID_ATTRIBUTE)
+	if err != nil {
+		return fmt.Errorf("%s: failed to read enrollment ID: %v", method, err)
+	}
+
+	userID, via, err := resolveAccountID(ctx, certID, mspID, enrollmentID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+
+	at, err := txTime(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+
 	ctx.SetUserID(userID)
+	ctx.SetCertID(certID)
+	ctx.SetEnrollmentID(enrollmentID)
+	ctx.SetResolvedVia(via)
 	ctx.SetMspID(mspID)
+	ctx.SetTimestamp(at.UTC().Format(time.RFC3339))
 
-	log.Printf("%s: caller=%s  msp=%s", method, userID, mspID)
+	log.Printf("%s: caller=%s  msp=%s  via=%s", method, userID, mspID, via)
 	return nil
 }
 
@@ -35,5 +56,39 @@ func assertAuthorizedMSP(ctx TransactionContextInterface) error {
 	if slices.Contains(AUTHORIZED_MSPS, msp) {
 		return nil
 	}
-	return fmt.Errorf("unauthorized MSP: %s", msp)
+	return codedErrorf(ERR_UNAUTHORIZED, "unauthorized MSP: %s", msp)
+}
+
+// assertAdmin rejects callers that are not administrators of their MSP (see
+// ADMIN_TYPE_ATTRIBUTE).
+func assertAdmin(ctx TransactionContextInterface) error {
+	if err := ctx.GetClientIdentity().AssertAttributeValue(ADMIN_TYPE_ATTRIBUTE, ADMIN_TYPE); err == nil {
+		return nil
+	}
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return fmt.Errorf("failed to read caller certificate: %v", err)
+	}
+	if cert != nil && slices.Contains(cert.Subject.OrganizationalUnit, ADMIN_OU) {
+		return nil
+	}
+	return codedErrorf(ERR_UNAUTHORIZED, "unauthorized: caller is not an administrator of %s", ctx.GetMspID())
+}
+
+// codedErrorf formats an error that starts with a stable error code, such as
+// ERR_NOT_FOUND, in square brackets. Use it where a failure that clients may
+// want to handle originates; callers wrap the error with their name as usual.
+func codedErrorf(code, format string, args ...any) error {
+	return fmt.Errorf("[%s] %s", code, fmt.Sprintf(format, args...))
+}
+
+// txTime returns the timestamp of the transaction proposal. Every endorser
+// sees the same value, unlike its own clock, so expiry and validity checks
+// against it give the same result on all peers.
+func txTime(ctx TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("txTime: %v", err)
+	}
+	return ts.AsTime(), nil
 }
@@ -0,0 +1,183 @@
+package dt4h
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// ============================================================================
+// Budget warnings – consumption thresholds that warn before exhaustion
+// ============================================================================
+//
+// A budget warns when its consumption reaches a threshold, a percentage of
+// its total. The thresholds are the budget's own or, if it has none, its
+// dataset's. ConsumeBudget emits a BudgetThresholdCrossed event for every
+// threshold a charge crosses and records the highest threshold reached on
+// the budget as its warning level.
+
+// SetBudgetWarningThresholds sets the warning thresholds of a budget.
+// thresholdsJSON is a JSON array of percentages in (0, 100), ascending, e.g.
+// "[50,80,95]"; "[]" reverts to the dataset's thresholds. The warning level
+// is recomputed without emitting events. Rejected for Revoked budgets.
+func (s *PrivacyBudgetContract) SetBudgetWarningThresholds(
+	ctx TransactionContextInterface,
+	userID string,
+	datasetID string,
+	thresholdsJSON string,
+) (*PrivacyBudget, error) {
+	method := "SetBudgetWarningThresholds"
+
+	if err := assertAuthorizedMSP(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	thresholds, err := parseWarningThresholds(thresholdsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	budget, key, err := s.readBudget(ctx, userID, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if budget.Status == BUDGET_REVOKED {
+		return nil, codedErrorf(ERR_NOT_ACTIVE, "%s: budget is %s", method, BUDGET_REVOKED)
+	}
+	budget.WarningThresholds = thresholds
+	budget.UpdatedAt = ctx.GetTimestamp()
+	if err := refreshWarningLevel(ctx, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	if err := s.putBudget(ctx, key, budget); err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+
+	log.Printf("%s: user=%s dataset=%s thresholds=%v level=%g",
+		method, userID, datasetID, thresholds, budget.WarningLevel)
+	return budget, nil
+}
+
+// ---------------------------------------------------------------------------
+// Internal helpers
+// ---------------------------------------------------------------------------
+
+// parseWarningThresholds decodes and validates a JSON array of warning
+// thresholds. An empty array yields nil.
+func parseWarningThresholds(thresholdsJSON string) ([]float64, error) {
+	var thresholds []float64
+	if err := json.Unmarshal([]byte(thresholdsJSON), &thresholds); err != nil {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "invalid thresholds JSON: %v", err)
+	}
+	if len(thresholds) > MAX_WARNING_THRESHOLDS {
+		return nil, codedErrorf(ERR_INVALID_ARGUMENT, "at most %d warning thresholds allowed, got %d", MAX_WARNING_THRESHOLDS, len(thresholds))
+	}
+	for i, t := range thresholds {
+		if t <= 0 || t >= 100 {
+			return nil, codedErrorf(ERR_INVALID_ARGUMENT, "warning threshold %g must be between 0 and 100 percent", t)
+		}
+		if i > 0 && t <= thresholds[i-1] {
+			return nil, codedErrorf(ERR_INVALID_ARGUMENT, "warning thresholds must be strictly ascending, got %v", thresholds)
+		}
+	}
+	if len(thresholds) == 0 {
+		return nil, nil
+	}
+	return thresholds, nil
+}
+
+// warningThresholds returns the thresholds that apply to a budget: its own,
+// or else its dataset's. Budgets created before the dataset catalogue may
+// name an unregistered dataset, which has no thresholds.
+func warningThresholds(ctx TransactionContextInterface, budget *PrivacyBudget) ([]float64, error) {
+	if len(budget.WarningThresholds) > 0 {
+		return budget.WarningThresholds, nil
+	}
+	key, err := datasetKey(ctx, budget.DatasetID)
+	if err != nil {
+		return nil, fmt.Errorf("key error: %v", err)
+	}
+	raw, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("ledger read error: %v", err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	dataset, _, err := decodeDataset(raw)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal error: %v", err)
+	}
+	return dataset.WarningThresholds, nil
+}
+
+// consumedPercent returns the share of a total that consumed represents.
+func consumedPercent(consumed, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return consumed / total * 100
+}
+
+// warningLevelAt returns the highest threshold at or below percent, or 0.
+func warningLevelAt(thresholds []float64, percent float64) float64 {
+	level := 0.0
+	for _, t := range thresholds {
+		if t <= percent {
+			level = t
+		}
+	}
+	return level
+}
+
+// setWarningLevel records a budget's warning level, stamping the time it
+// changed with the budget's UpdatedAt.
+func setWarningLevel(budget *PrivacyBudget, level float64) {
+	if level == budget.WarningLevel {
+		return
+	}
+	budget.WarningLevel = level
+	budget.WarningReachedAt = EMPTY_STR
+	if level > 0 {
+		budget.WarningReachedAt = budget.UpdatedAt
+	}
+}
+
+// refreshWarningLevel recomputes a budget's warning level after its total
+// or thresholds changed. No events are emitted: nothing was consumed.
+func refreshWarningLevel(ctx TransactionContextInterface, budget *PrivacyBudget) error {
+	thresholds, err := warningThresholds(ctx, budget)
+	if err != nil {
+		return fmt.Errorf("refreshWarningLevel: %v", err)
+	}
+	setWarningLevel(budget, warningLevelAt(thresholds, consumedPercent(budget.ConsumedBudget, budget.TotalBudget)))
+	return nil
+}
+
+// raiseWarnings emits a BudgetThresholdCrossed event for every threshold a
+// charge took the budget past and updates its warning level. consumedBefore
+// is the budget's consumption before the charge.
+func raiseWarnings(ctx TransactionContextInterface, budget *PrivacyBudget, consumedBefore float64) error {
+	thresholds, err := warningThresholds(ctx, budget)
+	if err != nil {
+		return fmt.Errorf("raiseWarnings: %v", err)
+	}
+	before := consumedPercent(consumedBefore, budget.TotalBudget)
+	after := consumedPercent(budget.ConsumedBudget, budget.TotalBudget)
+	for _, t := range thresholds {
+		if before < t && t <= after {
+			if err := emitEvent(ctx, EVENT_THRESHOLD_CROSSED, &ThresholdCrossedPayload{
+				UserID:          budget.UserID,
+				DatasetID:       budget.DatasetID,
+				Threshold:       t,
+				ConsumedPercent: after,
+				ConsumedBudget:  budget.ConsumedBudget,
+				RemainingBudget: budget.RemainingBudget(),
+			}); err != nil {
+				return fmt.Errorf("raiseWarnings: %v", err)
+			}
+		}
+	}
+	setWarningLevel(budget, warningLevelAt(thresholds, after))
+	return nil
+}
@@ -0,0 +1,90 @@
+package logchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/chaincode/dt4hCC/model"
+)
+
+// auditScope is the part of an audit report that says what it covers.
+type auditScope struct {
+	Scope      string   `json:"scope"`
+	ScopeID    string   `json:"scopeId"`
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	DatasetIDs []string `json:"datasetIds"`
+}
+
+// auditEntry is the leaf form of a consumption log entry: its Hash, which
+// leaves the user ID out, and the user ID it is reported under.
+type auditEntry struct {
+	UserID string `json:"userId"`
+	Hash   string `json:"hash"`
+}
+
+// auditLeaf tags a record with its kind, so that records of different kinds
+// never hash alike.
+type auditLeaf struct {
+	Kind   string `json:"kind"` // scope | budget | action | entry
+	Record any    `json:"record"`
+}
+
+// AuditRoot returns the hex Merkle root of an audit report. The leaves are,
+// in this order: the report's scope, period and datasets; every budget line;
+// every administrative action; and every consumption log entry as its Hash
+// and user ID, each list in report order. A leaf is SHA-256(0x00 || l),
+// where l is the JSON encoding of {"kind":…,"record":…}; each inner node is
+// SHA-256(0x01 || left || right), and a node without a sibling is carried up
+// unchanged.
+//
+// The totals and per-purpose and per-MSP figures are derived from the
+// budgets and entries and are not leaves; GeneratedAt and TxID describe the
+// transaction that produced the report and are not covered either.
+func AuditRoot(report *model.AuditReport) (string, error) {
+	leaves := []auditLeaf{{Kind: "scope", Record: auditScope{
+		Scope:      report.Scope,
+		ScopeID:    report.ScopeID,
+		From:       report.From,
+		To:         report.To,
+		DatasetIDs: report.DatasetIDs,
+	}}}
+	for _, line := range report.Budgets {
+		leaves = append(leaves, auditLeaf{Kind: "budget", Record: line})
+	}
+	for _, action := range report.AdminActions {
+		leaves = append(leaves, auditLeaf{Kind: "action", Record: action})
+	}
+	for _, entry := range report.Entries {
+		hash, err := Hash(entry)
+		if err != nil {
+			return "", err
+		}
+		leaves = append(leaves, auditLeaf{Kind: "entry", Record: auditEntry{UserID: entry.UserID, Hash: hash}})
+	}
+
+	level := make([][]byte, 0, len(leaves))
+	for _, leaf := range leaves {
+		data, err := json.Marshal(leaf)
+		if err != nil {
+			return "", fmt.Errorf("AuditRoot: marshal error: %v", err)
+		}
+		sum := sha256.Sum256(append([]byte{0x00}, data...))
+		level = append(level, sum[:])
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			node := sha256.Sum256(append(append([]byte{0x01}, level[i]...), level[i+1]...))
+			next = append(next, node[:])
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0]), nil
+}
@@ -0,0 +1,157 @@
+// Package logchain hashes and verifies the consumption log hash chain of a
+// privacy budget, and the audit reports built from it. It imports only the
+// standard library and model, so off-chain tools can check an exported log
+// or report without the chaincode shim.
+//
+// Every consumption log entry written since log schema v6 records the hash
+// of the previous entry of its budget, and the budget records the hash of the
+// latest one. An entry that was altered no longer matches its hash, and one
+// that was dropped breaks the link of its successor or, at the end of the
+// log, the head hash.
+//
+// The user ID is not hashed, so that erasure can pseudonymise entries without
+// breaking the chain. Instead, entries written since log schema v7 hash the
+// budget's subject commitment, a digest fixed when the budget is created that
+// erasure leaves unchanged. An entry copied from another budget's log, whose
+// chain is otherwise just as valid, is rejected because its commitment does
+// not match. The query text enters the hash through its digest for the same
+// reason as the user ID.
+//
+// AuditRoot builds the Merkle root of an audit report on the same hashes.
+package logchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/chaincode/dt4hCC/model"
+)
+
+// hashInput is the canonical form of a consumption log entry that Hash
+// hashes. Fields are encoded as JSON in this order.
+type hashInput struct {
+	SubjectCommitment string  `json:"subjectCommitment,omitempty"` // omitted on v6 entries, whose hashes stay valid
+	DatasetID         string  `json:"datasetId"`
+	Sequence          int     `json:"sequence"`
+	Purpose           string  `json:"purpose"`
+	QueryDigest       string  `json:"queryDigest"`
+	EpsilonUsed       float64 `json:"epsilonUsed"`
+	CumulativeEpsilon float64 `json:"cumulativeEpsilon"`
+	RemainingEpsilon  float64 `json:"remainingEpsilon"`
+	TxID              string  `json:"txId"`
+	Timestamp         string  `json:"timestamp"`
+	MspID             string  `json:"mspId"`
+	PrevHash          string  `json:"prevHash"`
+}
+
+// Hash returns the hex SHA-256 of the canonical form of a consumption log
+// entry: the JSON encoding of its subjectCommitment (when set), datasetId,
+// sequence, purpose, queryDigest, epsilonUsed, cumulativeEpsilon,
+// remainingEpsilon, txId, timestamp, mspId and prevHash, in that order. The
+// entry's own Hash, user ID, query text and erasure flag are not part of it.
+func Hash(entry *model.BudgetConsumptionLog) (string, error) {
+	data, err := json.Marshal(hashInput{
+		SubjectCommitment: entry.SubjectCommitment,
+		DatasetID:         entry.DatasetID,
+		Sequence:          entry.Sequence,
+		Purpose:           entry.Purpose,
+		QueryDigest:       entry.QueryDigest,
+		EpsilonUsed:       entry.EpsilonUsed,
+		CumulativeEpsilon: entry.CumulativeEpsilon,
+		RemainingEpsilon:  entry.RemainingEpsilon,
+		TxID:              entry.TxID,
+		Timestamp:         entry.Timestamp,
+		MspID:             entry.MspID,
+		PrevHash:          entry.PrevHash,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Hash: marshal error: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks the complete consumption log of one budget, in any order,
+// against the budget's logHeadHash and subjectCommitment. It returns the
+// number of chained entries verified, and an error describing the first
+// entry that was altered, missing, out of place or taken from another
+// budget. Entries logged before v6 carry no hash; they are accepted as long
+// as none follows a chained entry. Entries logged before v7 carry no
+// commitment; they are accepted as long as none follows a committed entry.
+func Verify(entries []*model.BudgetConsumptionLog, headHash, subjectCommitment string) (int, error) {
+	ordered := append([]*model.BudgetConsumptionLog(nil), entries...)
+	SortBySequence(ordered)
+
+	prevHash, prevSeq, chained, committed := "", 0, 0, false
+	for _, entry := range ordered {
+		if entry.Hash == "" {
+			if chained > 0 {
+				return chained, fmt.Errorf("entry %d has no hash but follows chained entries", entry.Sequence)
+			}
+			continue
+		}
+		if chained > 0 && entry.Sequence != prevSeq+1 {
+			return chained, fmt.Errorf("entries %d to %d are missing", prevSeq+1, entry.Sequence-1)
+		}
+		if entry.PrevHash != prevHash {
+			return chained, fmt.Errorf("entry %d does not link to the entry before it", entry.Sequence)
+		}
+		switch {
+		case entry.SubjectCommitment != "":
+			if entry.SubjectCommitment != subjectCommitment {
+				return chained, fmt.Errorf("entry %d belongs to another budget", entry.Sequence)
+			}
+			committed = true
+		case committed:
+			return chained, fmt.Errorf("entry %d has no subject commitment but follows committed entries", entry.Sequence)
+		}
+		if !entry.Erased && QueryDigest(entry.QueryBody) != entry.QueryDigest {
+			return chained, fmt.Errorf("query text of entry %d does not match its digest", entry.Sequence)
+		}
+		hash, err := Hash(entry)
+		if err != nil {
+			return chained, err
+		}
+		if hash != entry.Hash {
+			return chained, fmt.Errorf("entry %d does not match its hash", entry.Sequence)
+		}
+		prevHash, prevSeq = entry.Hash, entry.Sequence
+		chained++
+	}
+	if prevHash != headHash {
+		return chained, fmt.Errorf("log ends at hash %q but the budget's head is %q", prevHash, headHash)
+	}
+	return chained, nil
+}
+
+// QueryDigest returns the hex SHA-256 of a query text.
+func QueryDigest(queryBody string) string {
+	sum := sha256.Sum256([]byte(queryBody))
+	return hex.EncodeToString(sum[:])
+}
+
+// SubjectCommitment returns the subject commitment of a budget created for
+// (userID, datasetID) in transaction txID: the hex SHA-256 of the three,
+// each length-prefixed. The transaction ID salts the digest, so the
+// commitment alone does not confirm a guessed user ID.
+func SubjectCommitment(txID, userID, datasetID string) string {
+	h := sha256.New()
+	for _, part := range []string{txID, userID, datasetID} {
+		fmt.Fprintf(h, "%d:%s", len(part), part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SortBySequence orders a budget's consumption logs as they were logged.
+// Entries without a sequence number predate v5 and sort first, by timestamp.
+func SortBySequence(logs []*model.BudgetConsumptionLog) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].Sequence != logs[j].Sequence {
+			return logs[i].Sequence < logs[j].Sequence
+		}
+		return logs[i].Timestamp < logs[j].Timestamp
+	})
+}
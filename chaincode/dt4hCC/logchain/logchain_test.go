@@ -0,0 +1,190 @@
+package logchain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chaincode/dt4hCC/model"
+)
+
+// chain builds a hash-chained log of n entries for one budget and returns it
+// with its head hash.
+func chain(t *testing.T, subject string, n int) ([]*model.BudgetConsumptionLog, string) {
+	t.Helper()
+	var entries []*model.BudgetConsumptionLog
+	prevHash, consumed := "", 0.0
+	for seq := 1; seq <= n; seq++ {
+		query := fmt.Sprintf("SELECT COUNT(*) FROM cohort WHERE age > %d", 20+seq)
+		consumed += 0.5
+		entry := &model.BudgetConsumptionLog{
+			UserID:            "alice",
+			DatasetID:         "ds1",
+			QueryBody:         query,
+			Purpose:           "research",
+			EpsilonUsed:       0.5,
+			CumulativeEpsilon: consumed,
+			RemainingEpsilon:  10 - consumed,
+			TxID:              fmt.Sprintf("tx%d", seq),
+			Timestamp:         fmt.Sprintf("2025-03-01T10:00:%02dZ", seq),
+			Sequence:          seq,
+			MspID:             "Org1MSP",
+			QueryDigest:       QueryDigest(query),
+			PrevHash:          prevHash,
+			SubjectCommitment: subject,
+		}
+		hash, err := Hash(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Hash, prevHash = hash, hash
+		entries = append(entries, entry)
+	}
+	return entries, prevHash
+}
+
+func TestVerifyIntactChain(t *testing.T) {
+	subject := SubjectCommitment("tx0", "alice", "ds1")
+	entries, head := chain(t, subject, 4)
+
+	// Order of the input does not matter.
+	entries[0], entries[3] = entries[3], entries[0]
+	chained, err := Verify(entries, head, subject)
+	if err != nil {
+		t.Fatalf("intact chain rejected: %v", err)
+	}
+	if chained != 4 {
+		t.Fatalf("chained = %d, want 4", chained)
+	}
+}
+
+func TestVerifyErasedChain(t *testing.T) {
+	subject := SubjectCommitment("tx0", "alice", "ds1")
+	entries, head := chain(t, subject, 3)
+	for _, entry := range entries {
+		entry.UserID = "erased:0123abcd"
+		entry.QueryBody = ""
+		entry.Erased = true
+	}
+	if _, err := Verify(entries, head, subject); err != nil {
+		t.Fatalf("pseudonymised chain rejected: %v", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	subject := SubjectCommitment("tx0", "alice", "ds1")
+	tests := []struct {
+		name   string
+		tamper func(entries []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string)
+		want   string
+	}{
+		{
+			name: "edited epsilon",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				e[1].EpsilonUsed = 0.1
+				return e, head, subject
+			},
+			want: "entry 2 does not match its hash",
+		},
+		{
+			name: "edited query text",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				e[2].QueryBody = "SELECT * FROM cohort"
+				return e, head, subject
+			},
+			want: "query text of entry 3 does not match its digest",
+		},
+		{
+			name: "dropped middle entry",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				return append(e[:1:1], e[2:]...), head, subject
+			},
+			want: "entries 2 to 2 are missing",
+		},
+		{
+			name: "dropped first entry",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				return e[1:], head, subject
+			},
+			want: "entry 2 does not link to the entry before it",
+		},
+		{
+			name: "dropped last entry",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				return e[:len(e)-1], head, subject
+			},
+			want: "but the budget's head is",
+		},
+		{
+			name: "reordered entries",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				e[1].Sequence, e[2].Sequence = e[2].Sequence, e[1].Sequence
+				return e, head, subject
+			},
+			want: "entry 2 does not link to the entry before it",
+		},
+		{
+			name: "relinked after an edit",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				// Rehashing the edited entry breaks the link of its successor.
+				e[1].EpsilonUsed = 0.1
+				e[1].Hash, _ = Hash(e[1])
+				return e, head, subject
+			},
+			want: "entry 3 does not link to the entry before it",
+		},
+		{
+			name: "entry of another budget",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				// A complete, internally valid chain of another subject.
+				return e, head, SubjectCommitment("tx0", "bob", "ds1")
+			},
+			want: "entry 1 belongs to another budget",
+		},
+		{
+			name: "commitment stripped",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				e[2].SubjectCommitment = ""
+				return e, head, subject
+			},
+			want: "entry 3 has no subject commitment but follows committed entries",
+		},
+		{
+			name: "hash removed",
+			tamper: func(e []*model.BudgetConsumptionLog, head string) ([]*model.BudgetConsumptionLog, string, string) {
+				e[3].Hash = ""
+				return e, head, subject
+			},
+			want: "entry 4 has no hash but follows chained entries",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, head := chain(t, subject, 4)
+			entries, head, subj := tt.tamper(entries, head)
+			_, err := Verify(entries, head, subj)
+			if err == nil {
+				t.Fatal("tampered chain verified")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashWithoutCommitmentIsUnchanged(t *testing.T) {
+	// Entries logged before v7 have no commitment; adding the field must not
+	// change their hashes.
+	entry := &model.BudgetConsumptionLog{DatasetID: "ds1", Sequence: 1, TxID: "tx1"}
+	got, err := Hash(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const v6 = `{"datasetId":"ds1","sequence":1,"purpose":"","queryDigest":"","epsilonUsed":0,` +
+		`"cumulativeEpsilon":0,"remainingEpsilon":0,"txId":"tx1","timestamp":"","mspId":"","prevHash":""}`
+	if want := QueryDigest(v6); got != want {
+		t.Fatalf("Hash = %s, want %s", got, want)
+	}
+}
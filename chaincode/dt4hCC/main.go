@@ -15,14 +15,70 @@ func main() {
 	querySC := new(dt4h.QueryContract)
 	querySC.TransactionContextHandler = new(dt4h.TransactionContext)
 	querySC.BeforeTransaction = dt4h.BeforeTransaction
+	querySC.AfterTransaction = dt4h.AfterTransaction
 
 	// Privacy Budget Contract – DP epsilon budget management
 	budgetSC := new(dt4h.PrivacyBudgetContract)
 	budgetSC.TransactionContextHandler = new(dt4h.TransactionContext)
 	budgetSC.BeforeTransaction = dt4h.BeforeTransaction
+	budgetSC.AfterTransaction = dt4h.AfterTransaction
+
+	// Identity Contract – stable accounts across certificate re-enrolment
+	identitySC := new(dt4h.IdentityContract)
+	identitySC.TransactionContextHandler = new(dt4h.TransactionContext)
+	identitySC.BeforeTransaction = dt4h.BeforeTransaction
+	identitySC.AfterTransaction = dt4h.AfterTransaction
+
+	// Erasure Contract – GDPR right to erasure
+	erasureSC := new(dt4h.ErasureContract)
+	erasureSC.TransactionContextHandler = new(dt4h.TransactionContext)
+	erasureSC.BeforeTransaction = dt4h.BeforeTransaction
+	erasureSC.AfterTransaction = dt4h.AfterTransaction
+
+	// Migration Contract – schema upgrades of persisted records
+	migrationSC := new(dt4h.MigrationContract)
+	migrationSC.TransactionContextHandler = new(dt4h.TransactionContext)
+	migrationSC.BeforeTransaction = dt4h.BeforeTransaction
+	migrationSC.AfterTransaction = dt4h.AfterTransaction
+
+	// Dataset Contract – dataset catalogue and referential integrity
+	datasetSC := new(dt4h.DatasetContract)
+	datasetSC.TransactionContextHandler = new(dt4h.TransactionContext)
+	datasetSC.BeforeTransaction = dt4h.BeforeTransaction
+	datasetSC.AfterTransaction = dt4h.AfterTransaction
+
+	// User Contract – researcher registry
+	userSC := new(dt4h.UserContract)
+	userSC.TransactionContextHandler = new(dt4h.TransactionContext)
+	userSC.BeforeTransaction = dt4h.BeforeTransaction
+	userSC.AfterTransaction = dt4h.AfterTransaction
+
+	// Consent Contract – data subject consent per dataset
+	consentSC := new(dt4h.ConsentContract)
+	consentSC.TransactionContextHandler = new(dt4h.TransactionContext)
+	consentSC.BeforeTransaction = dt4h.BeforeTransaction
+	consentSC.AfterTransaction = dt4h.AfterTransaction
+
+	// Purpose Contract – vocabulary of purposes of processing
+	purposeSC := new(dt4h.PurposeContract)
+	purposeSC.TransactionContextHandler = new(dt4h.TransactionContext)
+	purposeSC.BeforeTransaction = dt4h.BeforeTransaction
+	purposeSC.AfterTransaction = dt4h.AfterTransaction
+
+	// Agreement Contract – data use agreements budgets are granted under
+	agreementSC := new(dt4h.AgreementContract)
+	agreementSC.TransactionContextHandler = new(dt4h.TransactionContext)
+	agreementSC.BeforeTransaction = dt4h.BeforeTransaction
+	agreementSC.AfterTransaction = dt4h.AfterTransaction
+
+	// Provenance Contract – derivations between datasets
+	provenanceSC := new(dt4h.ProvenanceContract)
+	provenanceSC.TransactionContextHandler = new(dt4h.TransactionContext)
+	provenanceSC.BeforeTransaction = dt4h.BeforeTransaction
+	provenanceSC.AfterTransaction = dt4h.AfterTransaction
 
 	// Assemble Chaincode
-	dt4hCC, err := contractapi.NewChaincode(querySC, budgetSC)
+	dt4hCC, err := contractapi.NewChaincode(querySC, budgetSC, identitySC, erasureSC, migrationSC, datasetSC, userSC, consentSC, purposeSC, agreementSC, provenanceSC)
 	if err != nil {
 		log.Panicf("Error creating chaincode: %v", err)
 	}
@@ -0,0 +1,840 @@
+// Package model holds the dt4hCC domain types, status values and chaincode
+// event payloads. It imports only the standard library, so off-chain code
+// can decode ledger records and events without the chaincode shim.
+package model
+
+import "encoding/json"
+
+// ---------------------------------------------------------------------------
+// Constants
+// ---------------------------------------------------------------------------
+
+// Ways in which a caller's certificate can be resolved to a budget holder.
+const (
+	RESOLVED_VIA_LINK        = "link"
+	RESOLVED_VIA_ENROLLMENT  = "enrollment"
+	RESOLVED_VIA_CERTIFICATE = "certificate"
+)
+
+// Budget status values.
+const (
+	BUDGET_ACTIVE    = "Active"
+	BUDGET_EXHAUSTED = "Exhausted"
+	BUDGET_SUSPENDED = "Suspended"
+	BUDGET_REVOKED   = "Revoked"
+)
+
+// Reason codes accepted by SuspendBudget.
+const (
+	REASON_INVESTIGATION      = "INVESTIGATION"
+	REASON_POLICY_VIOLATION   = "POLICY_VIOLATION"
+	REASON_DATA_OWNER_REQUEST = "DATA_OWNER_REQUEST"
+	REASON_ADMINISTRATIVE     = "ADMINISTRATIVE"
+)
+
+// Reason codes accepted by ResumeBudget.
+const (
+	REASON_INVESTIGATION_CLOSED = "INVESTIGATION_CLOSED"
+	REASON_ISSUE_RESOLVED       = "ISSUE_RESOLVED"
+)
+
+// REASON_ERASURE is recorded on budgets revoked by EraseUserRecords.
+const REASON_ERASURE = "ERASURE"
+
+// REASON_AGREEMENT_ENDED is recorded on budgets suspended because their data
+// use agreement expired or was terminated.
+const REASON_AGREEMENT_ENDED = "AGREEMENT_ENDED"
+
+var SUSPEND_REASON_CODES = []string{
+	REASON_INVESTIGATION, REASON_POLICY_VIOLATION, REASON_DATA_OWNER_REQUEST, REASON_ADMINISTRATIVE,
+}
+
+var RESUME_REASON_CODES = []string{
+	REASON_INVESTIGATION_CLOSED, REASON_ISSUE_RESOLVED, REASON_ADMINISTRATIVE,
+}
+
+// Dataset status values. Retired is terminal.
+const (
+	DATASET_ACTIVE  = "Active"
+	DATASET_RETIRED = "Retired"
+)
+
+// Dataset sensitivity levels, from least to most sensitive.
+var SENSITIVITY_LEVELS = []string{"Public", "Internal", "Confidential", "Restricted"}
+
+// Researcher status values. Deactivated is terminal.
+const (
+	USER_ACTIVE      = "Active"
+	USER_SUSPENDED   = "Suspended"
+	USER_DEACTIVATED = "Deactivated"
+)
+
+// Consent status values. A withdrawn consent covers no purpose.
+const (
+	CONSENT_ACTIVE    = "Active"
+	CONSENT_WITHDRAWN = "Withdrawn"
+)
+
+// Purpose status values. Deprecated purposes stay readable on old records but
+// can no longer be declared.
+const (
+	PURPOSE_ACTIVE     = "Active"
+	PURPOSE_DEPRECATED = "Deprecated"
+)
+
+// Data use agreement status values. Expired and Terminated are terminal.
+const (
+	AGREEMENT_PROPOSED   = "Proposed"
+	AGREEMENT_ACTIVE     = "Active"
+	AGREEMENT_EXPIRED    = "Expired"
+	AGREEMENT_TERMINATED = "Terminated"
+)
+
+// Derivation status values. A derivation from another MSP's dataset stays
+// Proposed until that MSP approves it; only Active derivations are followed
+// when charging dataset-level budgets.
+const (
+	DERIVATION_PROPOSED = "Proposed"
+	DERIVATION_ACTIVE   = "Active"
+)
+
+// Roles a registered researcher may hold.
+var RESEARCHER_ROLES = []string{"Researcher", "PrincipalInvestigator", "DataSteward", "Auditor"}
+
+// EPSILON_HISTOGRAM_BOUNDS are the upper bounds of the per-query ε buckets
+// kept in DatasetStats. A last, unbounded bucket holds larger queries.
+var EPSILON_HISTOGRAM_BOUNDS = []float64{0.01, 0.1, 0.5, 1, 5, 10}
+
+// Error codes. An error of the chaincode that clients may want to handle
+// starts, where it originates, with one of them in square brackets, e.g.
+// "[NOT_FOUND] readBudget: no budget found for ...". Callers prefix it with
+// their own name, so a code may follow a "Function: " chain; the first code
+// in a message is the one that applies. Codes are stable, the wording of the
+// rest of the message is not.
+const (
+	ERR_NOT_FOUND           = "NOT_FOUND"
+	ERR_ALREADY_EXISTS      = "ALREADY_EXISTS"
+	ERR_INSUFFICIENT_BUDGET = "INSUFFICIENT_BUDGET"
+	ERR_NOT_ACTIVE          = "NOT_ACTIVE"
+	ERR_PURPOSE_NOT_ALLOWED = "PURPOSE_NOT_ALLOWED"
+	ERR_UNAUTHORIZED        = "UNAUTHORIZED"
+	ERR_INVALID_ARGUMENT    = "INVALID_ARGUMENT"
+)
+
+// ---------------------------------------------------------------------------
+// Domain types – Query tracking
+// ---------------------------------------------------------------------------
+
+// Query represents a single logged query with its epsilon cost.
+type Query struct {
+	ObjectType    string  `json:"type"`
+	SchemaVersion int     `json:"schemaVersion"`
+	QueryBody     string  `json:"queryBody"`
+	DatasetID     string  `json:"datasetId"`
+	Purpose       string  `json:"purpose"` // purpose of processing; "" on entries logged before v2
+	EpsilonUsed   float64 `json:"epsilonUsed"`
+	Timestamp     string  `json:"timestamp"`
+	TxID          string  `json:"txId"`
+}
+
+// UserQuery is a query log entry together with the user who ran it, as
+// returned by history queries spanning several users.
+type UserQuery struct {
+	UserID string `json:"userId"`
+	Query  Query  `json:"query"`
+}
+
+// UserHistory is the full query history for a given user.
+type UserHistory struct {
+	UserID  string  `json:"userId"`
+	Queries []Query `json:"queries"`
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Privacy Budget
+// ---------------------------------------------------------------------------
+
+// PrivacyBudget tracks the total and consumed epsilon for a (user, dataset) pair.
+type PrivacyBudget struct {
+	ObjectType     string  `json:"type"`
+	SchemaVersion  int     `json:"schemaVersion"`
+	UserID         string  `json:"userId"`
+	DatasetID      string  `json:"datasetId"`
+	TotalBudget    float64 `json:"totalBudget"`                                 // maximum epsilon allowed
+	ConsumedBudget float64 `json:"consumedBudget"`                              // epsilon spent so far
+	Status         string  `json:"status"`                                      // Active | Exhausted | Suspended | Revoked
+	StatusReason   string  `json:"statusReason,omitempty" metadata:",optional"` // reason code of the last Suspend/Resume
+	StatusNote     string  `json:"statusNote,omitempty" metadata:",optional"`   // free-text justification
+	// AllowedPurposes restricts the purposes the budget may be spent on;
+	// empty means any purpose covered by consent.
+	AllowedPurposes []string `json:"allowedPurposes"`
+	// AgreementID is the data use agreement the budget was granted under;
+	// empty for budgets created before agreements were required.
+	AgreementID string `json:"agreementId,omitempty" metadata:",optional"`
+	// Query counters maintained by ConsumeBudget.
+	QueryCount  int     `json:"queryCount"`
+	LastQueryAt string  `json:"lastQueryAt,omitempty" metadata:",optional"` // empty until the first query
+	MaxEpsilon  float64 `json:"maxEpsilon"`                                 // largest ε spent by a single query
+	// LogSequence is the sequence number of the budget's latest consumption
+	// log entry.
+	LogSequence int `json:"logSequence"`
+	// LogHeadHash is the hash of the latest hash-chained consumption log
+	// entry; empty until the first entry logged since v6.
+	LogHeadHash string `json:"logHeadHash,omitempty" metadata:",optional"`
+	// SubjectCommitment identifies the budget in the hashes of its log
+	// entries, see logchain.SubjectCommitment. It is fixed when the budget is
+	// first written, kept by erasure, and empty on budgets last written
+	// before v9.
+	SubjectCommitment string `json:"subjectCommitment,omitempty" metadata:",optional"`
+	CreatedAt         string `json:"createdAt"`
+	UpdatedAt         string `json:"updatedAt"`
+	// UpdatedBy is the MSP that submitted the latest change; empty on budgets
+	// last written before v7.
+	UpdatedBy string `json:"updatedBy,omitempty" metadata:",optional"`
+	// WarningThresholds are the percentages of the total consumed at which a
+	// warning is raised, ascending; empty means the dataset's thresholds.
+	WarningThresholds []float64 `json:"warningThresholds,omitempty" metadata:",optional"`
+	// WarningLevel is the highest threshold the consumption has reached, 0
+	// if none; WarningReachedAt is when it was reached.
+	WarningLevel     float64 `json:"warningLevel"`
+	WarningReachedAt string  `json:"warningReachedAt,omitempty" metadata:",optional"`
+}
+
+// BudgetHistoryEntry is one modification of a budget as recorded in the
+// ledger's history.
+type BudgetHistoryEntry struct {
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"` // RFC 3339 timestamp of the transaction
+	// Actor is the MSP that submitted the change, taken from the budget's
+	// updatedBy; empty for deletions and changes made before v7.
+	Actor    string         `json:"actor,omitempty" metadata:",optional"`
+	IsDelete bool           `json:"isDelete"`
+	Budget   *PrivacyBudget `json:"budget,omitempty" metadata:",optional"` // state after the change; nil for deletions
+}
+
+// RemainingBudget returns the epsilon still available.
+func (pb *PrivacyBudget) RemainingBudget() float64 {
+	return pb.TotalBudget - pb.ConsumedBudget
+}
+
+// CanConsume checks whether the budget has enough epsilon left.
+func (pb *PrivacyBudget) CanConsume(epsilon float64) bool {
+	return pb.Status == BUDGET_ACTIVE && pb.RemainingBudget() >= epsilon
+}
+
+// BudgetConsumptionLog is an immutable audit-trail entry written every time
+// epsilon is deducted from a budget.
+type BudgetConsumptionLog struct {
+	ObjectType    string  `json:"type"`
+	SchemaVersion int     `json:"schemaVersion"`
+	UserID        string  `json:"userId"`
+	DatasetID     string  `json:"datasetId"`
+	QueryBody     string  `json:"queryBody"`
+	Purpose       string  `json:"purpose"` // purpose of processing; "" on entries logged before v2
+	EpsilonUsed   float64 `json:"epsilonUsed"`
+	// Cumulative consumed budget *after* this deduction.
+	CumulativeEpsilon float64 `json:"cumulativeEpsilon"`
+	RemainingEpsilon  float64 `json:"remainingEpsilon"`
+	TxID              string  `json:"txId"`
+	Timestamp         string  `json:"timestamp"`
+	// Sequence numbers the entries of a budget from 1 in the order they were
+	// logged; 0 on entries logged before v5 until MigrateRecords numbers them.
+	Sequence int `json:"sequence"`
+	// MspID is the MSP that submitted the consumption; "" on entries logged
+	// before v4.
+	MspID string `json:"mspId,omitempty" metadata:",optional"`
+	// Hash chain, see logchain.Hash. All three are "" on entries logged
+	// before v6. QueryDigest is the hex SHA-256 of the query text, kept when
+	// erasure removes the text; PrevHash is the Hash of the budget's previous
+	// chained entry, "" for the first one.
+	QueryDigest string `json:"queryDigest,omitempty" metadata:",optional"`
+	PrevHash    string `json:"prevHash,omitempty" metadata:",optional"`
+	Hash        string `json:"hash,omitempty" metadata:",optional"`
+	// SubjectCommitment is the budget's subject commitment at the time of
+	// the entry; "" on entries logged before v7.
+	SubjectCommitment string `json:"subjectCommitment,omitempty" metadata:",optional"`
+	// Erased is set when the entry was anonymised by EraseUserRecords; the
+	// userId is then a pseudonym and the query text has been removed.
+	Erased bool `json:"erased,omitempty" metadata:",optional"`
+}
+
+// BudgetRequest is one entry of a batch provisioning call, passed to the
+// *Batch functions as an element of a JSON array.
+type BudgetRequest struct {
+	UserID       string  `json:"userId"`
+	DatasetID    string  `json:"datasetId"`
+	TotalEpsilon float64 `json:"totalEpsilon,omitempty"` // ignored by RevokeBudgetsBatch
+	AgreementID  string  `json:"agreementId,omitempty"`  // required by InitializeBudgetsBatch only
+}
+
+// BudgetBatchResult reports the state of a budget after one batch entry was
+// applied. Index is the entry's position in the request array.
+type BudgetBatchResult struct {
+	Index  int            `json:"index"`
+	Budget *PrivacyBudget `json:"budget"`
+}
+
+// BudgetPage is one page of a paginated budget listing. Pass Bookmark back
+// to fetch the next page. The listing is complete when Bookmark is empty or
+// FetchedCount is below the requested page size. Results may be shorter than
+// FetchedCount, because index entries whose record is gone are skipped, so
+// its length says nothing about further pages. The same holds for the other
+// *Page types.
+type BudgetPage struct {
+	Results      []*PrivacyBudget `json:"results"`
+	Bookmark     string           `json:"bookmark"`
+	FetchedCount int32            `json:"fetchedCount"`
+}
+
+// LogPage is one page of a paginated consumption-log listing.
+type LogPage struct {
+	Results      []*BudgetConsumptionLog `json:"results"`
+	Bookmark     string                  `json:"bookmark"`
+	FetchedCount int32                   `json:"fetchedCount"`
+}
+
+// QueryPage is one page of a user's paginated query history.
+type QueryPage struct {
+	UserID       string  `json:"userId"`
+	Results      []Query `json:"results"`
+	Bookmark     string  `json:"bookmark"`
+	FetchedCount int32   `json:"fetchedCount"`
+}
+
+// DatasetPage is one page of a paginated catalogue listing.
+type DatasetPage struct {
+	Results      []*Dataset `json:"results"`
+	Bookmark     string     `json:"bookmark"`
+	FetchedCount int32      `json:"fetchedCount"`
+}
+
+// ResearcherPage is one page of a paginated researcher listing.
+type ResearcherPage struct {
+	Results      []*Researcher `json:"results"`
+	Bookmark     string        `json:"bookmark"`
+	FetchedCount int32         `json:"fetchedCount"`
+}
+
+// BudgetSummary is a convenience view returned by query functions.
+type BudgetSummary struct {
+	UserID          string  `json:"userId"`
+	DatasetID       string  `json:"datasetId"`
+	TotalBudget     float64 `json:"totalBudget"`
+	ConsumedBudget  float64 `json:"consumedBudget"`
+	RemainingBudget float64 `json:"remainingBudget"`
+	Status          string  `json:"status"`
+	QueryCount      int     `json:"queryCount"`
+	LastQueryAt     string  `json:"lastQueryAt,omitempty" metadata:",optional"`
+	MaxEpsilon      float64 `json:"maxEpsilon"`
+	// WarningLevel is the highest warning threshold reached, 0 if none.
+	WarningLevel     float64 `json:"warningLevel"`
+	WarningReachedAt string  `json:"warningReachedAt,omitempty" metadata:",optional"`
+}
+
+// LogChainReport is the result of checking a budget's consumption log
+// against its hash chain.
+type LogChainReport struct {
+	UserID         string `json:"userId"`
+	DatasetID      string `json:"datasetId"`
+	Entries        int    `json:"entries"`        // consumption log entries found
+	ChainedEntries int    `json:"chainedEntries"` // entries verified against the chain
+	HeadHash       string `json:"headHash,omitempty" metadata:",optional"`
+	Valid          bool   `json:"valid"`
+	Failure        string `json:"failure,omitempty" metadata:",optional"` // first problem found when not Valid
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Dataset registry
+// ---------------------------------------------------------------------------
+
+// Dataset is a catalogue entry. Budgets and queries may only refer to
+// registered datasets that are Active.
+type Dataset struct {
+	ObjectType       string `json:"type"`
+	SchemaVersion    int    `json:"schemaVersion"`
+	DatasetID        string `json:"datasetId"`
+	OwnerMSP         string `json:"ownerMsp"` // organization that registered and manages the dataset
+	Title            string `json:"title"`
+	SensitivityLevel string `json:"sensitivityLevel"` // one of SENSITIVITY_LEVELS
+	RecordCount      int64  `json:"recordCount"`
+	SchemaHash       string `json:"schemaHash"` // hash of the dataset's data schema
+	Status           string `json:"status"`     // Active | Retired
+	// WarningThresholds are the default warning thresholds of the budgets on
+	// the dataset, in percent consumed; a budget may define its own.
+	WarningThresholds []float64 `json:"warningThresholds,omitempty" metadata:",optional"`
+	CreatedAt         string    `json:"createdAt"`
+	UpdatedAt         string    `json:"updatedAt"`
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Consent
+// ---------------------------------------------------------------------------
+
+// Consent is the scope of processing the data subjects of a dataset agreed
+// to, as recorded by the data provider. There is one current Consent per
+// dataset; earlier scopes are kept in the key history.
+type Consent struct {
+	ObjectType      string   `json:"type"`
+	SchemaVersion   int      `json:"schemaVersion"`
+	DatasetID       string   `json:"datasetId"`
+	ProviderMSP     string   `json:"providerMsp"`     // dataset owner that recorded the consent
+	AllowedPurposes []string `json:"allowedPurposes"` // purposes of processing consented to
+	// SecondaryUse extends the consent to purposes beyond AllowedPurposes
+	// that the vocabulary marks as secondary use.
+	SecondaryUse bool   `json:"secondaryUse"`
+	ExpiresAt    string `json:"expiresAt,omitempty" metadata:",optional"` // RFC 3339; empty means no expiry
+	Status       string `json:"status"`                                   // Active | Withdrawn
+	StatusNote   string `json:"statusNote,omitempty" metadata:",optional"`
+	CreatedAt    string `json:"createdAt"`
+	UpdatedAt    string `json:"updatedAt"`
+}
+
+// Purpose is an entry of the controlled vocabulary of purposes of
+// processing that queries, consents and budgets refer to.
+type Purpose struct {
+	ObjectType    string `json:"type"`
+	SchemaVersion int    `json:"schemaVersion"`
+	PurposeID     string `json:"purposeId"`
+	Description   string `json:"description"`
+	// SecondaryUse marks purposes that are further processing beyond the
+	// reason the data was collected; consent with secondaryUse covers them.
+	SecondaryUse bool   `json:"secondaryUse"`
+	Status       string `json:"status"`    // Active | Deprecated
+	DefinedBy    string `json:"definedBy"` // MSP of the defining administrator
+	CreatedAt    string `json:"createdAt"`
+	UpdatedAt    string `json:"updatedAt"`
+}
+
+// ConsentCheck is the answer of CheckConsent for one (dataset, purpose).
+type ConsentCheck struct {
+	DatasetID string `json:"datasetId"`
+	Purpose   string `json:"purpose"`
+	Covered   bool   `json:"covered"`
+	Reason    string `json:"reason,omitempty" metadata:",optional"` // why the purpose is not covered
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Data use agreements
+// ---------------------------------------------------------------------------
+
+// DataUseAgreement is the legal basis a budget is granted under. It names
+// the budget holders, datasets and purposes it covers and becomes Active
+// once every dataset owner has approved it.
+type DataUseAgreement struct {
+	ObjectType        string   `json:"type"`
+	SchemaVersion     int      `json:"schemaVersion"`
+	AgreementID       string   `json:"agreementId"`
+	Parties           []string `json:"parties"`  // budget holders (user IDs) covered
+	Datasets          []string `json:"datasets"` // datasets covered
+	Purposes          []string `json:"purposes"` // vocabulary purposes covered
+	ValidFrom         string   `json:"validFrom"`
+	ValidUntil        string   `json:"validUntil"`
+	DocumentHash      string   `json:"documentHash"` // hash of the signed agreement document
+	ProposedBy        string   `json:"proposedBy"`   // MSP of the proposing administrator
+	RequiredApprovals []string `json:"requiredApprovals"`
+	ApprovedBy        []string `json:"approvedBy"`
+	Status            string   `json:"status"` // Proposed | Active | Expired | Terminated
+	StatusNote        string   `json:"statusNote,omitempty" metadata:",optional"`
+	CreatedAt         string   `json:"createdAt"`
+	UpdatedAt         string   `json:"updatedAt"`
+}
+
+// AgreementSweepReport lists the agreements SweepExpiredAgreements expired
+// and the number of budgets it suspended as a result.
+type AgreementSweepReport struct {
+	Expired          []string `json:"expired"`
+	BudgetsSuspended int      `json:"budgetsSuspended"`
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Provenance
+// ---------------------------------------------------------------------------
+
+// Derivation records that a dataset was produced from another one. A dataset
+// derived from several parents has one Derivation per parent.
+type Derivation struct {
+	ObjectType    string `json:"type"`
+	SchemaVersion int    `json:"schemaVersion"`
+	ChildID       string `json:"childId"`
+	ParentID      string `json:"parentId"`
+	Description   string `json:"description"` // how the child was produced
+	RecordedBy    string `json:"recordedBy"`  // MSP owning the child dataset
+	Status        string `json:"status"`
+	ApprovedBy    string `json:"approvedBy,omitempty" metadata:",optional"` // MSP owning the parent dataset; "" on derivations recorded before v2
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
+// LineageEdge is one derivation reached by GetLineage, with its distance
+// from the dataset the traversal started at.
+type LineageEdge struct {
+	ChildID  string `json:"childId"`
+	ParentID string `json:"parentId"`
+	Depth    int    `json:"depth"`
+}
+
+// Lineage is the result of GetLineage: every derivation leading to the
+// dataset and every derivation leading away from it, nearest first.
+type Lineage struct {
+	DatasetID   string         `json:"datasetId"`
+	Ancestors   []*LineageEdge `json:"ancestors"`
+	Descendants []*LineageEdge `json:"descendants"`
+}
+
+// DatasetBudget caps the total epsilon spent on a dataset by all users,
+// including queries on datasets derived from it.
+type DatasetBudget struct {
+	ObjectType     string  `json:"type"`
+	SchemaVersion  int     `json:"schemaVersion"`
+	DatasetID      string  `json:"datasetId"`
+	TotalBudget    float64 `json:"totalBudget"`
+	ConsumedBudget float64 `json:"consumedBudget"`
+	SetBy          string  `json:"setBy"` // MSP that last set the cap
+	CreatedAt      string  `json:"createdAt"`
+	UpdatedAt      string  `json:"updatedAt"`
+}
+
+// RemainingBudget returns the epsilon still available.
+func (db *DatasetBudget) RemainingBudget() float64 {
+	return db.TotalBudget - db.ConsumedBudget
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Dataset analytics
+// ---------------------------------------------------------------------------
+
+// DatasetStats holds aggregates over every budget and consumption on a
+// dataset. The ledger keeps one shard per budget holder, with UserID set,
+// updated on each write to that holder's budget; GetDatasetStats returns
+// their sum, without a UserID.
+type DatasetStats struct {
+	ObjectType       string           `json:"type"`
+	SchemaVersion    int              `json:"schemaVersion"`
+	DatasetID        string           `json:"datasetId"`
+	UserID           string           `json:"userId,omitempty" metadata:",optional"` // budget holder of a shard
+	BudgetCount      int              `json:"budgetCount"`
+	ActiveBudgets    int              `json:"activeBudgets"`
+	ExhaustedBudgets int              `json:"exhaustedBudgets"`
+	SuspendedBudgets int              `json:"suspendedBudgets"`
+	RevokedBudgets   int              `json:"revokedBudgets"`
+	TotalAllocated   float64          `json:"totalAllocated"` // sum of totalBudget
+	TotalConsumed    float64          `json:"totalConsumed"`  // sum of consumedBudget
+	QueryCount       int              `json:"queryCount"`
+	ByMSP            []*MSPUsage      `json:"byMsp"`            // ordered by mspId
+	EpsilonHistogram []*EpsilonBucket `json:"epsilonHistogram"` // one bucket per EPSILON_HISTOGRAM_BOUNDS, plus one
+	UpdatedAt        string           `json:"updatedAt"`
+}
+
+// MSPUsage is the consumption on a dataset submitted by one MSP. Entries
+// logged before consumption logs recorded their MSP count under "".
+type MSPUsage struct {
+	MspID           string  `json:"mspId"`
+	QueryCount      int     `json:"queryCount"`
+	EpsilonConsumed float64 `json:"epsilonConsumed"`
+}
+
+// EpsilonBucket counts the queries whose ε falls in (lowerBound, upperBound].
+// The last bucket has no upper bound.
+type EpsilonBucket struct {
+	LowerBound float64 `json:"lowerBound"`
+	UpperBound float64 `json:"upperBound,omitempty" metadata:",optional"`
+	QueryCount int     `json:"queryCount"`
+	Epsilon    float64 `json:"epsilon"` // total ε of the queries in the bucket
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Audit reports
+// ---------------------------------------------------------------------------
+
+// Scopes accepted by GetAuditReport.
+const (
+	REPORT_SCOPE_DATASET      = "dataset"
+	REPORT_SCOPE_ORGANISATION = "organisation"
+)
+
+// Administrative actions listed in an audit report.
+const (
+	ACTION_BUDGET_INITIALIZED = "BudgetInitialized"
+	ACTION_BUDGET_UPDATED     = "BudgetUpdated"
+	ACTION_BUDGET_SUSPENDED   = "BudgetSuspended"
+	ACTION_BUDGET_RESUMED     = "BudgetResumed"
+	ACTION_BUDGET_REVOKED     = "BudgetRevoked"
+	ACTION_BUDGET_ERASED      = "BudgetErased"
+)
+
+// AuditReport lists the privacy expenditure on a dataset, or on every
+// dataset an organisation owns, over a period. MerkleRoot commits to its
+// scope, budget lines, administrative actions and entries, see
+// logchain.AuditRoot.
+type AuditReport struct {
+	Scope        string                  `json:"scope"`   // dataset | organisation
+	ScopeID      string                  `json:"scopeId"` // dataset ID or owner MSP ID
+	From         string                  `json:"from"`    // inclusive, RFC 3339
+	To           string                  `json:"to"`      // exclusive, RFC 3339
+	GeneratedAt  string                  `json:"generatedAt"`
+	TxID         string                  `json:"txId"` // transaction that generated the report
+	DatasetIDs   []string                `json:"datasetIds"`
+	Totals       AuditTotals             `json:"totals"`
+	Budgets      []*AuditBudgetLine      `json:"budgets"`   // ordered by dataset, then user
+	ByPurpose    []*PurposeUsage         `json:"byPurpose"` // ordered by purpose
+	ByMSP        []*MSPUsage             `json:"byMsp"`     // ordered by mspId
+	AdminActions []*AdminAction          `json:"adminActions"`
+	Entries      []*BudgetConsumptionLog `json:"entries"` // ordered by timestamp, dataset, user and sequence
+	MerkleRoot   string                  `json:"merkleRoot"`
+}
+
+// AuditTotals sums an audit report. Allocation and lifetime consumption are
+// those of the budgets in scope; the period figures count the report's
+// entries.
+type AuditTotals struct {
+	BudgetCount      int     `json:"budgetCount"`
+	EpsilonAllocated float64 `json:"epsilonAllocated"`
+	EpsilonConsumed  float64 `json:"epsilonConsumed"`
+	PeriodQueries    int     `json:"periodQueries"`
+	PeriodEpsilon    float64 `json:"periodEpsilon"`
+}
+
+// AuditBudgetLine is the current state of one budget in an audit report and
+// what was spent from it in the period.
+type AuditBudgetLine struct {
+	UserID         string  `json:"userId"`
+	DatasetID      string  `json:"datasetId"`
+	Status         string  `json:"status"`
+	TotalBudget    float64 `json:"totalBudget"`
+	ConsumedBudget float64 `json:"consumedBudget"`
+	PeriodQueries  int     `json:"periodQueries"`
+	PeriodEpsilon  float64 `json:"periodEpsilon"`
+}
+
+// PurposeUsage is the consumption logged under one purpose of processing.
+type PurposeUsage struct {
+	Purpose         string  `json:"purpose"`
+	QueryCount      int     `json:"queryCount"`
+	EpsilonConsumed float64 `json:"epsilonConsumed"`
+}
+
+// AdminAction is an administrative change to a budget, derived from the
+// budget's ledger history. Changes to agreements, consent, datasets and
+// purposes are not budget changes and have no AdminAction.
+type AdminAction struct {
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	Actor     string `json:"actor,omitempty" metadata:",optional"` // MSP that submitted the change, when recorded
+	Action    string `json:"action"`                               // one of the ACTION_* values
+	UserID    string `json:"userId"`
+	DatasetID string `json:"datasetId"`
+	Detail    string `json:"detail,omitempty" metadata:",optional"`
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Chaincode events
+// ---------------------------------------------------------------------------
+
+// BUDGET_EVENT_NAME is the Fabric event name every EventEnvelope is
+// published under.
+const BUDGET_EVENT_NAME = "dt4h.BudgetEvents"
+
+// Envelope and payload versions. A payload version is bumped whenever a
+// field of that payload changes meaning or is removed.
+const (
+	EVENT_ENVELOPE_VERSION = 1
+	EVENT_PAYLOAD_VERSION  = 1
+)
+
+// Event types carried in an EventEnvelope.
+const (
+	EVENT_BUDGET_INITIALIZED = "BudgetInitialized"
+	EVENT_BUDGET_CONSUMED    = "BudgetConsumed"
+	EVENT_BUDGET_EXHAUSTED   = "BudgetExhausted"
+	EVENT_BUDGET_UPDATED     = "BudgetUpdated"
+	EVENT_BUDGET_SUSPENDED   = "BudgetSuspended"
+	EVENT_BUDGET_RESUMED     = "BudgetResumed"
+	EVENT_BUDGET_REVOKED     = "BudgetRevoked"
+	EVENT_BUDGET_ERASED      = "BudgetErased"
+	EVENT_THRESHOLD_CROSSED  = "BudgetThresholdCrossed"
+	EVENT_QUERY_LOGGED       = "QueryLogged"
+)
+
+// EventEnvelope is the payload of the single chaincode event a transaction
+// emits. Fabric keeps only one event per transaction, so every change the
+// transaction made is listed in Events, in the order it was made.
+type EventEnvelope struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	TxID          string            `json:"txId"`
+	Timestamp     string            `json:"timestamp"`
+	MspID         string            `json:"mspId"` // MSP that submitted the transaction
+	Events        []*ChaincodeEvent `json:"events"`
+}
+
+// ChaincodeEvent is one typed change inside an EventEnvelope. Payload
+// decodes into the payload type of its Type: BudgetEventPayload for the
+// budget state changes, BudgetConsumedPayload, ThresholdCrossedPayload,
+// QueryLoggedPayload and BudgetErasedPayload.
+type ChaincodeEvent struct {
+	Type    string          `json:"type"`    // one of the EVENT_* values
+	Version int             `json:"version"` // payload version
+	Payload json.RawMessage `json:"payload"`
+}
+
+// BudgetEventPayload describes a budget after a state change. The previous
+// status and total are set when they differ from the current ones.
+type BudgetEventPayload struct {
+	UserID              string  `json:"userId"`
+	DatasetID           string  `json:"datasetId"`
+	Status              string  `json:"status"`
+	PreviousStatus      string  `json:"previousStatus,omitempty"`
+	StatusReason        string  `json:"statusReason,omitempty"`
+	TotalBudget         float64 `json:"totalBudget"`
+	PreviousTotalBudget float64 `json:"previousTotalBudget,omitempty"`
+	ConsumedBudget      float64 `json:"consumedBudget"`
+	RemainingBudget     float64 `json:"remainingBudget"`
+	AgreementID         string  `json:"agreementId,omitempty"`
+	WarningLevel        float64 `json:"warningLevel"`
+	SubjectCommitment   string  `json:"subjectCommitment,omitempty"` // see PrivacyBudget.SubjectCommitment
+}
+
+// BudgetConsumedPayload describes a charge against a budget and the
+// consumption log entry that records it.
+type BudgetConsumedPayload struct {
+	UserID            string  `json:"userId"`
+	DatasetID         string  `json:"datasetId"`
+	Purpose           string  `json:"purpose"`
+	EpsilonUsed       float64 `json:"epsilonUsed"`
+	ConsumedBudget    float64 `json:"consumedBudget"`
+	RemainingBudget   float64 `json:"remainingBudget"`
+	Sequence          int     `json:"sequence"`
+	LogHash           string  `json:"logHash"`
+	SubjectCommitment string  `json:"subjectCommitment,omitempty"` // see PrivacyBudget.SubjectCommitment
+}
+
+// ThresholdCrossedPayload describes a charge that took a budget's
+// consumption past one of its warning thresholds.
+type ThresholdCrossedPayload struct {
+	UserID          string  `json:"userId"`
+	DatasetID       string  `json:"datasetId"`
+	Threshold       float64 `json:"threshold"`       // percent of the total
+	ConsumedPercent float64 `json:"consumedPercent"` // after the charge
+	ConsumedBudget  float64 `json:"consumedBudget"`
+	RemainingBudget float64 `json:"remainingBudget"`
+}
+
+// BudgetErasedPayload describes a budget that EraseUserRecords moved under a
+// pseudonym. The erased user ID is not published: the budget is identified
+// by its dataset and subject commitment, which earlier events of the budget
+// carried alongside the user ID.
+type BudgetErasedPayload struct {
+	DatasetID         string `json:"datasetId"`
+	SubjectCommitment string `json:"subjectCommitment"` // "" for a budget last written before v9
+	Pseudonym         string `json:"pseudonym"`
+}
+
+// QueryLoggedPayload describes a query recorded by LogQuery. The query text
+// is not published; QueryDigest identifies it.
+type QueryLoggedPayload struct {
+	UserID      string  `json:"userId"`
+	DatasetID   string  `json:"datasetId"`
+	Purpose     string  `json:"purpose"`
+	EpsilonUsed float64 `json:"epsilonUsed"`
+	QueryDigest string  `json:"queryDigest"`
+	Sequence    int     `json:"sequence"`
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Researcher registry
+// ---------------------------------------------------------------------------
+
+// Researcher is the profile of a budget holder. Budgets may only be granted
+// to, and consumed by, registered researchers that are Active.
+type Researcher struct {
+	ObjectType    string   `json:"type"`
+	SchemaVersion int      `json:"schemaVersion"`
+	UserID        string   `json:"userId"` // budget-holder ID (account ID or X.509 ID)
+	Affiliation   string   `json:"affiliation"`
+	Role          string   `json:"role"`     // one of RESEARCHER_ROLES
+	Projects      []string `json:"projects"` // project memberships
+	Status        string   `json:"status"`   // Active | Suspended | Deactivated
+	StatusReason  string   `json:"statusReason,omitempty" metadata:",optional"`
+	StatusNote    string   `json:"statusNote,omitempty" metadata:",optional"`
+	RegisteredBy  string   `json:"registeredBy"` // MSP of the registering administrator
+	CreatedAt     string   `json:"createdAt"`
+	UpdatedAt     string   `json:"updatedAt"`
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Identity continuity
+// ---------------------------------------------------------------------------
+
+// IdentityAccount is the stable budget holder behind one or more certificates.
+// Budgets are keyed by AccountID, so re-enrolling or reissuing a certificate
+// does not orphan them.
+type IdentityAccount struct {
+	ObjectType    string   `json:"type"`
+	SchemaVersion int      `json:"schemaVersion"`
+	AccountID     string   `json:"accountId"` // userID under which budgets are held
+	MspID         string   `json:"mspId"`
+	EnrollmentID  string   `json:"enrollmentId"` // Fabric CA enrollment ID (hf.EnrollmentID)
+	LinkedIDs     []string `json:"linkedIds"`    // X.509 IDs explicitly linked by an admin
+	CreatedAt     string   `json:"createdAt"`
+	UpdatedAt     string   `json:"updatedAt"`
+}
+
+// IdentityLink maps a single X.509 ID to an account. It is written by an
+// administrator when a certificate cannot be matched on enrollment ID alone
+// (e.g. the person was re-registered under a new enrollment ID).
+type IdentityLink struct {
+	ObjectType    string `json:"type"`
+	SchemaVersion int    `json:"schemaVersion"`
+	CertID        string `json:"certId"`
+	AccountID     string `json:"accountId"`
+	ApprovedBy    string `json:"approvedBy"` // MSP of the approving administrator
+	LinkedAt      string `json:"linkedAt"`
+}
+
+// IdentityResolution describes how the caller's certificate was mapped to a
+// budget holder by BeforeTransaction.
+type IdentityResolution struct {
+	CertID       string `json:"certId"`
+	AccountID    string `json:"accountId"`
+	MspID        string `json:"mspId"`
+	EnrollmentID string `json:"enrollmentId"`
+	ResolvedVia  string `json:"resolvedVia"` // link | enrollment | certificate
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Erasure
+// ---------------------------------------------------------------------------
+
+// ErasureCertificate is the permanent record of an EraseUserRecords call. It
+// holds no direct identifier: SubjectDigest is salted with the secret the DPO
+// supplied, so only the holder of that salt can tie it back to the subject.
+type ErasureCertificate struct {
+	ObjectType                string   `json:"type"`
+	SchemaVersion             int      `json:"schemaVersion"`
+	CertificateID             string   `json:"certificateId"` // tx ID of the erasure
+	RequestRef                string   `json:"requestRef"`    // DPO's reference for the erasure request
+	SubjectDigest             string   `json:"subjectDigest"` // hex SHA-256 of salt || userID
+	DatasetIDs                []string `json:"datasetIds"`    // datasets whose budgets were anonymised
+	BudgetsAnonymised         int      `json:"budgetsAnonymised"`
+	ConsumptionLogsAnonymised int      `json:"consumptionLogsAnonymised"`
+	QueryLogsDeleted          int      `json:"queryLogsDeleted"`
+	IdentityRecordsDeleted    int      `json:"identityRecordsDeleted"`
+	EpsilonPreserved          float64  `json:"epsilonPreserved"` // ε accounting kept under the pseudonym
+	ErasedBy                  string   `json:"erasedBy"`         // MSP of the administrator
+	ErasedAt                  string   `json:"erasedAt"`
+}
+
+// ---------------------------------------------------------------------------
+// Domain types – Schema migration
+// ---------------------------------------------------------------------------
+
+// MigrationReport describes one MigrateRecords batch. Pass ResumeToken back
+// to continue where the batch stopped; Done is set once every record of the
+// object type has been visited.
+type MigrationReport struct {
+	ObjectType    string `json:"objectType"`
+	TargetVersion int    `json:"targetVersion"`
+	Scanned       int    `json:"scanned"`
+	Migrated      int    `json:"migrated"`
+	ResumeToken   string `json:"resumeToken"`
+	Done          bool   `json:"done"`
+}